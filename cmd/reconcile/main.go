@@ -0,0 +1,61 @@
+// Command reconcile compares the payments a provider captured in a date range
+// with our records and prints the report. Run it daily from cron, e.g.
+//
+//	go run ./cmd/reconcile -from 2024-05-01 -to 2024-05-02
+package main
+
+import (
+	paymentutils "em_backend/library/payment"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+func main() {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(dateLayout)
+
+	provider := flag.String("provider", "", "payment provider, defaults to PAYMENT_PROVIDER")
+	fromDate := flag.String("from", yesterday, "first day to reconcile (YYYY-MM-DD, UTC)")
+	toDate := flag.String("to", "", "last day to reconcile (YYYY-MM-DD, UTC), defaults to -from")
+	dryRun := flag.Bool("dry-run", false, "report missed captures without confirming them")
+	flag.Parse()
+
+	if *toDate == "" {
+		toDate = fromDate
+	}
+	from, err := time.Parse(dateLayout, *fromDate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid -from date:", err)
+		os.Exit(2)
+	}
+	to, err := time.Parse(dateLayout, *toDate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid -to date:", err)
+		os.Exit(2)
+	}
+	if to.Before(from) {
+		fmt.Fprintln(os.Stderr, "-to must not be before -from")
+		os.Exit(2)
+	}
+
+	// Include the whole last day
+	report, err := paymentutils.Reconcile(*provider, from.Unix(), to.AddDate(0, 0, 1).Unix()-1, *dryRun, "cli")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Reconciliation failed:", err)
+		os.Exit(1)
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	// Unresolved mismatches need finance to look at them
+	for _, item := range report.Items {
+		if !item.Fixed {
+			os.Exit(3)
+		}
+	}
+}
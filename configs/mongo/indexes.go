@@ -0,0 +1,230 @@
+package ConnectMongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collectionIndexes are the indexes the service relies on for correctness.
+var collectionIndexes = map[string][]mongo.IndexModel{
+	// One active individual registration per user per event. Group tickets
+	// are bought several at a time and closed registrations do not count.
+	"registrations": {
+		{
+			Keys: bson.D{{Key: "uniqueId", Value: 1}, {Key: "primaryemailid", Value: 1}},
+			Options: options.Index().
+				SetName("unique_active_registration").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"groupOrderId": "", "isActive": true}),
+		},
+	},
+	"orderDetails": {
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}},
+			Options: options.Index().SetName("unique_order").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("order_expiry"),
+		},
+	},
+	// Each provider webhook event is processed once
+	"webhookEvents": {
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "eventId", Value: 1}},
+			Options: options.Index().SetName("unique_webhook_event").SetUnique(true),
+		},
+	},
+	// Counts the uses of a promo code by each user
+	"promoUserRedemptions": {
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}, {Key: "userEmail", Value: 1}},
+			Options: options.Index().SetName("unique_promo_user").SetUnique(true),
+		},
+	},
+	"refunds": {
+		{
+			Keys:    bson.D{{Key: "refundId", Value: 1}},
+			Options: options.Index().SetName("unique_refund").SetUnique(true),
+		},
+	},
+	// One invoice per order and one organizer per id
+	"invoices": {
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}},
+			Options: options.Index().SetName("unique_order_invoice").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "organizerId", Value: 1}, {Key: "invoiceNumber", Value: 1}},
+			Options: options.Index().SetName("unique_invoice_number").SetUnique(true),
+		},
+	},
+	// An order's invoice is numbered by whoever claimed it first
+	"invoiceClaims": {
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}},
+			Options: options.Index().SetName("unique_invoice_claim").SetUnique(true),
+		},
+	},
+	"organizers": {
+		{
+			Keys:    bson.D{{Key: "organizerId", Value: 1}},
+			Options: options.Index().SetName("unique_organizer").SetUnique(true),
+		},
+	},
+	// A sale, refund or payout is booked once
+	"ledgerTransactions": {
+		{
+			Keys:    bson.D{{Key: "type", Value: 1}, {Key: "reference", Value: 1}},
+			Options: options.Index().SetName("unique_ledger_reference").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "organizerId", Value: 1}, {Key: "currency", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("organizer_statement"),
+		},
+	},
+	"payouts": {
+		{
+			Keys:    bson.D{{Key: "payoutId", Value: 1}},
+			Options: options.Index().SetName("unique_payout").SetUnique(true),
+		},
+	},
+	"exchangeRates": {
+		{
+			Keys:    bson.D{{Key: "currency", Value: 1}},
+			Options: options.Index().SetName("unique_exchange_rate").SetUnique(true),
+		},
+	},
+	"emailTemplates": {
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}, {Key: "locale", Value: 1}, {Key: "organizerId", Value: 1}},
+			Options: options.Index().SetName("unique_email_template").SetUnique(true),
+		},
+	},
+	// Notifications are queued once per dedupe key and claimed by due time
+	"notificationJobs": {
+		{
+			Keys:    bson.D{{Key: "jobId", Value: 1}},
+			Options: options.Index().SetName("unique_notification_job").SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "dedupeKey", Value: 1}},
+			Options: options.Index().
+				SetName("unique_notification_dedupe").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"dedupeKey": bson.M{"$exists": true}}),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+			Options: options.Index().SetName("notification_due"),
+		},
+		{
+			Keys:    bson.D{{Key: "payload.announcementId", Value: 1}},
+			Options: options.Index().SetName("notification_announcement"),
+		},
+	},
+	// Feed items are listed and counted per user, and added once per source
+	"inAppNotifications": {
+		{
+			Keys:    bson.D{{Key: "userEmail", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("feed_user_created"),
+		},
+		{
+			Keys:    bson.D{{Key: "userEmail", Value: 1}, {Key: "readAt", Value: 1}},
+			Options: options.Index().SetName("feed_user_unread"),
+		},
+		{
+			Keys: bson.D{{Key: "sourceId", Value: 1}},
+			Options: options.Index().
+				SetName("unique_feed_source").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"sourceId": bson.M{"$exists": true}}),
+		},
+	},
+	// Each reminder of an event date is dispatched once
+	"reminderDispatches": {
+		{
+			Keys:    bson.D{{Key: "eventId", Value: 1}, {Key: "eventDate", Value: 1}, {Key: "offset", Value: 1}},
+			Options: options.Index().SetName("unique_reminder_dispatch").SetUnique(true),
+		},
+	},
+	"webhooks": {
+		{
+			Keys:    bson.D{{Key: "webhookId", Value: 1}},
+			Options: options.Index().SetName("unique_webhook").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "active", Value: 1}, {Key: "events", Value: 1}},
+			Options: options.Index().SetName("webhook_active_events"),
+		},
+	},
+	"webhookDeliveries": {
+		{
+			Keys:    bson.D{{Key: "deliveryId", Value: 1}},
+			Options: options.Index().SetName("unique_webhook_delivery").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "webhookId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("delivery_webhook_created"),
+		},
+	},
+	// Calendar feeds are looked up by the secret in their URL
+	"userData": {
+		{
+			Keys: bson.D{{Key: "calendarToken", Value: 1}},
+			Options: options.Index().
+				SetName("unique_calendar_token").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"calendarToken": bson.M{"$exists": true}}),
+		},
+	},
+	"reconciliationReports": {
+		{
+			Keys:    bson.D{{Key: "startedAt", Value: -1}},
+			Options: options.Index().SetName("report_started"),
+		},
+	},
+}
+
+// ErrUniqueIndexMissing is reported by EnsureIndexes when a unique index
+// could not be created, so duplicates would no longer be rejected.
+var ErrUniqueIndexMissing = errors.New("unique index is missing")
+
+// EnsureIndexes creates the indexes in collectionIndexes. It is run once at
+// startup and is a no-op for indexes that already exist. Every index is
+// attempted; the failures are returned together, wrapped in
+// ErrUniqueIndexMissing for unique indexes.
+func EnsureIndexes() error {
+	var errs []error
+	for collectionName, indexes := range collectionIndexes {
+		db, col, err := ConnectMongo(collectionName)
+		if err != nil {
+			return fmt.Errorf("failed to connect to MongoDB: %w", err)
+		}
+
+		for _, index := range indexes {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			_, err := col.Indexes().CreateOne(ctx, index)
+			cancel()
+			if err == nil {
+				continue
+			}
+			name := ""
+			if index.Options != nil && index.Options.Name != nil {
+				name = *index.Options.Name
+			}
+			if index.Options != nil && index.Options.Unique != nil && *index.Options.Unique {
+				err = fmt.Errorf("%w: %v", ErrUniqueIndexMissing, err)
+			}
+			errs = append(errs, fmt.Errorf("failed to create index '%s' on '%s': %w", name, collectionName, err))
+		}
+		db.Client().Disconnect(context.TODO())
+	}
+	return errors.Join(errs...)
+}
@@ -9,6 +9,9 @@ import (
 	"time"
 
 	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	notifyutils "em_backend/library/notification"
+	webhookutils "em_backend/library/webhook"
 	dbModel "em_backend/models/db"
 	common_responses "em_backend/responses/common"
 
@@ -46,6 +49,46 @@ func CreateEvent(ctx *fiber.Ctx) error {
 		})
 	}
 
+	ticketTypes, err := eventutils.PrepareTicketTypes(payload.TicketTypes, payload.ComboPrices)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "400 Bad Request",
+		})
+	}
+
+	cancellationPolicy, err := eventutils.PrepareCancellationPolicy(payload.CancellationPolicy)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "400 Bad Request",
+		})
+	}
+
+	reminderOffsets, err := eventutils.PrepareReminderOffsets(payload.ReminderOffsets)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "400 Bad Request",
+		})
+	}
+
+	timeZone, err := eventutils.PrepareTimeZone(payload.TimeZone)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "400 Bad Request",
+		})
+	}
+
+	meetingLink, err := eventutils.PrepareMeetingLink(payload.MeetingLink)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "400 Bad Request",
+		})
+	}
+
 	// Generate unique IDs
 	eventID, _ := uuid.NewRandom()
 	formID, _ := uuid.NewRandom()
@@ -60,11 +103,16 @@ func CreateEvent(ctx *fiber.Ctx) error {
 		EventMode:                 payload.EventMode,
 		EventLocation:             payload.EventLocation,
 		EventDate:                 payload.EventDate,
+		TimeZone:                  timeZone,
+		MeetingLink:               meetingLink,
 		FlierImage:                payload.FlierImage,
 		PaymentType:               payload.PaymentType,
-		ComboPrices:               payload.ComboPrices,
 		ParticipationGuidelines:   payload.ParticipationGuidelines,
-		TicketCombos:              payload.TicketCombos,
+		TicketTypes:               ticketTypes,
+		CancellationPolicy:        cancellationPolicy,
+		OrganizerId:               payload.OrganizerId,
+		ReminderOffsets:           reminderOffsets,
+		RemindersDisabled:         payload.RemindersDisabled,
 		RegistrationDetailsFormId: formID.String(),
 		CreatedAt:                 time.Now().Unix(),
 		UpdatedAt:                 time.Now().Unix(),
@@ -163,6 +211,9 @@ func EditEvent(ctx *fiber.Ctx) error {
 		}))
 	}
 
+	// Keep the event as attendees know it to tell them what changed
+	before := existingEvent
+
 	// Update fields that are allowed to be modified
 	if requestData.EventName != "" {
 		existingEvent.EventName = requestData.EventName
@@ -185,6 +236,26 @@ func EditEvent(ctx *fiber.Ctx) error {
 	if requestData.EventDate > 0 {
 		existingEvent.EventDate = requestData.EventDate
 	}
+	if requestData.TimeZone != "" {
+		timeZone, err := eventutils.PrepareTimeZone(requestData.TimeZone)
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		existingEvent.TimeZone = timeZone
+	}
+	if requestData.MeetingLink != "" {
+		meetingLink, err := eventutils.PrepareMeetingLink(requestData.MeetingLink)
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		existingEvent.MeetingLink = meetingLink
+	}
 	if requestData.FlierImage != "" {
 		existingEvent.FlierImage = requestData.FlierImage
 	}
@@ -197,16 +268,67 @@ func EditEvent(ctx *fiber.Ctx) error {
 	if requestData.ParticipationGuidelines != "" {
 		existingEvent.ParticipationGuidelines = requestData.ParticipationGuidelines
 	}
+	if requestData.CancellationPolicy != nil {
+		cancellationPolicy, err := eventutils.PrepareCancellationPolicy(requestData.CancellationPolicy)
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		existingEvent.CancellationPolicy = cancellationPolicy
+	}
+	if requestData.OrganizerId != "" {
+		existingEvent.OrganizerId = requestData.OrganizerId
+	}
 	// if requestData.RegistrationLimit > 0 {
 	// 	existingEvent.RegistrationLimit = requestData.RegistrationLimit
 	// }
 
+	// Only write over the version that was read, so that seats sold or other
+	// changes made while the event was being edited are not overwritten
+	filter := bson.M{"uniqueId": eventID, "version": existingEvent.Version}
+	if existingEvent.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{nil, 0}}
+	}
+	ticketTypesEdited := len(requestData.TicketTypes) > 0
+	if ticketTypesEdited {
+		mergedTicketTypes, err := eventutils.MergeTicketTypes(existingEvent.TicketTypes, requestData.TicketTypes)
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		existingEvent.TicketTypes = mergedTicketTypes
+	}
+
+	// Material changes get a newer calendar invite
+	changes := notifyutils.EventChanges(before, existingEvent)
+	if len(changes) > 0 {
+		existingEvent.CalendarSequence++
+	}
+
 	// Update the updatedAt field
 	existingEvent.UpdatedAt = time.Now().Unix()
+	existingEvent.Version++
+
+	updateFields, err := commonutils.ToBsonMap(existingEvent)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to update event",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if !ticketTypesEdited {
+		delete(updateFields, "ticketTypes")
+	}
+	delete(updateFields, "registrationCount")
+	delete(updateFields, "announcements")
 
 	// Update the event in the database
-	_, err = col.UpdateOne(ctx.Context(), bson.M{"uniqueId": eventID}, bson.M{
-		"$set": existingEvent,
+	result, err := col.UpdateOne(ctx.Context(), filter, bson.M{
+		"$set": updateFields,
 	})
 	if err != nil {
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
@@ -214,6 +336,16 @@ func EditEvent(ctx *fiber.Ctx) error {
 			Status:  "500 Internal Server Error",
 		}))
 	}
+	if result.MatchedCount == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "The event changed while it was being edited, please retry",
+			Status:  "409 Conflict",
+		}))
+	}
+
+	// Tell registrants what changed
+	notifyutils.QueueEventUpdate(existingEvent, changes)
+	webhookutils.PublishEventUpdated(existingEvent, changes)
 
 	// Return success response
 	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
@@ -221,6 +353,7 @@ func EditEvent(ctx *fiber.Ctx) error {
 		Status:  "200 OK",
 		Data: fiber.Map{
 			"eventId": eventID,
+			"changes": changes,
 		},
 	}))
 }
@@ -282,6 +415,7 @@ func DeleteEvent(ctx *fiber.Ctx) error {
 			"status":    existingEvent.Status,
 			"updatedAt": existingEvent.UpdatedAt,
 		},
+		"$inc": bson.M{"version": 1},
 	})
 	if err != nil {
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
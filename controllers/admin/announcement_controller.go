@@ -0,0 +1,87 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	commonutils "em_backend/library/common"
+	notifyutils "em_backend/library/notification"
+	notificationModel "em_backend/models/notification"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SendAnnouncement messages the registrants of an event, or a segment of
+// them, by email and in their in-app feed.
+func SendAnnouncement(ctx *fiber.Ctx) error {
+	var requestData notificationModel.AnnouncementReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	announcement, err := notifyutils.SendAnnouncement(requestData, sessionUserData.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, notifyutils.ErrInvalidAnnouncement), errors.Is(err, notifyutils.ErrNoMatchingAttendees):
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		case errors.Is(err, notifyutils.ErrEventNotFound):
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Event not found",
+				Status:  "404 Not Found",
+			}))
+		}
+		log.Printf("Failed to send announcement: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to send announcement",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Announcement queued successfully",
+		Status:  "200 OK",
+		Data:    announcement,
+	}))
+}
+
+// GetAnnouncements lists the announcements sent for an event with how many
+// were delivered.
+func GetAnnouncements(ctx *fiber.Ctx) error {
+	var requestData notificationModel.AnnouncementListReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.EventId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	announcements, err := notifyutils.ListAnnouncements(requestData.EventId)
+	if err != nil {
+		if errors.Is(err, notifyutils.ErrEventNotFound) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Event not found",
+				Status:  "404 Not Found",
+			}))
+		}
+		log.Printf("Failed to list announcements: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching announcements",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Announcements fetched successfully",
+		Status:  "200 OK",
+		Data:    announcements,
+	}))
+}
@@ -0,0 +1,58 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	commonutils "em_backend/library/common"
+	currencyutils "em_backend/library/currency"
+	currencyModel "em_backend/models/currency"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetExchangeRates updates the rates used to show approximate prices in other
+// currencies. Rates are units of each currency per unit of the base currency.
+func SetExchangeRates(ctx *fiber.Ctx) error {
+	var requestData currencyModel.ExchangeRatesRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || len(requestData.Rates) == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Rates are required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	if err := currencyutils.SetExchangeRates(requestData.Rates, sessionUserData.Email); err != nil {
+		if errors.Is(err, currencyutils.ErrUnsupportedCurrency) || err == currencyutils.ErrInvalidExchangeRate {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		log.Printf("Failed to set exchange rates: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to set exchange rates",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	return GetExchangeRates(ctx)
+}
+
+func GetExchangeRates(ctx *fiber.Ctx) error {
+	rates, err := currencyutils.FetchExchangeRates()
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching exchange rates",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Exchange rates fetched successfully",
+		Status:  "200 OK",
+		Data:    rates,
+	}))
+}
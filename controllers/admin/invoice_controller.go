@@ -0,0 +1,209 @@
+package adminpanel
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	"encoding/json"
+	"time"
+
+	commonutils "em_backend/library/common"
+	invoiceutils "em_backend/library/invoice"
+	invoiceModel "em_backend/models/invoice"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateOrganizer(ctx *fiber.Ctx) error {
+	var organizer invoiceModel.Organizer
+	if err := json.Unmarshal(ctx.Body(), &organizer); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Validate the billing details
+	if err := invoiceutils.ValidateOrganizer(&organizer); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+	organizer.OrganizerId = uuid.New().String()
+	organizer.CreatedAt = time.Now().Unix()
+	organizer.UpdatedAt = organizer.CreatedAt
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("organizers")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	if _, err := col.InsertOne(ctx.Context(), organizer); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to create organizer",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Organizer created successfully",
+		Status:  "201 Created",
+		Data:    organizer,
+	}))
+}
+
+// EditOrganizer replaces the billing details of an organizer. Invoices
+// already issued keep the details they were issued with.
+func EditOrganizer(ctx *fiber.Ctx) error {
+	var organizer invoiceModel.Organizer
+	if err := json.Unmarshal(ctx.Body(), &organizer); err != nil || organizer.OrganizerId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Organizer ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	if err := invoiceutils.ValidateOrganizer(&organizer); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("organizers")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	updateFields, err := commonutils.ToBsonMap(organizer)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to update organizer",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	delete(updateFields, "organizerId")
+	delete(updateFields, "createdAt")
+	updateFields["updatedAt"] = time.Now().Unix()
+
+	result, err := col.UpdateOne(ctx.Context(), bson.M{"organizerId": organizer.OrganizerId}, bson.M{"$set": updateFields})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to update organizer",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if result.MatchedCount == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Organizer not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Organizer updated successfully",
+		Status:  "200 OK",
+		Data:    organizer,
+	}))
+}
+
+func GetOrganizers(ctx *fiber.Ctx) error {
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("organizers")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	cursor, err := col.Find(ctx.Context(), bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching organizers",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer cursor.Close(ctx.Context())
+
+	organizers := []invoiceModel.Organizer{}
+	if err := cursor.All(ctx.Context(), &organizers); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing organizers",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Organizers fetched successfully",
+		Status:  "200 OK",
+		Data:    organizers,
+	}))
+}
+
+func GetInvoices(ctx *fiber.Ctx) error {
+	var requestData invoiceModel.InvoiceListRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("invoices")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	filter := bson.M{}
+	if requestData.OrderId != "" {
+		filter["orderId"] = requestData.OrderId
+	}
+	if requestData.EventId != "" {
+		filter["eventId"] = requestData.EventId
+	}
+	if requestData.OrganizerId != "" {
+		filter["organizerId"] = requestData.OrganizerId
+	}
+	cursor, err := col.Find(ctx.Context(), filter, options.Find().SetSort(bson.M{"issuedAt": -1}))
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching invoices",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer cursor.Close(ctx.Context())
+
+	invoices := []invoiceModel.Invoice{}
+	if err := cursor.All(ctx.Context(), &invoices); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing invoices",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Invoices fetched successfully",
+		Status:  "200 OK",
+		Data:    invoices,
+	}))
+}
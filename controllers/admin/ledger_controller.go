@@ -0,0 +1,162 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	commonutils "em_backend/library/common"
+	currencyutils "em_backend/library/currency"
+	ledgerutils "em_backend/library/ledger"
+	ledgerModel "em_backend/models/ledger"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetLedgerBalances returns account balances over the whole ledger or the
+// transactions of one organizer or event.
+func GetLedgerBalances(ctx *fiber.Ctx) error {
+	var requestData ledgerModel.BalanceRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	filter := bson.M{}
+	if requestData.OrganizerId != "" {
+		filter["organizerId"] = requestData.OrganizerId
+	}
+	if requestData.EventId != "" {
+		filter["eventId"] = requestData.EventId
+	}
+	balances, err := ledgerutils.Balances(filter)
+	if err != nil {
+		log.Printf("Failed to compute ledger balances: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error computing balances",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Balances fetched successfully",
+		Status:  "200 OK",
+		Data:    balances,
+	}))
+}
+
+// CreatePayout records a transfer to an organizer made outside the service.
+func CreatePayout(ctx *fiber.Ctx) error {
+	var requestData ledgerModel.PayoutRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.OrganizerId == "" || requestData.Currency == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Organizer ID and currency are required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	currency, err := currencyutils.Normalise(requestData.Currency)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+	requestData.Currency = currency
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	payout, err := ledgerutils.RecordPayout(requestData, sessionUserData.Email)
+	if err != nil {
+		if err == ledgerutils.ErrPayoutInProgress {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "409 Conflict",
+			}))
+		}
+		if err == ledgerutils.ErrInvalidPayoutAmount || err == ledgerutils.ErrInsufficientBalance {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		log.Printf("Failed to record payout to %s: %v", requestData.OrganizerId, err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to record payout",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Payout recorded successfully",
+		Status:  "201 Created",
+		Data:    payout,
+	}))
+}
+
+// GetSettlementStatement returns an organizer's statement for a period, as
+// JSON or as a CSV download. The current month is used when no period is given.
+func GetSettlementStatement(ctx *fiber.Ctx) error {
+	var requestData ledgerModel.StatementRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.OrganizerId == "" || requestData.Currency == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Organizer ID and currency are required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	currency, err := currencyutils.Normalise(requestData.Currency)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+	requestData.Currency = currency
+
+	now := time.Now().UTC()
+	if requestData.From == 0 {
+		requestData.From = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	if requestData.To == 0 {
+		requestData.To = now.Unix()
+	}
+	if requestData.From > requestData.To {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "From must be before To",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	statement, err := ledgerutils.BuildStatement(requestData.OrganizerId, requestData.Currency, requestData.From, requestData.To)
+	if err != nil {
+		log.Printf("Failed to build statement of %s: %v", requestData.OrganizerId, err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error building statement",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	if requestData.Format == "csv" {
+		csv, err := ledgerutils.StatementCSV(statement)
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error rendering statement",
+				Status:  "500 Internal Server Error",
+			}))
+		}
+		fileName := fmt.Sprintf("statement-%s-%s-%s.csv", requestData.OrganizerId, requestData.Currency,
+			time.Unix(requestData.To, 0).UTC().Format("2006-01-02"))
+		ctx.Set(fiber.HeaderContentType, "text/csv")
+		ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+		return ctx.Send(csv)
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Statement fetched successfully",
+		Status:  "200 OK",
+		Data:    statement,
+	}))
+}
@@ -0,0 +1,162 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"log"
+
+	commonutils "em_backend/library/common"
+	mailutils "em_backend/library/mail"
+	mailModel "em_backend/models/mail"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetEmailTemplates lists the built-in templates and locales along with the
+// overrides saved for them.
+func GetEmailTemplates(ctx *fiber.Ctx) error {
+	var requestData mailModel.EmailTemplateListRequest
+	if len(ctx.Body()) != 0 {
+		if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Invalid request body",
+				Status:  "400 Bad Request",
+			}))
+		}
+	}
+
+	overrides, err := mailutils.ListTemplateOverrides(requestData.Name, requestData.OrganizerId)
+	if err != nil {
+		log.Printf("Failed to list email templates: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching email templates",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Email templates fetched successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"templates": mailutils.TemplateNames,
+			"locales":   mailutils.BuiltinLocales(),
+			"overrides": overrides,
+		},
+	}))
+}
+
+// SetEmailTemplate saves an override of a built-in template and returns it
+// rendered with sample data.
+func SetEmailTemplate(ctx *fiber.Ctx) error {
+	var requestData mailModel.EmailTemplate
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Invalid request body",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	override, preview, err := mailutils.SaveTemplateOverride(requestData, sessionUserData.Email)
+	if err != nil {
+		if mailutils.IsTemplateValidationError(err) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		log.Printf("Failed to save email template: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to save email template",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Email template saved successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"template": override,
+			"preview":  preview,
+		},
+	}))
+}
+
+// DeleteEmailTemplate removes an override so the built-in template, or a
+// less specific override, is used again.
+func DeleteEmailTemplate(ctx *fiber.Ctx) error {
+	var requestData mailModel.EmailTemplateKey
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.Name == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Template name is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	deleted, err := mailutils.DeleteTemplateOverride(requestData)
+	if err != nil {
+		if mailutils.IsTemplateValidationError(err) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		log.Printf("Failed to delete email template: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to delete email template",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if !deleted {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Email template override not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Email template override deleted successfully",
+		Status:  "200 OK",
+	}))
+}
+
+// PreviewEmailTemplate renders a template the way a recipient with the given
+// locale would get it for an organizer's event. The request data is merged
+// over the template's sample data.
+func PreviewEmailTemplate(ctx *fiber.Ctx) error {
+	var requestData mailModel.TemplatePreviewRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.Name == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Template name is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	if _, err := mailutils.NormaliseLocale(requestData.Locale); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	data := mailutils.SampleData(requestData.Name)
+	for key, value := range requestData.Data {
+		data[key] = value
+	}
+	rendered, err := mailutils.Render(requestData.Name, requestData.Locale, requestData.OrganizerId, data)
+	if err != nil {
+		status := "500 Internal Server Error"
+		if err == mailutils.ErrUnknownTemplate {
+			status = "404 Not Found"
+		}
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  status,
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Email template rendered successfully",
+		Status:  "200 OK",
+		Data:    rendered,
+	}))
+}
@@ -0,0 +1,72 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"log"
+
+	commonutils "em_backend/library/common"
+	notifyutils "em_backend/library/notification"
+	notificationModel "em_backend/models/notification"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetNotificationJobs lists queued, sent and dead-lettered notifications with
+// the errors of their failed attempts.
+func GetNotificationJobs(ctx *fiber.Ctx) error {
+	var requestData notificationModel.NotificationJobListRequest
+	if len(ctx.Body()) != 0 {
+		if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error parsing request data",
+				Status:  "400 Bad Request",
+			}))
+		}
+	}
+
+	jobs, err := notifyutils.ListJobs(requestData)
+	if err != nil {
+		log.Printf("Failed to list notification jobs: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching notification jobs",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Notification jobs fetched successfully",
+		Status:  "200 OK",
+		Data:    jobs,
+	}))
+}
+
+// ReplayNotificationJobs puts dead-lettered notifications back in the queue,
+// e.g. after fixing the mail configuration or a broken template.
+func ReplayNotificationJobs(ctx *fiber.Ctx) error {
+	var requestData notificationModel.ReplayJobsRequest
+	if len(ctx.Body()) != 0 {
+		if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error parsing request data",
+				Status:  "400 Bad Request",
+			}))
+		}
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	replayed, err := notifyutils.ReplayJobs(requestData, sessionUserData.Email)
+	if err != nil {
+		log.Printf("Failed to replay notification jobs: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to replay notification jobs",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Notification jobs replayed successfully",
+		Status:  "200 OK",
+		Data:    fiber.Map{"replayed": replayed},
+	}))
+}
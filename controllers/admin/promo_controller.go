@@ -0,0 +1,319 @@
+package adminpanel
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	"encoding/json"
+	"time"
+
+	commonutils "em_backend/library/common"
+	promoutils "em_backend/library/promo"
+	promoModel "em_backend/models/promo"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreatePromoCode(ctx *fiber.Ctx) error {
+	var promo promoModel.PromoCode
+	if err := json.Unmarshal(ctx.Body(), &promo); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Validate the promo code definition
+	if err := promoutils.ValidatePromoDefinition(&promo); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+	promo.UsedCount = 0
+	promo.CreatedBy = sessionUserData.Email
+	promo.CreatedAt = time.Now().Unix()
+	promo.UpdatedAt = promo.CreatedAt
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("promoCodes")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	// Promo codes are unique
+	count, err := col.CountDocuments(ctx.Context(), bson.M{"code": promo.Code})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error checking promo code",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if count > 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Promo code already exists",
+			Status:  "409 Conflict",
+		}))
+	}
+
+	if _, err := col.InsertOne(ctx.Context(), promo); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to create promo code",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Promo code created successfully",
+		Status:  "201 Created",
+		Data:    promo,
+	}))
+}
+
+func EditPromoCode(ctx *fiber.Ctx) error {
+	var requestData promoModel.PromoCode
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	existing, err := promoutils.FetchPromoCode(requestData.Code)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Promo code not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	// Usage counters and audit fields are not editable
+	requestData.Code = existing.Code
+	requestData.UsedCount = existing.UsedCount
+	requestData.CreatedBy = existing.CreatedBy
+	requestData.CreatedAt = existing.CreatedAt
+	requestData.UpdatedAt = time.Now().Unix()
+	if err := promoutils.ValidatePromoDefinition(&requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	updateFields, err := commonutils.ToBsonMap(requestData)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to update promo code",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	delete(updateFields, "usedCount")
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("promoCodes")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	if _, err := col.UpdateOne(ctx.Context(), bson.M{"code": existing.Code}, bson.M{"$set": updateFields}); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to update promo code",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Promo code updated successfully",
+		Status:  "200 OK",
+		Data:    requestData,
+	}))
+}
+
+func DeletePromoCode(ctx *fiber.Ctx) error {
+	var requestData promoModel.PromoCode
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.Code == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Promo code is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("promoCodes")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	// Promo codes are deactivated rather than removed so redemptions keep their reference
+	code := promoutils.NormaliseCode(requestData.Code)
+	result, err := col.UpdateOne(ctx.Context(), bson.M{"code": code}, bson.M{
+		"$set": bson.M{
+			"status":    promoutils.StatusInactive,
+			"updatedAt": time.Now().Unix(),
+		},
+	})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to deactivate promo code",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if result.MatchedCount == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Promo code not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Promo code deactivated successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"code": code,
+		},
+	}))
+}
+
+func GetPromoCodes(ctx *fiber.Ctx) error {
+	var requestData promoModel.PromoReportReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("promoCodes")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	filter := bson.M{}
+	if requestData.EventId != "" {
+		filter["eventId"] = bson.M{"$in": bson.A{requestData.EventId, ""}}
+	}
+	cursor, err := col.Find(ctx.Context(), filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching promo codes",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer cursor.Close(ctx.Context())
+
+	promos := []promoModel.PromoCode{}
+	if err := cursor.All(ctx.Context(), &promos); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing promo codes",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Promo codes fetched successfully",
+		Status:  "200 OK",
+		Data:    promos,
+	}))
+}
+
+// GetPromoRedemptions reports promo code usage, summarised per code along with
+// the individual redemptions.
+func GetPromoRedemptions(ctx *fiber.Ctx) error {
+	var requestData promoModel.PromoReportReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("promoRedemptions")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	filter := bson.M{}
+	if requestData.Code != "" {
+		filter["code"] = promoutils.NormaliseCode(requestData.Code)
+	}
+	if requestData.EventId != "" {
+		filter["eventId"] = requestData.EventId
+	}
+
+	summaryCursor, err := col.Aggregate(ctx.Context(), mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           "$code",
+			"redemptions":   bson.M{"$sum": 1},
+			"totalDiscount": bson.M{"$sum": "$discountAmount"},
+			"totalSubtotal": bson.M{"$sum": "$subtotal"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"redemptions": -1}}},
+	})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error summarising redemptions",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	summary := []promoModel.PromoCodeSummary{}
+	if err := summaryCursor.All(ctx.Context(), &summary); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing redemptions",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	cursor, err := col.Find(ctx.Context(), filter, options.Find().SetSort(bson.M{"redeemedAt": -1}))
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching redemptions",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer cursor.Close(ctx.Context())
+
+	redemptions := []promoModel.PromoRedemption{}
+	if err := cursor.All(ctx.Context(), &redemptions); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing redemptions",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Promo redemptions fetched successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"summary":     summary,
+			"redemptions": redemptions,
+		},
+	}))
+}
@@ -0,0 +1,110 @@
+package adminpanel
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	"encoding/json"
+	"log"
+	"time"
+
+	commonutils "em_backend/library/common"
+	paymentutils "em_backend/library/payment"
+	paymentModel "em_backend/models/payment"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reconcile compares provider payments with our records for a date range,
+// confirms captures we missed and returns the report of mismatches.
+func Reconcile(ctx *fiber.Ctx) error {
+	var requestData paymentModel.ReconcileRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	// Default to the last day
+	if requestData.To == 0 {
+		requestData.To = time.Now().Unix()
+	}
+	if requestData.From == 0 {
+		requestData.From = requestData.To - int64((24 * time.Hour).Seconds())
+	}
+	if requestData.From >= requestData.To {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "From must be before To",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	report, err := paymentutils.Reconcile(requestData.Provider, requestData.From, requestData.To, requestData.DryRun, sessionUserData.Email)
+	if err != nil {
+		log.Printf("Reconciliation failed: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Reconciliation completed",
+		Status:  "200 OK",
+		Data:    report,
+	}))
+}
+
+func GetReconciliationReports(ctx *fiber.Ctx) error {
+	var requestData paymentModel.ReconciliationReportListRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("reconciliationReports")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	filter := bson.M{}
+	if requestData.ReportId != "" {
+		filter["reportId"] = requestData.ReportId
+	}
+	if requestData.Provider != "" {
+		filter["provider"] = requestData.Provider
+	}
+	cursor, err := col.Find(ctx.Context(), filter, options.Find().SetSort(bson.M{"startedAt": -1}).SetLimit(50))
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching reconciliation reports",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer cursor.Close(ctx.Context())
+
+	reports := []paymentModel.ReconciliationReport{}
+	if err := cursor.All(ctx.Context(), &reports); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing reconciliation reports",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Reconciliation reports fetched successfully",
+		Status:  "200 OK",
+		Data:    reports,
+	}))
+}
@@ -0,0 +1,275 @@
+package adminpanel
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	"encoding/json"
+	"log"
+	"time"
+
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	notifyutils "em_backend/library/notification"
+	paymentutils "em_backend/library/payment"
+	dbModel "em_backend/models/db"
+	paymentModel "em_backend/models/payment"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RefundOrder refunds all or part of a paid order and cancels the given
+// registrations of the order.
+func RefundOrder(ctx *fiber.Ctx) error {
+	var requestData paymentModel.RefundRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.OrderId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Order ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	order, err := paymentutils.FetchOrder(requestData.OrderId)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Order not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	// Only registrations paid for by this order can be cancelled with it
+	if len(requestData.RegistrationIds) > 0 {
+		db, col, err := mongoSetup.ConnectMongo("registrations")
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error connecting to MongoDB",
+				Status:  "500 Internal Server Error",
+			}))
+		}
+		defer db.Client().Disconnect(context.TODO())
+
+		count, err := col.CountDocuments(ctx.Context(), bson.M{"$and": bson.A{
+			paymentutils.OrderRegistrationsFilter(order),
+			bson.M{"registrationid": bson.M{"$in": requestData.RegistrationIds}},
+		}})
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error fetching registrations",
+				Status:  "500 Internal Server Error",
+			}))
+		}
+		if count != int64(len(requestData.RegistrationIds)) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Registrations do not belong to the order",
+				Status:  "400 Bad Request",
+			}))
+		}
+	}
+
+	// Refund everything that is left when no amount is given
+	amount := requestData.Amount
+	if amount == 0 {
+		amount, err = paymentutils.RefundableAmount(order)
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error computing refundable amount",
+				Status:  "500 Internal Server Error",
+			}))
+		}
+	}
+
+	refund, err := paymentutils.IssueRefund(order, amount, requestData.RegistrationIds, requestData.Reason, sessionUserData.Email)
+	if err != nil {
+		log.Printf("Failed to refund order %s: %v", order.OrderID, err)
+		status := "500 Internal Server Error"
+		switch err {
+		case paymentutils.ErrOrderNotRefundable, paymentutils.ErrInvalidRefundAmount, paymentutils.ErrRefundExceedsPayment:
+			status = "400 Bad Request"
+		}
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  status,
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Refund issued successfully",
+		Status:  "200 OK",
+		Data:    refund,
+	}))
+}
+
+func GetRefunds(ctx *fiber.Ctx) error {
+	var requestData paymentModel.RefundListRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("refunds")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	filter := bson.M{}
+	if requestData.OrderId != "" {
+		filter["orderId"] = requestData.OrderId
+	}
+	if requestData.EventId != "" {
+		filter["eventId"] = requestData.EventId
+	}
+	if requestData.Status != "" {
+		filter["status"] = requestData.Status
+	}
+	cursor, err := col.Find(ctx.Context(), filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching refunds",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer cursor.Close(ctx.Context())
+
+	refunds := []paymentModel.Refund{}
+	if err := cursor.All(ctx.Context(), &refunds); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing refunds",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Refunds fetched successfully",
+		Status:  "200 OK",
+		Data:    refunds,
+	}))
+}
+
+// CancelEvent cancels an event, refunds every paid order in full, closes all
+// of its registrations and tells their holders. It can be called again to
+// retry refunds that failed.
+func CancelEvent(ctx *fiber.Ctx) error {
+	var requestData dbModel.CancelEventReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.UniqueId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	// Connect to MongoDB
+	db, col, err := mongoSetup.ConnectMongo("events")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	// Stop new registrations and payments first
+	result, err := col.UpdateOne(ctx.Context(), bson.M{"uniqueId": requestData.UniqueId}, bson.M{
+		"$set": bson.M{
+			"status":    eventutils.EventStatusCancelled,
+			"updatedAt": time.Now().Unix(),
+		},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to cancel event",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if result.MatchedCount == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	// Refund every paid order of the event
+	cursor, err := db.Collection("orderDetails").Find(ctx.Context(), bson.M{
+		"eventId": requestData.UniqueId,
+		"status":  paymentutils.OrderStatusPaid,
+	})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching orders",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	var orders []paymentModel.OrderDetails
+	if err := cursor.All(ctx.Context(), &orders); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing orders",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	reason := requestData.Reason
+	if reason == "" {
+		reason = "Event cancelled"
+	}
+	refunds := []paymentModel.Refund{}
+	failedOrderIds := []string{}
+	for _, order := range orders {
+		amount, err := paymentutils.RefundableAmount(order)
+		if err == nil && amount == 0 {
+			continue
+		}
+		if err == nil {
+			var refund paymentModel.Refund
+			refund, err = paymentutils.IssueRefund(order, amount, nil, reason, sessionUserData.Email)
+			if err == nil {
+				refunds = append(refunds, refund)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to refund order %s of cancelled event %s: %v", order.OrderID, requestData.UniqueId, err)
+			failedOrderIds = append(failedOrderIds, order.OrderID)
+			continue
+		}
+		closed, err := eventutils.CloseRegistrations(paymentutils.OrderRegistrationsFilter(order), eventutils.RegistrationStatusRefunded)
+		if err != nil {
+			log.Printf("Failed to close registrations of order %s: %v", order.OrderID, err)
+		}
+		notifyutils.QueueEventCancellation(requestData.UniqueId, closed, requestData.Reason, amount, order.Currency)
+	}
+
+	// Free and unpaid registrations are simply cancelled; paid ones whose
+	// refund failed stay open until the refund is retried
+	cancelled, err := eventutils.CloseRegistrations(bson.M{
+		"uniqueId": requestData.UniqueId,
+		"orderId":  bson.M{"$nin": failedOrderIds},
+	}, eventutils.RegistrationStatusCancelled)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to cancel registrations",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	notifyutils.QueueEventCancellation(requestData.UniqueId, cancelled, requestData.Reason, 0, "")
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Event cancelled successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"eventId":                requestData.UniqueId,
+			"refunds":                refunds,
+			"failedOrderIds":         failedOrderIds,
+			"cancelledRegistrations": len(cancelled),
+		},
+	}))
+}
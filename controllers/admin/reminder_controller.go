@@ -0,0 +1,87 @@
+package adminpanel
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	dbModel "em_backend/models/db"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetEventReminders changes when registrants of an event are reminded, or
+// turns its reminders off. Reminders already sent are not repeated.
+func SetEventReminders(ctx *fiber.Ctx) error {
+	var requestData dbModel.EventRemindersReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+	if requestData.UniqueId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	reminderOffsets, err := eventutils.PrepareReminderOffsets(requestData.ReminderOffsets)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("events")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	result, err := col.UpdateOne(ctx.Context(), bson.M{"uniqueId": requestData.UniqueId}, bson.M{
+		"$set": bson.M{
+			"reminderOffsets":   reminderOffsets,
+			"remindersDisabled": requestData.RemindersDisabled,
+			"updatedAt":         time.Now().Unix(),
+		},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to update event reminders",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if result.MatchedCount == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	// Show the reminders that now apply, including the platform default
+	effective := reminderOffsets
+	if len(effective) == 0 {
+		effective = eventutils.DefaultReminderOffsets()
+	}
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Event reminders updated successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"eventId":           requestData.UniqueId,
+			"reminderOffsets":   effective,
+			"remindersDisabled": requestData.RemindersDisabled,
+		},
+	}))
+}
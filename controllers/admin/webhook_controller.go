@@ -0,0 +1,177 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	commonutils "em_backend/library/common"
+	webhookutils "em_backend/library/webhook"
+	webhookModel "em_backend/models/webhook"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// webhookFailure maps webhook errors to failure responses.
+func webhookFailure(ctx *fiber.Ctx, err error, action string) error {
+	switch {
+	case errors.Is(err, webhookutils.ErrInvalidWebhook):
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	case errors.Is(err, webhookutils.ErrWebhookNotFound):
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Webhook not found",
+			Status:  "404 Not Found",
+		}))
+	case errors.Is(err, webhookutils.ErrDeliveryNotFound):
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Webhook delivery not found",
+			Status:  "404 Not Found",
+		}))
+	}
+	log.Printf("Failed to %s: %v", action, err)
+	return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+		Message: "Failed to " + action,
+		Status:  "500 Internal Server Error",
+	}))
+}
+
+// AddWebhook registers a webhook for an organizer or an event. The signing
+// secret is only returned here.
+func AddWebhook(ctx *fiber.Ctx) error {
+	var requestData webhookModel.WebhookReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	webhook, err := webhookutils.CreateWebhook(requestData, sessionUserData.Email)
+	if err != nil {
+		return webhookFailure(ctx, err, "add webhook")
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Webhook added successfully",
+		Status:  "200 OK",
+		Data:    webhook,
+	}))
+}
+
+// EditWebhook changes the URL, events, description or active flag of a
+// webhook.
+func EditWebhook(ctx *fiber.Ctx) error {
+	var requestData webhookModel.WebhookReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.WebhookId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Webhook ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	webhook, err := webhookutils.UpdateWebhook(requestData)
+	if err != nil {
+		return webhookFailure(ctx, err, "update webhook")
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Webhook updated successfully",
+		Status:  "200 OK",
+		Data:    webhook,
+	}))
+}
+
+func DeleteWebhook(ctx *fiber.Ctx) error {
+	var requestData webhookModel.WebhookIdReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.WebhookId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Webhook ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	if err := webhookutils.DeleteWebhook(requestData.WebhookId); err != nil {
+		return webhookFailure(ctx, err, "delete webhook")
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Webhook deleted successfully",
+		Status:  "200 OK",
+	}))
+}
+
+// GetWebhooks lists the webhooks of an organizer or event, or all of them.
+func GetWebhooks(ctx *fiber.Ctx) error {
+	var requestData webhookModel.WebhookListReq
+	if len(ctx.Body()) > 0 {
+		if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error parsing request data",
+				Status:  "400 Bad Request",
+			}))
+		}
+	}
+
+	webhooks, err := webhookutils.ListWebhooks(requestData)
+	if err != nil {
+		return webhookFailure(ctx, err, "fetch webhooks")
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Webhooks fetched successfully",
+		Status:  "200 OK",
+		Data:    webhooks,
+	}))
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook with every
+// attempt's response.
+func GetWebhookDeliveries(ctx *fiber.Ctx) error {
+	var requestData webhookModel.DeliveryListReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.WebhookId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Webhook ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	deliveries, err := webhookutils.ListDeliveries(requestData)
+	if err != nil {
+		return webhookFailure(ctx, err, "fetch webhook deliveries")
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Webhook deliveries fetched successfully",
+		Status:  "200 OK",
+		Data:    deliveries,
+	}))
+}
+
+// RedeliverWebhook sends a past delivery again, with the same message ID so
+// receivers can tell it apart from a new event.
+func RedeliverWebhook(ctx *fiber.Ctx) error {
+	var requestData webhookModel.RedeliverReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.DeliveryId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Delivery ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	delivery, err := webhookutils.Redeliver(requestData.DeliveryId, sessionUserData.Email)
+	if err != nil {
+		return webhookFailure(ctx, err, "redeliver webhook")
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Webhook redelivery queued successfully",
+		Status:  "200 OK",
+		Data:    delivery,
+	}))
+}
@@ -0,0 +1,126 @@
+package eventPanel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	dbModel "em_backend/models/db"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withholdMeetingLink clears the link to join an event online unless the
+// user is an admin or holds a confirmed ticket for it.
+func withholdMeetingLink(event *dbModel.Event, sessionUserData common_responses.LoginDetails) {
+	if event.MeetingLink == "" || sessionUserData.IsAdmin {
+		return
+	}
+	registered, err := eventutils.IsRegistered(event.UniqueId, sessionUserData.Email)
+	if err != nil {
+		log.Printf("Failed to check registration for event %s: %v", event.UniqueId, err)
+	}
+	if !registered {
+		event.MeetingLink = ""
+	}
+}
+
+// DownloadEventCalendar returns an event as an .ics file to add it to a
+// calendar.
+func DownloadEventCalendar(ctx *fiber.Ctx) error {
+	var requestData dbModel.Event
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.UniqueId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, ok := ctx.Locals("userData").(common_responses.LoginDetails)
+	if !ok {
+		return ctx.JSON(commonutils.CreateFailureResponse(nil))
+	}
+
+	event, err := eventutils.FetchEvent(requestData.UniqueId)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Event not found",
+				Status:  "404 Not Found",
+			}))
+		}
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching event",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	withholdMeetingLink(&event, sessionUserData)
+
+	ctx.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("event-%s.ics", event.UniqueId)))
+	return ctx.Send(eventutils.EventCalendar(event, eventutils.CalendarMethodPublish))
+}
+
+// GetCalendarFeed returns the secret URL of the session user's calendar
+// feed, with every event they are registered for.
+func GetCalendarFeed(ctx *fiber.Ctx) error {
+	return calendarFeedResponse(ctx, false)
+}
+
+// ResetCalendarFeed replaces the URL of the session user's calendar feed,
+// for when it was shared by mistake.
+func ResetCalendarFeed(ctx *fiber.Ctx) error {
+	return calendarFeedResponse(ctx, true)
+}
+
+func calendarFeedResponse(ctx *fiber.Ctx, reset bool) error {
+	sessionUserData, ok := ctx.Locals("userData").(common_responses.LoginDetails)
+	if !ok {
+		return ctx.JSON(commonutils.CreateFailureResponse(nil))
+	}
+
+	token, err := eventutils.CalendarFeedToken(sessionUserData.Email, reset)
+	if err != nil {
+		log.Printf("Failed to fetch calendar feed of %s: %v", sessionUserData.Email, err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching calendar feed",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	feedURL := eventutils.CalendarFeedURL(ctx.BaseURL(), token)
+	webcalURL := feedURL
+	if index := strings.Index(feedURL, "://"); index >= 0 {
+		webcalURL = "webcal" + feedURL[index:]
+	}
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Calendar feed fetched successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"url":       feedURL,
+			"webcalUrl": webcalURL,
+		},
+	}))
+}
+
+// CalendarFeed serves a user's calendar feed to calendar apps, which
+// authenticate with the secret in its URL instead of a session.
+func CalendarFeed(ctx *fiber.Ctx) error {
+	calendar, err := eventutils.RegisteredEventsCalendar(ctx.Params("token"))
+	if err != nil {
+		if errors.Is(err, eventutils.ErrCalendarFeedNotFound) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+		log.Printf("Failed to render calendar feed: %v", err)
+		return ctx.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	ctx.Set(fiber.HeaderCacheControl, "private, max-age=900")
+	return ctx.Send(calendar)
+}
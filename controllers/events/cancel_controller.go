@@ -0,0 +1,126 @@
+package eventPanel
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	paymentutils "em_backend/library/payment"
+	dbModel "em_backend/models/db"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CancelRegistration cancels one of the user's registrations before the event.
+// Paid tickets are refunded according to the event's cancellation policy.
+func CancelRegistration(ctx *fiber.Ctx) error {
+	var requestData dbModel.CancelRegistrationReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.RegistrationId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Registration ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	// Only the buyer can cancel a registration
+	registration, err := paymentutils.FetchRegistration(requestData.RegistrationId)
+	if err != nil || registration.PrimaryEmailId != sessionUserData.Email {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Registration not found",
+			Status:  "404 Not Found",
+		}))
+	}
+	if registration.Status != eventutils.RegistrationStatusConfirmed && registration.Status != eventutils.RegistrationStatusPendingPayment {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Registration is already " + registration.Status,
+			Status:  "409 Conflict",
+		}))
+	}
+
+	event, err := eventutils.FetchEvent(registration.UniqueId)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event not found",
+			Status:  "404 Not Found",
+		}))
+	}
+	now := time.Now().Unix()
+	if now >= event.EventDate {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Registrations cannot be cancelled after the event has started",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Refund the registration's share of its order as the policy allows
+	var refundAmount int64
+	if registration.Status == eventutils.RegistrationStatusConfirmed && registration.OrderId != "" {
+		order, err := paymentutils.FetchOrder(registration.OrderId)
+		if err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Order not found",
+				Status:  "404 Not Found",
+			}))
+		}
+		ticketCount := int64(order.TicketCount)
+		if ticketCount < 1 {
+			ticketCount = 1
+		}
+		percent := eventutils.RefundPercent(event.CancellationPolicy, event.EventDate, now)
+		refundAmount = order.Amount / ticketCount * int64(percent) / 100
+
+		if refundAmount > 0 {
+			refundable, err := paymentutils.RefundableAmount(order)
+			if err != nil {
+				return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+					Message: "Error computing refundable amount",
+					Status:  "500 Internal Server Error",
+				}))
+			}
+			if refundAmount > refundable {
+				refundAmount = refundable
+			}
+		}
+		if refundAmount > 0 {
+			refund, err := paymentutils.IssueRefund(order, refundAmount, []string{registration.RegistrationId}, "Cancelled by attendee", sessionUserData.Email)
+			if err != nil {
+				log.Printf("Failed to refund registration %s: %v", registration.RegistrationId, err)
+				return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+					Message: "Failed to refund registration",
+					Status:  "500 Internal Server Error",
+				}))
+			}
+			return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+				Message: "Registration cancelled and refund issued",
+				Status:  "200 OK",
+				Data: fiber.Map{
+					"registrationId": registration.RegistrationId,
+					"status":         eventutils.RegistrationStatusRefunded,
+					"refund":         refund,
+				},
+			}))
+		}
+	}
+
+	// Nothing to refund; just release the seat
+	if _, err := eventutils.CloseRegistrations(bson.M{"registrationid": registration.RegistrationId}, eventutils.RegistrationStatusCancelled); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to cancel registration",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Registration cancelled",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"registrationId": registration.RegistrationId,
+			"status":         eventutils.RegistrationStatusCancelled,
+		},
+	}))
+}
@@ -4,17 +4,19 @@ import (
 	"context"
 	mongoSetup "em_backend/configs/mongo"
 	commonutils "em_backend/library/common"
+	currencyutils "em_backend/library/currency"
+	eventutils "em_backend/library/events"
+	notifyutils "em_backend/library/notification"
+	webhookutils "em_backend/library/webhook"
 	dbModel "em_backend/models/db"
 	common_responses "em_backend/responses/common"
 	event_response "em_backend/responses/event"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/skip2/go-qrcode"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -33,9 +35,16 @@ func GetAllEvents(ctx *fiber.Ctx) error {
 
 	// Define filter to fetch only active events
 	filter := bson.M{"status": "active"}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	// Meeting links are only shown to registrants, in GetEventByID
+	findOptions := options.Find()
+	if !sessionUserData.IsAdmin {
+		findOptions.SetProjection(bson.M{"meetingLink": 0})
+	}
 
 	// Fetch events from the collection
-	cursor, err := col.Find(ctx.Context(), filter, options.Find())
+	cursor, err := col.Find(ctx.Context(), filter, findOptions)
 	if err != nil {
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
 			Message: "Error fetching events",
@@ -52,6 +61,13 @@ func GetAllEvents(ctx *fiber.Ctx) error {
 		}))
 	}
 	fmt.Println("==eve", events)
+	converter, displayCurrency := displayCurrencyConverter(ctx)
+	for i := range events {
+		events[i].TicketTypes = eventutils.VisibleTicketTypes(events[i].TicketTypes, sessionUserData.IsAdmin)
+		if converter != nil {
+			eventutils.ApplyDisplayCurrency(events[i].TicketTypes, displayCurrency, converter)
+		}
+	}
 	// Return the events as a success response
 	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
 		Message: "Events fetched successfully",
@@ -60,6 +76,26 @@ func GetAllEvents(ctx *fiber.Ctx) error {
 	}))
 }
 
+// displayCurrencyConverter returns a converter when the request asks for
+// prices in a display currency. Display prices are best effort, so a missing
+// rate table only leaves them out.
+func displayCurrencyConverter(ctx *fiber.Ctx) (*currencyutils.Converter, string) {
+	var requestData dbModel.DisplayCurrencyReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.DisplayCurrency == "" {
+		return nil, ""
+	}
+	currency, err := currencyutils.Normalise(requestData.DisplayCurrency)
+	if err != nil {
+		return nil, ""
+	}
+	converter, err := currencyutils.NewConverter()
+	if err != nil {
+		fmt.Println("Error loading exchange rates:", err)
+		return nil, ""
+	}
+	return converter, currency
+}
+
 func GetEventByID(ctx *fiber.Ctx) error {
 	// Parse request body
 	var requestData dbModel.Event
@@ -125,6 +161,11 @@ func GetEventByID(ctx *fiber.Ctx) error {
 	if decodeErr := registerEvent.Decode(&registerInfo); decodeErr != nil {
 		fmt.Println("Error decoding event data", decodeErr)
 	}
+	event.TicketTypes = eventutils.VisibleTicketTypes(event.TicketTypes, sessionUserData.IsAdmin)
+	withholdMeetingLink(&event, sessionUserData)
+	if converter, displayCurrency := displayCurrencyConverter(ctx); converter != nil {
+		eventutils.ApplyDisplayCurrency(event.TicketTypes, displayCurrency, converter)
+	}
 	var response event_response.GetEventByIdResp
 	response.Event = event
 	response.IsEmailRegistered = isRegistered
@@ -247,20 +288,77 @@ func RegisterEvent(ctx *fiber.Ctx) error {
 		}))
 	}
 
-	// Generate a unique registration ID
-	registrationID := uuid.New().String()
+	// Fetch the event to resolve the selected ticket type
+	event, err := eventutils.FetchEvent(requestData.UniqueId)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event not found",
+			Status:  "404 Not Found",
+		}))
+	}
+	if event.Status == eventutils.EventStatusCancelled {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: eventutils.ErrEventCancelled.Error(),
+			Status:  "409 Conflict",
+		}))
+	}
 
-	// Generate QR code based on the registration ID
-	qrCodeBytes, err := qrcode.Encode(registrationID, qrcode.Medium, 256)
+	ticketType, err := eventutils.SelectTicketType(event, requestData.TicketTypeId)
 	if err != nil {
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
-			Message: "Failed to generate QR code",
-			Status:  "500 Internal Server Error",
+			Message: err.Error(),
+			Status:  "400 Bad Request",
 		}))
 	}
 
-	// Encode the QR code as Base64
-	qrCodeBase64 := base64.StdEncoding.EncodeToString(qrCodeBytes)
+	// Reserve a seat of the selected ticket type
+	if ticketType != nil {
+		if err := eventutils.CheckTicketAvailability(*ticketType, 1, time.Now().Unix()); err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "409 Conflict",
+			}))
+		}
+		if err := eventutils.ReserveTickets(event.UniqueId, *ticketType, 1); err != nil {
+			if err == eventutils.ErrTicketSoldOut {
+				return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+					Message: err.Error(),
+					Status:  "409 Conflict",
+				}))
+			}
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Failed to reserve ticket",
+				Status:  "500 Internal Server Error",
+			}))
+		}
+	}
+	releaseSeat := func() {
+		if ticketType != nil {
+			if err := eventutils.ReleaseTickets(event.UniqueId, ticketType.TicketTypeId, 1); err != nil {
+				fmt.Println("Error releasing ticket:", err)
+			}
+		}
+	}
+
+	// Generate a unique registration ID
+	registrationID := uuid.New().String()
+
+	// Paid tickets wait for payment; the QR code is only issued once confirmed
+	status := eventutils.RegistrationStatusConfirmed
+	qrCodeBase64 := ""
+	if eventutils.IsPaidTicket(ticketType) {
+		status = eventutils.RegistrationStatusPendingPayment
+	} else {
+		// Generate a base64 QR code based on the registration ID
+		qrCodeBase64, err = eventutils.GenerateTicketQR(registrationID)
+		if err != nil {
+			releaseSeat()
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Failed to generate QR code",
+				Status:  "500 Internal Server Error",
+			}))
+		}
+	}
 
 	// Add metadata fields to registration data
 	registeredAt := time.Now().Unix()
@@ -275,11 +373,25 @@ func RegisterEvent(ctx *fiber.Ctx) error {
 		RegisteredAt:                 registeredAt,
 		IsTicketVerified:             false,
 		TicketVerificationStatusTeam: []string{}, // Empty list for now
+		Status:                       status,
+		IsActive:                     true,
+	}
+	if status == eventutils.RegistrationStatusConfirmed {
+		registrationData.ConfirmedAt = registeredAt
+	} else {
+		registrationData.HoldExpiresAt = time.Now().Add(eventutils.SeatHoldDuration()).Unix()
+	}
+	if ticketType != nil {
+		registrationData.TicketTypeId = ticketType.TicketTypeId
+		registrationData.TicketTypeName = ticketType.Name
+		registrationData.TicketPrice = ticketType.Price
+		registrationData.Currency = ticketType.Currency
 	}
 
 	// Save the data as-is into the registrations collection
 	_, registrationsCol, err := mongoSetup.ConnectMongo("registrations")
 	if err != nil {
+		releaseSeat()
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
 			Message: "Error connecting to Registrations collection",
 			Status:  "500 Internal Server Error",
@@ -290,15 +402,32 @@ func RegisterEvent(ctx *fiber.Ctx) error {
 	// Insert registration data into the collection
 	_, err = registrationsCol.InsertOne(ctx.Context(), registrationData)
 	if err != nil {
+		releaseSeat()
+		if mongo.IsDuplicateKeyError(err) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "You are already registered for this event",
+				Status:  "409 Conflict",
+			}))
+		}
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
 			Message: "Failed to register for the event",
 			Status:  "500 Internal Server Error",
 		}))
 	}
 
+	webhookutils.PublishRegistrationCreated(registrationData)
+
+	message := "Event registered successfully"
+	if status == eventutils.RegistrationStatusPendingPayment {
+		message = "Registration pending payment"
+	} else {
+		// Paid registrations are emailed once their payment is confirmed
+		notifyutils.QueueRegistrationConfirmations([]string{registrationID})
+	}
+
 	// Return success response with registration ID and QR code
 	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
-		Message: "Event registered successfully",
+		Message: message,
 		Status:  "200 OK",
 		Data: fiber.Map{
 			"eventId":        requestData.UniqueId,
@@ -306,6 +435,10 @@ func RegisterEvent(ctx *fiber.Ctx) error {
 			"qrCode":         qrCodeBase64, // Base64 string for QR code
 			"registeredAt":   registeredAt,
 			"ticketVerified": false, // Return default value
+			"ticketTypeId":   registrationData.TicketTypeId,
+			"ticketTypeName": registrationData.TicketTypeName,
+			"status":         status,
+			"holdExpiresAt":  registrationData.HoldExpiresAt,
 		},
 	}))
 }
@@ -423,9 +556,14 @@ func GetTicketQR(ctx *fiber.Ctx) error {
 	defer registrationsCol.Database().Client().Disconnect(context.TODO())
 	// Find event data by registrationId and primaryEmailId
 	var result map[string]interface{}
-	err = registrationsCol.FindOne(ctx.Context(), map[string]interface{}{
-		"eventId":        registrationId,
-		"primaryEmailId": primaryEmailId,
+	// A user's ticket is either their own registration or a group ticket assigned to them
+	err = registrationsCol.FindOne(ctx.Context(), bson.M{
+		"uniqueId": registrationId,
+		"isActive": true,
+		"$or": bson.A{
+			bson.M{"primaryemailid": primaryEmailId, "groupOrderId": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"attendeeEmail": primaryEmailId},
+		},
 	}).Decode(&result)
 
 	if err != nil {
@@ -435,15 +573,32 @@ func GetTicketQR(ctx *fiber.Ctx) error {
 		})
 	}
 
+	// Tickets of paid registrations are only available once payment is confirmed
+	if result["status"] == eventutils.RegistrationStatusPendingPayment {
+		return ctx.Status(402).JSON(fiber.Map{
+			"status":  "402 Payment Required",
+			"message": "Payment pending for this ticket",
+		})
+	}
+	if status, _ := result["status"].(string); status != "" && status != eventutils.RegistrationStatusConfirmed {
+		return ctx.Status(404).JSON(fiber.Map{
+			"status":  "404 Not Found",
+			"message": "Ticket not found",
+		})
+	}
+
 	// Return the event details (including the QR code URL)
 	return ctx.JSON(fiber.Map{
 		"status":  "200 OK",
 		"message": "Ticket retrieved successfully",
 		"data": map[string]interface{}{
-			"eventName":  result["eventName"],
-			"eventDate":  result["eventDate"],
-			"eventVenue": result["eventVenue"],
-			"qrCode":     result["qrCode"], // Assuming this field stores the QR code URL
+			"eventName":   result["eventName"],
+			"eventDate":   result["eventDate"],
+			"eventVenue":  result["eventVenue"],
+			"qrCode":      result["qrcode"], // Base64 QR code stored at registration
+			"ticketType":  result["ticketTypeName"],
+			"ticketPrice": result["ticketPrice"],
+			"currency":    result["currency"],
 		},
 	})
 }
@@ -493,10 +648,8 @@ func VerifyTicket(ctx *fiber.Ctx) error {
 
 	// Find the ticket
 	var result map[string]interface{}
-	err = registrationsCol.FindOne(ctx.Context(), map[string]interface{}{
-		"registrationId": eventId,
-		"primaryEmailId": primaryEmailId,
-	}).Decode(&result)
+	ticketFilter := bson.M{"registrationid": eventId, "primaryemailid": primaryEmailId}
+	err = registrationsCol.FindOne(ctx.Context(), ticketFilter).Decode(&result)
 	if err != nil {
 		return ctx.Status(400).JSON(fiber.Map{
 			"status":  "400 Bad Request",
@@ -504,21 +657,25 @@ func VerifyTicket(ctx *fiber.Ctx) error {
 		})
 	}
 
-	// Check if ticket is already verified
-	isVerified, ok := result["isTicketVerified"].(bool)
-	if ok && isVerified {
+	if status, _ := result["status"].(string); status != "" && status != eventutils.RegistrationStatusConfirmed {
 		return ctx.Status(400).JSON(fiber.Map{
 			"status":  "400 Bad Request",
-			"message": "Ticket already verified",
+			"message": "Ticket is not confirmed",
 		})
 	}
 
-	// Update the ticket verification status
-	_, err = registrationsCol.UpdateOne(ctx.Context(),
-		map[string]interface{}{"eventId": eventId, "primaryEmailId": primaryEmailId},
-		map[string]interface{}{
-			"$set": map[string]interface{}{
-				"isTicketVerified": true,
+	// Update the ticket verification status, only once even when the ticket
+	// is scanned twice at the same time
+	update, err := registrationsCol.UpdateOne(ctx.Context(),
+		bson.M{
+			"registrationid":   eventId,
+			"primaryemailid":   primaryEmailId,
+			"isticketverified": bson.M{"$ne": true},
+			"isTicketVerified": bson.M{"$ne": true},
+		},
+		bson.M{
+			"$set": bson.M{
+				"isticketverified": true,
 				"updatedAt":        time.Now().UnixMilli(), // Store timestamp in milliseconds
 			},
 		},
@@ -529,6 +686,15 @@ func VerifyTicket(ctx *fiber.Ctx) error {
 			"message": "Failed to update ticket status",
 		})
 	}
+	if update.ModifiedCount == 0 {
+		return ctx.Status(400).JSON(fiber.Map{
+			"status":  "400 Bad Request",
+			"message": "Ticket already verified",
+		})
+	}
+
+	registeredEventId, _ := result["uniqueId"].(string)
+	webhookutils.PublishCheckinCompleted(registeredEventId, eventId, primaryEmailId)
 
 	return ctx.JSON(fiber.Map{
 		"status":  "200 OK",
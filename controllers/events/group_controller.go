@@ -0,0 +1,361 @@
+package eventPanel
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	currencyutils "em_backend/library/currency"
+	eventutils "em_backend/library/events"
+	notifyutils "em_backend/library/notification"
+	webhookutils "em_backend/library/webhook"
+	dbModel "em_backend/models/db"
+	common_responses "em_backend/responses/common"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RegisterGroup buys several tickets of one ticket type, either as bundles or
+// as single tickets, and issues every ticket as its own registration.
+func RegisterGroup(ctx *fiber.Ctx) error {
+	sessionUserData, ok := ctx.Locals("userData").(common_responses.LoginDetails)
+	if !ok {
+		return ctx.JSON(commonutils.CreateFailureResponse(nil))
+	}
+
+	var requestData dbModel.GroupRegisterReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Validate Event ID
+	if requestData.UniqueId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	event, err := eventutils.FetchEvent(requestData.UniqueId)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Event not found",
+			Status:  "404 Not Found",
+		}))
+	}
+	if event.Status == eventutils.EventStatusCancelled {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: eventutils.ErrEventCancelled.Error(),
+			Status:  "409 Conflict",
+		}))
+	}
+
+	ticketType, err := eventutils.SelectTicketType(event, requestData.TicketTypeId)
+	if err == nil && ticketType == nil {
+		err = fmt.Errorf("event does not sell tickets")
+	}
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Price the order from the selected bundle or quantity
+	quote, err := eventutils.QuoteTickets(*ticketType, requestData.BundleId, requestData.BundleCount, requestData.Quantity)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+	if err := eventutils.CheckTicketAvailability(*ticketType, quote.TicketCount, time.Now().Unix()); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "409 Conflict",
+		}))
+	}
+
+	// Reserve all seats of the order at once
+	if err := eventutils.ReserveTickets(event.UniqueId, *ticketType, quote.TicketCount); err != nil {
+		if err == eventutils.ErrTicketSoldOut {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Not enough tickets left",
+				Status:  "409 Conflict",
+			}))
+		}
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to reserve tickets",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	releaseSeats := func() {
+		if err := eventutils.ReleaseTickets(event.UniqueId, ticketType.TicketTypeId, quote.TicketCount); err != nil {
+			fmt.Println("Error releasing tickets:", err)
+		}
+	}
+
+	// Paid group orders wait for payment before their QR codes are issued
+	now := time.Now().Unix()
+	status := eventutils.RegistrationStatusConfirmed
+	confirmedAt := now
+	var holdExpiresAt int64
+	if quote.Amount > 0 {
+		status = eventutils.RegistrationStatusPendingPayment
+		confirmedAt = 0
+		holdExpiresAt = time.Now().Add(eventutils.SeatHoldDuration()).Unix()
+	}
+
+	// Issue one registration with its own QR code per ticket
+	groupOrderId := uuid.New().String()
+	ticketPrices := currencyutils.Split(quote.Amount, quote.TicketCount)
+	registrations := make([]interface{}, 0, quote.TicketCount)
+	registrationIds := make([]string, 0, quote.TicketCount)
+	for i := 0; i < quote.TicketCount; i++ {
+		registrationId := uuid.New().String()
+		qrCodeBase64 := ""
+		if status == eventutils.RegistrationStatusConfirmed {
+			qrCodeBase64, err = eventutils.GenerateTicketQR(registrationId)
+			if err != nil {
+				releaseSeats()
+				return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+					Message: "Failed to generate QR code",
+					Status:  "500 Internal Server Error",
+				}))
+			}
+		}
+		registrations = append(registrations, dbModel.RegistrationData{
+			UniqueId:                     event.UniqueId,
+			RegistrationId:               registrationId,
+			PrimaryEmailId:               sessionUserData.Email,
+			PrimaryMemberForm:            requestData.PrimaryMemberForm,
+			QrCode:                       qrCodeBase64,
+			RegisteredAt:                 now,
+			TicketVerificationStatusTeam: []string{},
+			TicketTypeId:                 ticketType.TicketTypeId,
+			TicketTypeName:               ticketType.Name,
+			TicketPrice:                  ticketPrices[i],
+			Currency:                     quote.Currency,
+			GroupOrderId:                 groupOrderId,
+			Status:                       status,
+			ConfirmedAt:                  confirmedAt,
+			HoldExpiresAt:                holdExpiresAt,
+			IsActive:                     true,
+		})
+		registrationIds = append(registrationIds, registrationId)
+	}
+
+	groupOrder := dbModel.GroupOrder{
+		GroupOrderId:    groupOrderId,
+		EventId:         event.UniqueId,
+		TicketTypeId:    ticketType.TicketTypeId,
+		TicketTypeName:  ticketType.Name,
+		TicketCount:     quote.TicketCount,
+		Amount:          quote.Amount,
+		Currency:        quote.Currency,
+		BuyerEmail:      sessionUserData.Email,
+		RegistrationIds: registrationIds,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if quote.Bundle != nil {
+		groupOrder.BundleId = quote.Bundle.BundleId
+		groupOrder.BundleName = quote.Bundle.Name
+		groupOrder.BundleCount = quote.BundleCount
+	}
+
+	// Connect to MongoDB
+	db, registrationsCol, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		releaseSeats()
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to Registrations collection",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	if _, err := db.Collection("groupOrders").InsertOne(ctx.Context(), groupOrder); err != nil {
+		releaseSeats()
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to save group order",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if _, err := registrationsCol.InsertMany(ctx.Context(), registrations); err != nil {
+		releaseSeats()
+		db.Collection("groupOrders").DeleteOne(context.TODO(), bson.M{"groupOrderId": groupOrderId})
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to register for the event",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	for _, registration := range registrations {
+		webhookutils.PublishRegistrationCreated(registration.(dbModel.RegistrationData))
+	}
+
+	// Free orders are confirmed now, paid ones once the payment is verified
+	if status == eventutils.RegistrationStatusConfirmed {
+		notifyutils.QueueRegistrationConfirmations(registrationIds)
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Group order registered successfully",
+		Status:  "200 OK",
+		Data:    groupOrder,
+	}))
+}
+
+// GetGroupOrder returns a group order of the session user with its tickets.
+func GetGroupOrder(ctx *fiber.Ctx) error {
+	sessionUserData, ok := ctx.Locals("userData").(common_responses.LoginDetails)
+	if !ok {
+		return ctx.JSON(commonutils.CreateFailureResponse(nil))
+	}
+
+	var requestData dbModel.GroupOrder
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.GroupOrderId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Group order ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	db, registrationsCol, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to MongoDB",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	var groupOrder dbModel.GroupOrder
+	err = db.Collection("groupOrders").FindOne(ctx.Context(), bson.M{
+		"groupOrderId": requestData.GroupOrderId,
+		"buyerEmail":   sessionUserData.Email,
+	}).Decode(&groupOrder)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Group order not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	cursor, err := registrationsCol.Find(ctx.Context(), bson.M{"groupOrderId": groupOrder.GroupOrderId})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching tickets",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer cursor.Close(ctx.Context())
+
+	var tickets []dbModel.RegistrationData
+	if err := cursor.All(ctx.Context(), &tickets); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error processing tickets",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Group order fetched successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"groupOrder": groupOrder,
+			"tickets":    tickets,
+		},
+	}))
+}
+
+// AssignAttendee lets the buyer of a group order name the attendee of one of
+// its tickets.
+func AssignAttendee(ctx *fiber.Ctx) error {
+	sessionUserData, ok := ctx.Locals("userData").(common_responses.LoginDetails)
+	if !ok {
+		return ctx.JSON(commonutils.CreateFailureResponse(nil))
+	}
+
+	var requestData dbModel.AssignAttendeeReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	requestData.AttendeeName = strings.TrimSpace(requestData.AttendeeName)
+	requestData.AttendeeEmail = strings.TrimSpace(strings.ToLower(requestData.AttendeeEmail))
+	if requestData.RegistrationId == "" || requestData.AttendeeName == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Registration ID and attendee name are required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	if _, err := mail.ParseAddress(requestData.AttendeeEmail); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Invalid attendee email",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Connect to MongoDB
+	_, registrationsCol, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error connecting to Registrations collection",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	defer registrationsCol.Database().Client().Disconnect(context.TODO())
+
+	// Only group tickets owned by the buyer can be assigned
+	result, err := registrationsCol.UpdateOne(ctx.Context(), bson.M{
+		"registrationid": requestData.RegistrationId,
+		"primaryemailid": sessionUserData.Email,
+		"groupOrderId":   bson.M{"$nin": bson.A{nil, ""}},
+	}, bson.M{
+		"$set": bson.M{
+			"attendeeName":  requestData.AttendeeName,
+			"attendeeEmail": requestData.AttendeeEmail,
+			"updatedAt":     time.Now().Unix(),
+		},
+	})
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to assign attendee",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	if result.MatchedCount == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Ticket not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	// Tickets of unpaid orders are emailed once the payment is confirmed
+	notifyutils.QueueTicket(requestData.RegistrationId, requestData.AttendeeEmail)
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Attendee assigned successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"registrationId": requestData.RegistrationId,
+			"attendeeName":   requestData.AttendeeName,
+			"attendeeEmail":  requestData.AttendeeEmail,
+		},
+	}))
+}
@@ -0,0 +1,261 @@
+package eventPanel
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	commonutils "em_backend/library/common"
+	messagingutils "em_backend/library/messaging"
+	notifyutils "em_backend/library/notification"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetNotificationPreferences returns the notification categories the user
+// muted and the ones that can be muted.
+func GetNotificationPreferences(ctx *fiber.Ctx) error {
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	preferences, err := notifyutils.FetchPreferences(sessionUserData.Email)
+	if err != nil {
+		if errors.Is(err, notifyutils.ErrUserNotFound) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "User not found",
+				Status:  "404 Not Found",
+			}))
+		}
+		log.Printf("Failed to fetch notification preferences: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching notification preferences",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Notification preferences fetched successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"preferences":           preferences,
+			"categories":            notifyutils.Categories,
+			"textNotificationTypes": notifyutils.TextNotificationTypes,
+			"channels":              messagingutils.Channels,
+		},
+	}))
+}
+
+// SetNotificationPreferences replaces the notification categories the user
+// muted.
+func SetNotificationPreferences(ctx *fiber.Ctx) error {
+	var requestData notificationModel.NotificationPreferences
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error parsing request data",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	preferences, err := notifyutils.SavePreferences(sessionUserData.Email, requestData)
+	if err != nil {
+		switch {
+		case errors.Is(err, notifyutils.ErrUnknownCategory), errors.Is(err, notifyutils.ErrUnknownType),
+			errors.Is(err, messagingutils.ErrUnknownChannel), errors.Is(err, notifyutils.ErrPhoneRequired):
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		case errors.Is(err, notifyutils.ErrUserNotFound):
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "User not found",
+				Status:  "404 Not Found",
+			}))
+		}
+		log.Printf("Failed to save notification preferences: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to save notification preferences",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Notification preferences saved successfully",
+		Status:  "200 OK",
+		Data:    preferences,
+	}))
+}
+
+// SetPhoneNumber texts a verification code to a number the user wants to
+// receive notifications on.
+func SetPhoneNumber(ctx *fiber.Ctx) error {
+	var requestData dbModel.PhoneNumberReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.Phone == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Phone number is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	phone, err := messagingutils.SendPhoneVerification(sessionUserData.Email, requestData.Phone, requestData.Channel)
+	if err != nil {
+		if errors.Is(err, messagingutils.ErrInvalidPhone) || errors.Is(err, messagingutils.ErrUnknownChannel) ||
+			errors.Is(err, messagingutils.ErrRejected) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		if errors.Is(err, messagingutils.ErrResendTooSoon) || errors.Is(err, messagingutils.ErrTooManyCodes) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "429 Too Many Requests",
+			}))
+		}
+		log.Printf("Failed to send phone verification: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to send verification code",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Verification code sent",
+		Status:  "200 OK",
+		Data:    fiber.Map{"phone": messagingutils.MaskPhone(phone)},
+	}))
+}
+
+// VerifyPhoneNumber saves the number a verification code was sent to on the
+// user's profile.
+func VerifyPhoneNumber(ctx *fiber.Ctx) error {
+	var requestData dbModel.VerifyPhoneNumberReq
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.Code == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Verification code is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	phone, err := messagingutils.VerifyPhone(sessionUserData.Email, requestData.Code)
+	if err != nil {
+		if errors.Is(err, messagingutils.ErrCodeInvalid) || errors.Is(err, messagingutils.ErrCodeExpired) ||
+			errors.Is(err, messagingutils.ErrTooManyAttempts) {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		log.Printf("Failed to verify phone number: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to verify phone number",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Phone number verified successfully",
+		Status:  "200 OK",
+		Data:    fiber.Map{"phone": phone},
+	}))
+}
+
+// GetNotifications lists the user's in-app notifications, newest first, with
+// their unread count.
+func GetNotifications(ctx *fiber.Ctx) error {
+	var requestData notificationModel.FeedListRequest
+	if len(ctx.Body()) != 0 {
+		if err := json.Unmarshal(ctx.Body(), &requestData); err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Error parsing request data",
+				Status:  "400 Bad Request",
+			}))
+		}
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	notifications, unread, err := notifyutils.ListFeed(sessionUserData.Email, requestData)
+	if err != nil {
+		log.Printf("Failed to list notifications: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error fetching notifications",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Notifications fetched successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"notifications": notifications,
+			"unreadCount":   unread,
+		},
+	}))
+}
+
+// GetUnreadNotificationCount returns the number for the notification badge.
+func GetUnreadNotificationCount(ctx *fiber.Ctx) error {
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	unread, err := notifyutils.UnreadCount(sessionUserData.Email)
+	if err != nil {
+		log.Printf("Failed to count unread notifications: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Error counting notifications",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Unread notifications counted successfully",
+		Status:  "200 OK",
+		Data:    fiber.Map{"unreadCount": unread},
+	}))
+}
+
+// MarkNotificationsRead marks some of the user's notifications read.
+func MarkNotificationsRead(ctx *fiber.Ctx) error {
+	var requestData notificationModel.FeedReadRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || len(requestData.NotificationIds) == 0 {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Notification IDs are required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	return markNotificationsRead(ctx, requestData.NotificationIds)
+}
+
+// MarkAllNotificationsRead marks every notification of the user read.
+func MarkAllNotificationsRead(ctx *fiber.Ctx) error {
+	return markNotificationsRead(ctx, nil)
+}
+
+func markNotificationsRead(ctx *fiber.Ctx, notificationIds []string) error {
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	marked, err := notifyutils.MarkFeedRead(sessionUserData.Email, notificationIds)
+	if err != nil {
+		log.Printf("Failed to mark notifications read: %v", err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to mark notifications read",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+	unread, err := notifyutils.UnreadCount(sessionUserData.Email)
+	if err != nil {
+		log.Printf("Failed to count unread notifications: %v", err)
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Notifications marked read successfully",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"marked":      marked,
+			"unreadCount": unread,
+		},
+	}))
+}
@@ -4,6 +4,7 @@ import (
 	mongoSetup "em_backend/configs/mongo"
 	common "em_backend/library/common"
 	loginCommon "em_backend/library/login"
+	mailutils "em_backend/library/mail"
 	"encoding/json"
 	"strings"
 
@@ -159,6 +160,9 @@ func Register(ctx *fiber.Ctx) error {
 	user.UserName = registrationRequest.UserName
 	user.Password = hashedPassword
 	user.UserHash = userHash
+	if locale, err := mailutils.NormaliseLocale(registrationRequest.Locale); err == nil {
+		user.Locale = locale
+	}
 	user.CreatedAt = time.Now().Unix()
 	_, err = mongoSetup.InsertOneDoc("userData", user)
 	if err != nil {
@@ -239,7 +243,7 @@ func RegisterForgotPasswordEmail(ctx *fiber.Ctx) error {
 		}))
 	}
 
-	isEmailSent, err := loginCommon.SendRegisterOrForgotPasswordEmail(emailVal, "register")
+	isEmailSent, err := loginCommon.SendRegisterOrForgotPasswordEmail(emailVal, "register", email.Locale)
 	if !isEmailSent {
 		res.Access = false
 		res.Message = "Cannot send email right now"
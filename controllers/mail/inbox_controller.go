@@ -0,0 +1,73 @@
+package mailPanel
+
+import (
+	"encoding/json"
+	"errors"
+
+	commonutils "em_backend/library/common"
+	mailutils "em_backend/library/mail"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type inboxReq struct {
+	To string `json:"to"`
+	Id string `json:"id"`
+}
+
+// GetInbox lists the emails written to the local mail sink. It is only
+// registered when MAIL_DRIVER=file.
+func GetInbox(ctx *fiber.Ctx) error {
+	var req inboxReq
+	if len(ctx.Body()) != 0 {
+		if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Invalid request body",
+				Status:  "400 Bad Request",
+			}))
+		}
+	}
+
+	messages, err := mailutils.ListSinkMessages(req.To)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Emails fetched successfully",
+		Status:  "200 OK",
+		Data:    messages,
+	}))
+}
+
+// GetInboxMessage downloads one email from the local mail sink as an .eml
+// file.
+func GetInboxMessage(ctx *fiber.Ctx) error {
+	var req inboxReq
+	if err := json.Unmarshal(ctx.Body(), &req); err != nil || req.Id == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "id is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	raw, err := mailutils.ReadSinkMessage(req.Id)
+	if err != nil {
+		status := "500 Internal Server Error"
+		if errors.Is(err, mailutils.ErrSinkMessageNotFound) {
+			status = "404 Not Found"
+		}
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  status,
+		}))
+	}
+
+	ctx.Set(fiber.HeaderContentType, "message/rfc822")
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="`+req.Id+`"`)
+	return ctx.Send(raw)
+}
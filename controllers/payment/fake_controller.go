@@ -0,0 +1,70 @@
+package paymentPanel
+
+import (
+	"encoding/json"
+	"log"
+
+	commonutils "em_backend/library/common"
+	paymentutils "em_backend/library/payment"
+	paymentModel "em_backend/models/payment"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type fakePaymentReq struct {
+	OrderId string `json:"orderId"`
+	// Fail simulates a declined payment instead of a captured one
+	Fail bool `json:"fail"`
+	// DeliverWebhook also runs the provider's webhook through the
+	// webhook handling, as the real provider would
+	DeliverWebhook bool `json:"deliverWebhook"`
+}
+
+// CompleteFakePaymentHandler simulates the customer paying an order created
+// with the fake provider. It is only registered when PAYMENT_PROVIDER=fake.
+func CompleteFakePaymentHandler(ctx *fiber.Ctx) error {
+	var req fakePaymentReq
+	if err := json.Unmarshal(ctx.Body(), &req); err != nil || req.OrderId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "orderId is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	verification, webhookBody, webhookSignature, err := paymentutils.CompleteFakePayment(req.OrderId, req.Fail)
+	if err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "404 Not Found",
+		}))
+	}
+
+	if req.DeliverWebhook {
+		provider, err := paymentutils.ProviderByName(paymentutils.ProviderFake)
+		var event paymentModel.ProviderWebhookEvent
+		if err == nil {
+			event, err = provider.ParseWebhook(webhookBody, map[string]string{"X-Fake-Signature": webhookSignature})
+		}
+		if err == nil {
+			_, err = processWebhookEvent(provider.Name(), event)
+		}
+		if err != nil {
+			log.Printf("Failed to deliver fake webhook for order %s: %v", req.OrderId, err)
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Failed to deliver webhook",
+				Status:  "500 Internal Server Error",
+			}))
+		}
+	}
+
+	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+		Message: "Fake payment completed",
+		Status:  "200 OK",
+		Data: fiber.Map{
+			"verification":     verification,
+			"webhookBody":      string(webhookBody),
+			"webhookSignature": webhookSignature,
+		},
+	}))
+}
@@ -0,0 +1,62 @@
+package paymentPanel
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	commonutils "em_backend/library/common"
+	invoiceutils "em_backend/library/invoice"
+	paymentutils "em_backend/library/payment"
+	invoiceModel "em_backend/models/invoice"
+	common_responses "em_backend/responses/common"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DownloadInvoiceHandler returns the PDF invoice of a paid order, issuing it
+// if it was not issued when the payment was confirmed.
+func DownloadInvoiceHandler(ctx *fiber.Ctx) error {
+	var requestData invoiceModel.InvoiceRequest
+	if err := json.Unmarshal(ctx.Body(), &requestData); err != nil || requestData.OrderId == "" {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Order ID is required",
+			Status:  "400 Bad Request",
+		}))
+	}
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+
+	// Buyers can only download their own invoices
+	order, err := paymentutils.FetchOrder(requestData.OrderId)
+	if err != nil || (order.UserEmail != sessionUserData.Email && !sessionUserData.IsAdmin) {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Order not found",
+			Status:  "404 Not Found",
+		}))
+	}
+
+	fileName, pdf, err := invoiceutils.InvoiceAttachment(order)
+	if err != nil {
+		if err == invoiceutils.ErrInvoicePending {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "409 Conflict",
+			}))
+		}
+		if err == invoiceutils.ErrOrderNotInvoiceable {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "400 Bad Request",
+			}))
+		}
+		log.Printf("Failed to invoice order %s: %v", order.OrderID, err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to generate invoice",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	ctx.Set(fiber.HeaderContentType, "application/pdf")
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+	return ctx.Send(pdf)
+}
@@ -2,20 +2,22 @@ package paymentPanel
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
+	"time"
 
 	mongoSetup "em_backend/configs/mongo"
 
 	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	invoiceutils "em_backend/library/invoice"
+	paymentutils "em_backend/library/payment"
+	promoutils "em_backend/library/promo"
 	paymentModel "em_backend/models/payment"
+	promoModel "em_backend/models/promo"
 	common_responses "em_backend/responses/common"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -30,24 +32,126 @@ func CreateOrderHandler(ctx *fiber.Ctx) error {
 			Status:  "400 Bad Request",
 		}))
 	}
-	// Call CreateOrder to create the Razorpay order
-	order, err := CreateOrder(&orderReq)
+	sessionUserData, _ := ctx.Locals("userData").(common_responses.LoginDetails)
+	if err := invoiceutils.ValidateBillingDetails(&orderReq.BillingDetails); err != nil {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: err.Error(),
+			Status:  "400 Bad Request",
+		}))
+	}
+
+	// Compute the amount on the server from the event's ticket pricing
+	quote, err := paymentutils.QuoteOrder(orderReq, sessionUserData.Email)
 	if err != nil {
-		log.Printf("Failed to create order: %v", err)
+		status := "400 Bad Request"
+		switch err {
+		case paymentutils.ErrAmountMismatch, paymentutils.ErrCurrencyMismatch:
+			status = "409 Conflict"
+		case paymentutils.ErrRegistrationNotFound, paymentutils.ErrGroupOrderNotFound:
+			status = "404 Not Found"
+		}
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
-			Message: "Failed to create Razorpay order",
+			Message: err.Error(),
+			Status:  status,
+		}))
+	}
+
+	// Nothing left to pay once the promo code covers the price
+	if quote.Amount == 0 {
+		confirmed, err := paymentutils.ConfirmFreeOrder(quote, sessionUserData.Email)
+		if err != nil && len(confirmed) == 0 {
+			status := "500 Internal Server Error"
+			switch {
+			case errors.Is(err, paymentutils.ErrRegistrationExpired):
+				status = "400 Bad Request"
+			case errors.Is(err, promoutils.ErrPromoExhausted):
+				status = "409 Conflict"
+			default:
+				log.Printf("Failed to confirm free order: %v", err)
+			}
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  status,
+			}))
+		}
+		if err != nil {
+			log.Printf("Failed to confirm every registration of a free order: %v", err)
+		}
+		return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
+			Message: "Registration confirmed, nothing to pay",
+			Status:  "200 OK",
+			Data: fiber.Map{
+				"amount":          0,
+				"currency":        quote.Currency,
+				"discountAmount":  quote.Discount,
+				"promoCode":       quote.Promo.Code,
+				"registrationIds": confirmed,
+			},
+		}))
+	}
+
+	orderReq.Amount = quote.Amount
+	orderReq.Currency = quote.Currency
+	orderReq.Receipt = quote.RegID
+	if quote.GroupOrderId != "" {
+		orderReq.Receipt = quote.GroupOrderId
+	}
+
+	// Internal references travel to the provider as notes
+	notes := map[string]string{}
+	if quote.RegID != "" {
+		notes["reg_id"] = quote.RegID
+	}
+	if quote.GroupOrderId != "" {
+		notes["group_order_id"] = quote.GroupOrderId
+	}
+	if quote.Promo.Code != "" {
+		notes["promo_code"] = quote.Promo.Code
+	}
+
+	// Create the order with the configured payment provider
+	provider := paymentutils.ActiveProvider()
+	order, err := provider.CreateOrder(paymentModel.ProviderOrderRequest{
+		Amount:   orderReq.Amount,
+		Currency: orderReq.Currency,
+		Receipt:  orderReq.Receipt,
+		Notes:    notes,
+	})
+	if err != nil {
+		log.Printf("Failed to create %s order: %v", provider.Name(), err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to create payment order",
 			Status:  "500 Internal Server Error",
 		}))
 	}
 
-	// Prepare order details for insertion
+	// Prepare order details for insertion; the order expires with the seat hold
+	now := time.Now()
+	expiresAt := quote.HoldExpiresAt
+	if expiresAt == 0 {
+		expiresAt = now.Add(eventutils.SeatHoldDuration()).Unix()
+	}
 	orderDetails := paymentModel.OrderDetails{
-		OrderID:  order.ID,
-		Amount:   order.Amount,
-		Currency: order.Currency,
-		Receipt:  order.Receipt,
-		Status:   order.Status,
-		RegID:    orderReq.RegID,
+		OrderID:        order.ID,
+		Amount:         order.Amount,
+		Currency:       order.Currency,
+		Receipt:        order.Receipt,
+		Status:         paymentutils.OrderStatusCreated,
+		RegID:          quote.RegID,
+		GroupOrderId:   quote.GroupOrderId,
+		EventId:        quote.EventId,
+		TicketTypeId:   quote.TicketTypeId,
+		TicketCount:    quote.TicketCount,
+		UserEmail:      sessionUserData.Email,
+		Subtotal:       quote.Subtotal,
+		DiscountAmount: quote.Discount,
+		PromoCode:      quote.Promo.Code,
+		Provider:       provider.Name(),
+		CreatedAt:      now.Unix(),
+		UpdatedAt:      now.Unix(),
+		ExpiresAt:      expiresAt,
+		StatusHistory:  []paymentModel.StatusChange{{Status: paymentutils.OrderStatusCreated, At: now.Unix()}},
+		BillingDetails: orderReq.BillingDetails,
 	}
 
 	// Connect to the MongoDB collection
@@ -69,6 +173,41 @@ func CreateOrderHandler(ctx *fiber.Ctx) error {
 		}))
 	}
 
+	// Record the promo redemption against the order
+	if quote.Promo.Code != "" {
+		err = promoutils.RedeemPromoCode(quote.Promo, promoModel.PromoRedemption{
+			EventId:        quote.EventId,
+			TicketTypeId:   quote.TicketTypeId,
+			UserEmail:      sessionUserData.Email,
+			OrderId:        order.ID,
+			Subtotal:       quote.Subtotal,
+			DiscountAmount: quote.Discount,
+			Currency:       order.Currency,
+		})
+		if err != nil {
+			log.Printf("Failed to redeem promo code %s: %v", quote.Promo.Code, err)
+			if _, err := paymentutils.TransitionOrder(order.ID, paymentutils.OrderStatusFailed, "promo code could not be redeemed", nil); err != nil {
+				log.Printf("Failed to mark order %s as failed: %v", order.ID, err)
+			}
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: err.Error(),
+				Status:  "409 Conflict",
+			}))
+		}
+	}
+
+	// Tie the order to the registrations it pays for
+	if err := paymentutils.LinkOrder(quote, order.ID); err != nil {
+		log.Printf("Failed to link order %s: %v", order.ID, err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to link order to registration",
+			Status:  "500 Internal Server Error",
+		}))
+	}
+
+	order.Status = orderDetails.Status
+	order.ExpiresAt = expiresAt
+
 	// Return the success response
 	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
 		Message: "Order created and details saved successfully",
@@ -77,44 +216,7 @@ func CreateOrderHandler(ctx *fiber.Ctx) error {
 	}))
 }
 
-// createOrder creates a new Razorpay order
-func CreateOrder(orderReq *paymentModel.OrderRequest) (*paymentModel.OrderResponse, error) {
-	// Load configuration values
-	apiSecret := commonutils.LoadEnv("RAZORPAY_API_SECRET")
-	apiKey := commonutils.LoadEnv("RAZORPAY_API_KEY")
-	baseURL := commonutils.LoadEnv("RAZORPAY_BASE_URL")
-
-	// Initialize Resty client
-	client := resty.New()
-
-	// Perform the POST request
-	resp, err := client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBasicAuth(apiKey, apiSecret).
-		SetBody(orderReq).
-		Post(baseURL + "/orders")
-
-	if err != nil {
-		log.Printf("Error making API request: %v", err)
-		return nil, err
-	}
-
-	// Check for non-200 HTTP response
-	if resp.StatusCode() != 200 && resp.StatusCode() != 201 {
-		return nil, fmt.Errorf("API error: %s", resp.String())
-	}
-
-	// Parse the response body
-	var orderResp paymentModel.OrderResponse
-	if err := json.Unmarshal(resp.Body(), &orderResp); err != nil {
-		log.Printf("Error parsing response body: %v", err)
-		return nil, err
-	}
-
-	return &orderResp, nil
-}
-
-// verifyPaymentHandler verifies the Razorpay payment signature
+// verifyPaymentHandler verifies a payment with the provider of its order
 func VerifyPaymentHandler(ctx *fiber.Ctx) error {
 	// Parse the request body
 	verification := new(paymentModel.PaymentVerification)
@@ -125,34 +227,47 @@ func VerifyPaymentHandler(ctx *fiber.Ctx) error {
 		}))
 	}
 
-	// Verify the payment signature
-	if !verifySignature(verification) {
+	// Verify the payment with the provider the order was created with
+	order, err := paymentutils.FetchOrder(verification.OrderID)
+	if err != nil {
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
-			Message: "Invalid payment signature",
-			Status:  "400 Bad Request",
+			Message: "Order not found",
+			Status:  "404 Not Found",
 		}))
 	}
-
-	// Prepare payment details
-	paymentDetails := paymentModel.PaymentDetails{
-		OrderID:   verification.OrderID,
-		PaymentID: verification.PaymentID,
-		Status:    "Verified",
+	provider, err := paymentutils.ProviderByName(order.Provider)
+	if err != nil {
+		log.Printf("Order %s: %v", order.OrderID, err)
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Failed to verify payment",
+			Status:  "500 Internal Server Error",
+		}))
 	}
-
-	// Connect to the MongoDB collection
-	_, paymentDetailsCol, err := mongoSetup.ConnectMongo("paymentDetails")
+	valid, err := provider.VerifyPayment(*verification)
 	if err != nil {
+		log.Printf("Failed to verify payment for order %s: %v", order.OrderID, err)
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
-			Message: "Error connecting to PaymentDetails collection",
+			Message: "Failed to verify payment",
 			Status:  "500 Internal Server Error",
 		}))
 	}
-	defer paymentDetailsCol.Database().Client().Disconnect(context.TODO())
+	if !valid {
+		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+			Message: "Invalid payment signature",
+			Status:  "400 Bad Request",
+		}))
+	}
 
-	// Insert payment details into MongoDB
-	_, err = paymentDetailsCol.InsertOne(ctx.Context(), paymentDetails)
+	// Mark the order as paid and confirm its registrations
+	paidOrder, confirmed, err := paymentutils.ConfirmOrderPayment(verification.OrderID, verification.PaymentID)
 	if err != nil {
+		log.Printf("Failed to confirm payment for order %s: %v", verification.OrderID, err)
+		if err == paymentutils.ErrOrderNotFound {
+			return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
+				Message: "Order not found",
+				Status:  "404 Not Found",
+			}))
+		}
 		return ctx.JSON(commonutils.CreateFailureResponse(&common_responses.FailureResponse{
 			Message: "Failed to save payment details",
 			Status:  "500 Internal Server Error",
@@ -163,16 +278,11 @@ func VerifyPaymentHandler(ctx *fiber.Ctx) error {
 	return ctx.JSON(commonutils.CreateSuccessResponse(&common_responses.SuccessResponse{
 		Message: "Payment verified and details saved successfully",
 		Status:  "200 OK",
-		Data:    paymentDetails,
+		Data: fiber.Map{
+			"orderId":                  paidOrder.OrderID,
+			"paymentId":                verification.PaymentID,
+			"status":                   paidOrder.Status,
+			"confirmedRegistrationIds": confirmed,
+		},
 	}))
 }
-
-// verifySignature verifies the Razorpay payment signature
-func verifySignature(verification *paymentModel.PaymentVerification) bool {
-	apiSecret := commonutils.LoadEnv("RAZORPAY_API_SECRET")
-	data := verification.OrderID + "|" + verification.PaymentID
-	h := hmac.New(sha256.New, []byte(apiSecret))
-	h.Write([]byte(data))
-	expectedSignature := hex.EncodeToString(h.Sum(nil))
-	return expectedSignature == verification.Signature
-}
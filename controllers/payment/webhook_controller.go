@@ -0,0 +1,124 @@
+package paymentPanel
+
+import (
+	"errors"
+	"log"
+
+	paymentutils "em_backend/library/payment"
+	paymentModel "em_backend/models/payment"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PaymentWebhookHandler receives payment and refund events from the provider
+// named in the path. It is public, so every request must carry a valid
+// provider signature; each event id is processed only once.
+func PaymentWebhookHandler(ctx *fiber.Ctx) error {
+	provider, err := paymentutils.ProviderByName(ctx.Params("provider"))
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "404 Not Found",
+			"message": "Unknown payment provider",
+		})
+	}
+
+	// Verify the signature and normalise the provider's event
+	headers := map[string]string{}
+	for key, value := range ctx.GetReqHeaders() {
+		if len(value) > 0 {
+			headers[key] = value[0]
+		}
+	}
+	event, err := provider.ParseWebhook(ctx.Body(), headers)
+	if err == paymentutils.ErrInvalidWebhookSignature {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "401 Unauthorized",
+			"message": "Invalid webhook signature",
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "400 Bad Request",
+			"message": "Invalid webhook body",
+		})
+	}
+
+	// A provider may only settle the orders created with it
+	if err := paymentutils.CheckWebhookProvider(provider.Name(), event); err != nil {
+		log.Printf("Rejected %s webhook event %s: %v", provider.Name(), event.EventID, err)
+		if errors.Is(err, paymentutils.ErrWebhookProviderMismatch) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "400 Bad Request",
+				"message": "Event does not belong to this provider",
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "500 Internal Server Error",
+			"message": "Failed to process webhook event",
+		})
+	}
+
+	processed, err := processWebhookEvent(provider.Name(), event)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "500 Internal Server Error",
+			"message": "Failed to process webhook event",
+		})
+	}
+	if !processed {
+		return ctx.JSON(fiber.Map{
+			"status":  "200 OK",
+			"message": "Event already processed",
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"status":  "200 OK",
+		"message": "Event processed",
+	})
+}
+
+// processWebhookEvent claims and handles a provider event. It returns false
+// when the event was already handled.
+func processWebhookEvent(provider string, event paymentModel.ProviderWebhookEvent) (bool, error) {
+	// Ignore retries of events that were already handled
+	claimed, err := paymentutils.ClaimWebhookEvent(provider, event.EventID, event.Type)
+	if err != nil {
+		log.Printf("Failed to claim webhook event %s: %v", event.EventID, err)
+		return false, err
+	}
+	if !claimed {
+		return false, nil
+	}
+
+	if err := handleWebhookEvent(provider, event); err != nil {
+		log.Printf("Failed to process webhook event %s (%s): %v", event.EventID, event.Type, err)
+		paymentutils.CompleteWebhookEvent(provider, event.EventID, false)
+		return false, err
+	}
+	paymentutils.CompleteWebhookEvent(provider, event.EventID, true)
+	return true, nil
+}
+
+func handleWebhookEvent(provider string, event paymentModel.ProviderWebhookEvent) error {
+	switch event.Type {
+	case paymentutils.WebhookPaymentAttempted:
+		return paymentutils.MarkOrderAttempted(event.OrderID)
+	case paymentutils.WebhookPaymentCaptured:
+		_, _, err := paymentutils.ConfirmOrderPayment(event.OrderID, event.PaymentID)
+		return err
+	case paymentutils.WebhookPaymentFailed:
+		return paymentutils.MarkPaymentFailed(event)
+	case paymentutils.WebhookRefundProcessed:
+		if err := paymentutils.RecordRefund(event); err != nil {
+			return err
+		}
+		return paymentutils.UpdateRefundStatus(event.RefundID, paymentutils.RefundStatusProcessed, "")
+	case paymentutils.WebhookRefundFailed:
+		log.Printf("Refund %s of payment %s failed", event.RefundID, event.PaymentID)
+		return paymentutils.UpdateRefundStatus(event.RefundID, paymentutils.RefundStatusFailed, event.ErrorDescription)
+	default:
+		log.Printf("Ignoring %s webhook event %s", provider, event.EventID)
+		return nil
+	}
+}
@@ -72,6 +72,20 @@ func CheckAdmin(mail string) bool {
 	}
 }
 
+// ToBsonMap converts a struct into a bson.M using its bson tags, so that
+// individual fields can be dropped before a $set.
+func ToBsonMap(data interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
 func LoadEnv(key string) string {
 	err := godotenv.Load("env/local/.env")
 	if err != nil {
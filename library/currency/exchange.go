@@ -0,0 +1,135 @@
+package currencyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	currencyModel "em_backend/models/currency"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultBaseCurrency = "INR"
+
+var (
+	ErrInvalidExchangeRate = errors.New("exchange rates must be positive")
+	ErrNoExchangeRate      = errors.New("no exchange rate for currency")
+)
+
+// BaseCurrency is the currency exchange rates are quoted against, set with
+// EXCHANGE_RATE_BASE.
+func BaseCurrency() string {
+	base, err := Normalise(commonutils.LoadEnv("EXCHANGE_RATE_BASE"))
+	if err != nil {
+		return defaultBaseCurrency
+	}
+	return base
+}
+
+// FetchExchangeRates loads the rate table.
+func FetchExchangeRates() (currencyModel.ExchangeRates, error) {
+	rates := currencyModel.ExchangeRates{Base: BaseCurrency(), Rates: []currencyModel.ExchangeRate{}}
+
+	db, col, err := mongoSetup.ConnectMongo("exchangeRates")
+	if err != nil {
+		return rates, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"currency": 1}))
+	if err != nil {
+		return rates, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	if err := cursor.All(ctx, &rates.Rates); err != nil {
+		return rates, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+	return rates, nil
+}
+
+// SetExchangeRates stores rates against the base currency, replacing the
+// previous rate of each given currency.
+func SetExchangeRates(rates map[string]float64, updatedBy string) error {
+	normalised := map[string]float64{}
+	for code, rate := range rates {
+		code, err := Normalise(code)
+		if err != nil {
+			return err
+		}
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return ErrInvalidExchangeRate
+		}
+		normalised[code] = rate
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("exchangeRates")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	for code, rate := range normalised {
+		_, err := col.UpdateOne(ctx,
+			bson.M{"currency": code},
+			bson.M{"$set": currencyModel.ExchangeRate{Currency: code, Rate: rate, UpdatedBy: updatedBy, UpdatedAt: now}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save exchange rate of %s: %w", code, err)
+		}
+	}
+	return nil
+}
+
+// Converter converts amounts with one snapshot of the rate table.
+type Converter struct {
+	base  string
+	rates map[string]float64
+}
+
+// NewConverter loads the current rate table.
+func NewConverter() (*Converter, error) {
+	table, err := FetchExchangeRates()
+	if err != nil {
+		return nil, err
+	}
+	converter := &Converter{base: table.Base, rates: map[string]float64{table.Base: 1}}
+	for _, rate := range table.Rates {
+		converter.rates[rate.Currency] = rate.Rate
+	}
+	return converter, nil
+}
+
+// Convert converts minor units of one currency into the minor units of
+// another through the base currency, rounding like ToMinor.
+func (c *Converter) Convert(amount int64, from string, to string) (int64, error) {
+	from, to = normaliseOrKeep(from), normaliseOrKeep(to)
+	if from == to {
+		return amount, nil
+	}
+	fromRate, ok := c.rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w %s", ErrNoExchangeRate, from)
+	}
+	toRate, ok := c.rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w %s", ErrNoExchangeRate, to)
+	}
+	return ToMinor(ToMajor(amount, from)/fromRate*toRate, to), nil
+}
+
+func normaliseOrKeep(code string) string {
+	normalised, _ := Normalise(code)
+	return normalised
+}
@@ -0,0 +1,90 @@
+package currencyutils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// currencyExponents holds the ISO 4217 currencies tickets can be sold in and
+// the number of minor unit digits of each.
+var currencyExponents = map[string]int{
+	"AED": 2, "AUD": 2, "BDT": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EGP": 2, "EUR": 2, "GBP": 2, "HKD": 2,
+	"IDR": 2, "ILS": 2, "INR": 2, "JOD": 3, "JPY": 0, "KES": 2, "KRW": 0,
+	"KWD": 3, "LKR": 2, "MXN": 2, "MYR": 2, "NGN": 2, "NOK": 2, "NPR": 2,
+	"NZD": 2, "OMR": 3, "PHP": 2, "PKR": 2, "PLN": 2, "QAR": 2, "RUB": 2,
+	"SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TRY": 2, "TWD": 2, "USD": 2,
+	"VND": 0, "ZAR": 2,
+}
+
+var ErrUnsupportedCurrency = errors.New("unsupported currency code")
+
+// Normalise upper-cases a currency code and checks that it is supported.
+func Normalise(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := currencyExponents[code]; !ok {
+		return code, fmt.Errorf("%w '%s'", ErrUnsupportedCurrency, code)
+	}
+	return code, nil
+}
+
+// Exponent is the number of minor unit digits of a currency, 2 for unknown
+// codes.
+func Exponent(code string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(code)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// ToMinor converts a major unit amount (e.g. rupees) into minor units (e.g.
+// paise), rounding halves away from zero. All conversions of decimal amounts
+// go through here so they round the same way.
+func ToMinor(amount float64, code string) int64 {
+	return int64(math.Round(amount * math.Pow10(Exponent(code))))
+}
+
+// ToMajor converts minor units into a major unit amount.
+func ToMajor(amount int64, code string) float64 {
+	return float64(amount) / math.Pow10(Exponent(code))
+}
+
+// FormatDecimal formats minor units as a decimal number with the currency's
+// digits, e.g. 123450 INR as "1234.50".
+func FormatDecimal(amount int64, code string) string {
+	exponent := Exponent(code)
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exponent == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	unit := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exponent, amount%unit)
+}
+
+// Format formats minor units with the currency code, e.g. "INR 1234.50".
+func Format(amount int64, code string) string {
+	return fmt.Sprintf("%s %s", strings.ToUpper(code), FormatDecimal(amount, code))
+}
+
+// Split divides an amount into n parts that add up to it, giving the
+// remainder to the first parts one minor unit at a time.
+func Split(amount int64, n int) []int64 {
+	if n <= 0 {
+		return nil
+	}
+	parts := make([]int64, n)
+	share, remainder := amount/int64(n), amount%int64(n)
+	for i := range parts {
+		parts[i] = share
+		if int64(i) < remainder {
+			parts[i]++
+		}
+	}
+	return parts
+}
@@ -0,0 +1,119 @@
+package currencyutils
+
+import "testing"
+
+func TestToMinor(t *testing.T) {
+	tests := []struct {
+		amount float64
+		code   string
+		want   int64
+	}{
+		{1234.5, "INR", 123450},
+		{0.015, "USD", 2},
+		{1500, "JPY", 1500},
+		{1499.5, "JPY", 1500},
+		{12000, "KRW", 12000},
+		{1.2345, "KWD", 1235},
+		{10.001, "BHD", 10001},
+		{-2.5, "USD", -250},
+		{19.99, "usd", 1999},
+		{19.99, "XXX", 1999},
+	}
+	for _, test := range tests {
+		if got := ToMinor(test.amount, test.code); got != test.want {
+			t.Errorf("ToMinor(%v, %q) = %d, want %d", test.amount, test.code, got, test.want)
+		}
+	}
+}
+
+func TestToMajor(t *testing.T) {
+	tests := []struct {
+		amount int64
+		code   string
+		want   float64
+	}{
+		{123450, "INR", 1234.5},
+		{1500, "JPY", 1500},
+		{1235, "KWD", 1.235},
+		{-250, "USD", -2.5},
+	}
+	for _, test := range tests {
+		if got := ToMajor(test.amount, test.code); got != test.want {
+			t.Errorf("ToMajor(%d, %q) = %v, want %v", test.amount, test.code, got, test.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount int64
+		code   string
+		want   string
+	}{
+		{123450, "INR", "INR 1234.50"},
+		{5, "USD", "USD 0.05"},
+		{0, "EUR", "EUR 0.00"},
+		{-250, "usd", "USD -2.50"},
+		{1500, "JPY", "JPY 1500"},
+		{-1500, "VND", "VND -1500"},
+		{1235, "KWD", "KWD 1.235"},
+		{7, "OMR", "OMR 0.007"},
+		{-10001, "BHD", "BHD -10.001"},
+	}
+	for _, test := range tests {
+		if got := Format(test.amount, test.code); got != test.want {
+			t.Errorf("Format(%d, %q) = %q, want %q", test.amount, test.code, got, test.want)
+		}
+	}
+}
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr bool
+	}{
+		{"inr", "INR", false},
+		{" jpy ", "JPY", false},
+		{"KWD", "KWD", false},
+		{"XXX", "XXX", true},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		got, err := Normalise(test.code)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("Normalise(%q) = %q, %v, want %q, error %v", test.code, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		amount int64
+		n      int
+		want   []int64
+	}{
+		{100, 3, []int64{34, 33, 33}},
+		{1000, 4, []int64{250, 250, 250, 250}},
+		{2, 3, []int64{1, 1, 0}},
+		{5, 0, nil},
+	}
+	for _, test := range tests {
+		got := Split(test.amount, test.n)
+		if len(got) != len(test.want) {
+			t.Errorf("Split(%d, %d) = %v, want %v", test.amount, test.n, got, test.want)
+			continue
+		}
+		var sum int64
+		for i := range got {
+			sum += got[i]
+			if got[i] != test.want[i] {
+				t.Errorf("Split(%d, %d) = %v, want %v", test.amount, test.n, got, test.want)
+				break
+			}
+		}
+		if test.n > 0 && sum != test.amount {
+			t.Errorf("Split(%d, %d) adds up to %d", test.amount, test.n, sum)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package eventutils
+
+import (
+	"bytes"
+	commonutils "em_backend/library/common"
+	dbModel "em_backend/models/db"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	// Time zones of events must resolve on hosts without zoneinfo
+	_ "time/tzdata"
+)
+
+const (
+	CalendarMethodPublish = "PUBLISH"
+	CalendarMethodCancel  = "CANCEL"
+
+	// Events only have a start time, calendars show them this long
+	defaultEventDuration = 2 * time.Hour
+
+	calendarTimeFormat      = "20060102T150405Z"
+	calendarLocalTimeFormat = "20060102T150405"
+
+	// How often calendar apps should refresh subscription feeds
+	calendarRefreshInterval = "PT1H"
+
+	// Events are in India unless they or EVENT_TIMEZONE say otherwise
+	defaultTimeZone = "Asia/Kolkata"
+)
+
+// EventCalendar renders an event as an iCalendar (.ics) file. The UID is
+// stable per event and the sequence grows with every change, so calendars
+// update the entry they already have.
+func EventCalendar(event dbModel.Event, method string) []byte {
+	return renderCalendar(method, "", []dbModel.Event{event})
+}
+
+// FeedCalendar renders events as a subscription feed named name. Calendar
+// apps poll it and update the entries they have by UID.
+func FeedCalendar(name string, events []dbModel.Event) []byte {
+	return renderCalendar(CalendarMethodPublish, name, events)
+}
+
+func renderCalendar(method string, name string, events []dbModel.Event) []byte {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//STUNI//Events//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:" + method,
+	}
+	if name != "" {
+		lines = append(lines,
+			"X-WR-CALNAME:"+calendarEscape(name),
+			"REFRESH-INTERVAL;VALUE=DURATION:"+calendarRefreshInterval,
+			"X-PUBLISHED-TTL:"+calendarRefreshInterval,
+		)
+	}
+
+	// Every zone an event is in, with the span of its events
+	type span struct{ from, to time.Time }
+	zones := map[string]*span{}
+	var zoneNames []string
+	for _, event := range events {
+		location := EventTimeZone(event)
+		start := time.Unix(event.EventDate, 0)
+		if zone, found := zones[location.String()]; found {
+			if start.Before(zone.from) {
+				zone.from = start
+			}
+			if start.After(zone.to) {
+				zone.to = start
+			}
+			continue
+		}
+		zones[location.String()] = &span{start, start}
+		zoneNames = append(zoneNames, location.String())
+	}
+	for _, zoneName := range zoneNames {
+		location, _ := time.LoadLocation(zoneName)
+		lines = append(lines, calendarTimezone(location, zones[zoneName].from, zones[zoneName].to.Add(defaultEventDuration))...)
+	}
+
+	for _, event := range events {
+		lines = append(lines, calendarEvent(event, method)...)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.WriteString(calendarFold(line))
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
+
+func calendarEvent(event dbModel.Event, method string) []string {
+	location := EventTimeZone(event)
+	start := time.Unix(event.EventDate, 0).In(location)
+	status := "CONFIRMED"
+	if method == CalendarMethodCancel || event.Status == EventStatusCancelled {
+		status = "CANCELLED"
+	}
+	venue := event.EventLocation
+	if venue == "" {
+		venue = event.MeetingLink
+	}
+	if venue == "" {
+		venue = event.EventMode
+	}
+	description := event.EventDescription
+	if event.MeetingLink != "" {
+		description = strings.TrimSpace(description + "\n\nJoin online: " + event.MeetingLink)
+	}
+
+	lines := []string{
+		"BEGIN:VEVENT",
+		"UID:" + event.UniqueId + "@stuni",
+		"SEQUENCE:" + strconv.Itoa(event.CalendarSequence),
+		"DTSTAMP:" + time.Now().UTC().Format(calendarTimeFormat),
+		"DTSTART;TZID=" + location.String() + ":" + start.Format(calendarLocalTimeFormat),
+		"DTEND;TZID=" + location.String() + ":" + start.Add(defaultEventDuration).Format(calendarLocalTimeFormat),
+		"SUMMARY:" + calendarEscape(event.EventName),
+		"DESCRIPTION:" + calendarEscape(description),
+		"LOCATION:" + calendarEscape(venue),
+	}
+	if event.MeetingLink != "" {
+		lines = append(lines, "URL:"+event.MeetingLink)
+	}
+	if event.UpdatedAt > 0 {
+		lines = append(lines, "LAST-MODIFIED:"+time.Unix(event.UpdatedAt, 0).UTC().Format(calendarTimeFormat))
+	}
+	return append(lines, "STATUS:"+status, "END:VEVENT")
+}
+
+// calendarTimezone describes a time zone for the TZID of event times: its
+// offset a year before from and every change of offset until a year after
+// to, so calendars place events at the right instant across DST changes.
+func calendarTimezone(location *time.Location, from time.Time, to time.Time) []string {
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + location.String()}
+	current := from.AddDate(-1, 0, 0).In(location)
+	lines = append(lines, calendarObservance(current, current)...)
+
+	end := to.AddDate(1, 0, 0)
+	for current.Before(end) {
+		next := current.Add(24 * time.Hour)
+		if _, offset := next.Zone(); offset != zoneOffset(current) {
+			// Narrow the change down to the second
+			low, high := current, next
+			for high.Sub(low) > time.Second {
+				middle := low.Add(high.Sub(low) / 2)
+				if zoneOffset(middle) == zoneOffset(low) {
+					low = middle
+				} else {
+					high = middle
+				}
+			}
+			lines = append(lines, calendarObservance(low, high)...)
+		}
+		current = next
+	}
+	return append(lines, "END:VTIMEZONE")
+}
+
+// calendarObservance is the offset in force from change, which follows
+// before. Its start is written in the local time of the earlier offset.
+func calendarObservance(before time.Time, change time.Time) []string {
+	component := "STANDARD"
+	if change.IsDST() {
+		component = "DAYLIGHT"
+	}
+	name, offsetTo := change.Zone()
+	offsetFrom := zoneOffset(before)
+	return []string{
+		"BEGIN:" + component,
+		"DTSTART:" + change.In(time.FixedZone("", offsetFrom)).Format(calendarLocalTimeFormat),
+		"TZOFFSETFROM:" + calendarOffset(offsetFrom),
+		"TZOFFSETTO:" + calendarOffset(offsetTo),
+		"TZNAME:" + name,
+		"END:" + component,
+	}
+}
+
+func zoneOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+// calendarOffset formats a UTC offset in seconds as +HHMM, or +HHMMSS.
+func calendarOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	formatted := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		formatted += fmt.Sprintf("%02d", offset%60)
+	}
+	return formatted
+}
+
+// EventTimeZone is the time zone of an event, the platform's from
+// EVENT_TIMEZONE when it has none.
+func EventTimeZone(event dbModel.Event) *time.Location {
+	for _, name := range []string{event.TimeZone, commonutils.LoadEnv("EVENT_TIMEZONE"), defaultTimeZone} {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if location, err := time.LoadLocation(name); err == nil {
+			return location
+		}
+	}
+	return time.UTC
+}
+
+// PrepareTimeZone validates an IANA time zone name such as "Asia/Kolkata".
+func PrepareTimeZone(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil
+	}
+	if name == "Local" {
+		return "", fmt.Errorf("unknown time zone '%s'", name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown time zone '%s'", name)
+	}
+	return location.String(), nil
+}
+
+// PrepareMeetingLink validates the link online attendees join an event with.
+func PrepareMeetingLink(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return "", fmt.Errorf("meeting link must be an http or https URL")
+	}
+	return link, nil
+}
+
+// calendarEscape escapes text values as RFC 5545 requires.
+func calendarEscape(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+// calendarFold breaks lines longer than 75 octets, continuing them on lines
+// that start with a space, without splitting a UTF-8 character.
+func calendarFold(line string) string {
+	var b strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	return b.String()
+}
+
+// RegistrationManageURL is the page where an attendee can see or cancel a
+// registration, empty when APP_BASE_URL is not configured.
+func RegistrationManageURL(registrationId string) string {
+	baseURL := strings.TrimRight(strings.TrimSpace(commonutils.LoadEnv("APP_BASE_URL")), "/")
+	if baseURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/registrations/%s", baseURL, registrationId)
+}
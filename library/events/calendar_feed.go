@@ -0,0 +1,148 @@
+package eventutils
+
+import (
+	"context"
+	"crypto/rand"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	dbModel "em_backend/models/db"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Feeds leave out events that ended longer ago than this
+const calendarFeedHistory = 180 * 24 * time.Hour
+
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+// CalendarFeedToken returns the secret of a user's calendar feed, creating
+// it the first time. Resetting it replaces the secret, so URLs shared
+// before stop working.
+func CalendarFeedToken(email string, reset bool) (string, error) {
+	db, col, err := mongoSetup.ConnectMongo("userData")
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user dbModel.UserData
+	err = col.FindOne(ctx, bson.M{"email": email}, options.FindOne().SetProjection(bson.M{"calendarToken": 1})).Decode(&user)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch user: %w", err)
+	}
+	if user.CalendarToken != "" && !reset {
+		return user.CalendarToken, nil
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate calendar token: %w", err)
+	}
+	token := hex.EncodeToString(secret)
+	if _, err := col.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"calendarToken": token}}); err != nil {
+		return "", fmt.Errorf("failed to save calendar token: %w", err)
+	}
+	return token, nil
+}
+
+// CalendarFeedURL is the address calendar apps subscribe to, on API_BASE_URL
+// or baseURL when it is not configured.
+func CalendarFeedURL(baseURL string, token string) string {
+	if configured := strings.TrimSpace(commonutils.LoadEnv("API_BASE_URL")); configured != "" {
+		baseURL = configured
+	}
+	return fmt.Sprintf("%s/calendar/%s.ics", strings.TrimRight(baseURL, "/"), token)
+}
+
+// registeredFilter matches the confirmed tickets a user bought or was
+// assigned.
+func registeredFilter(email string) bson.M {
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"primaryemailid": email},
+			bson.M{"attendeeEmail": email},
+		},
+		"status": RegistrationStatusConfirmed,
+	}
+}
+
+// IsRegistered reports whether a user holds a confirmed ticket for an event.
+func IsRegistered(eventId string, email string) (bool, error) {
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := registeredFilter(email)
+	filter["uniqueId"] = eventId
+	count, err := col.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to count registrations: %w", err)
+	}
+	return count > 0, nil
+}
+
+// RegisteredEventsCalendar renders the feed of the user a calendar token
+// belongs to: every event they bought or were assigned a confirmed ticket
+// for, as it is now.
+// Cancelled events stay in it so calendars show them as cancelled.
+func RegisteredEventsCalendar(token string) ([]byte, error) {
+	if token == "" {
+		return nil, ErrCalendarFeedNotFound
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("userData")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user dbModel.UserData
+	err = col.FindOne(ctx, bson.M{"calendarToken": token}, options.FindOne().SetProjection(bson.M{"email": 1, "userName": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCalendarFeedNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	eventIds, err := db.Collection("registrations").Distinct(ctx, "uniqueId", registeredFilter(user.Email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registrations: %w", err)
+	}
+
+	events := []dbModel.Event{}
+	if len(eventIds) > 0 {
+		cursor, err := db.Collection("events").Find(ctx, bson.M{
+			"uniqueId":  bson.M{"$in": eventIds},
+			"status":    bson.M{"$ne": EventStatusInactive},
+			"eventDate": bson.M{"$gte": time.Now().Add(-calendarFeedHistory).Unix()},
+		}, options.Find().
+			SetSort(bson.M{"eventDate": 1}).
+			SetProjection(bson.M{"announcements": 0, "ticketTypes": 0}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch events: %w", err)
+		}
+		if err := cursor.All(ctx, &events); err != nil {
+			return nil, fmt.Errorf("failed to decode events: %w", err)
+		}
+	}
+	return FeedCalendar("STUNI events", events), nil
+}
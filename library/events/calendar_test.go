@@ -0,0 +1,62 @@
+package eventutils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCalendarEscape(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Annual Meetup", "Annual Meetup"},
+		{"Hall A, Floor 2; Gate 3", `Hall A\, Floor 2\; Gate 3`},
+		{`C:\path`, `C:\\path`},
+		{"line one\nline two\r\nline three", `line one\nline two\nline three`},
+		{"café, 東京", `café\, 東京`},
+	}
+	for _, test := range tests {
+		if got := calendarEscape(test.text); got != test.want {
+			t.Errorf("calendarEscape(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestCalendarFold(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		lines int
+	}{
+		{"short", "SUMMARY:Meetup", 1},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("a", 67), 1},
+		{"76 octets", "SUMMARY:" + strings.Repeat("a", 68), 2},
+		{"two byte character at the limit", "SUMMARY:" + strings.Repeat("a", 66) + "é", 2},
+		{"three byte characters", "DESCRIPTION:" + strings.Repeat("€", 60), 3},
+		{"four byte characters", "DESCRIPTION:" + strings.Repeat("🎉", 40), 3},
+		{"mixed", "LOCATION:" + strings.Repeat("東京 café ", 20), 4},
+	}
+	for _, test := range tests {
+		folded := calendarFold(test.line)
+		lines := strings.Split(folded, "\r\n")
+		if len(lines) != test.lines {
+			t.Errorf("%s: folded into %d lines, want %d: %q", test.name, len(lines), test.lines, folded)
+		}
+		for i, line := range lines {
+			if len(line) > 75 {
+				t.Errorf("%s: line %d is %d octets", test.name, i, len(line))
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("%s: line %d splits a character: %q", test.name, i, line)
+			}
+			if i > 0 && !strings.HasPrefix(line, " ") {
+				t.Errorf("%s: continuation line %d does not start with a space", test.name, i)
+			}
+		}
+		if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != test.line {
+			t.Errorf("%s: unfolds to %q, want %q", test.name, unfolded, test.line)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package eventutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	currencyutils "em_backend/library/currency"
+	dbModel "em_backend/models/db"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	TicketVisibilityPublic = "public"
+	TicketVisibilityHidden = "hidden"
+
+	DefaultCurrency = "INR"
+
+	EventStatusActive    = "active"
+	EventStatusInactive  = "inactive"
+	EventStatusCancelled = "cancelled"
+
+	RegistrationStatusPendingPayment = "pending_payment"
+	RegistrationStatusConfirmed      = "confirmed"
+	RegistrationStatusCancelled      = "cancelled"
+	RegistrationStatusRefunded       = "refunded"
+	RegistrationStatusExpired        = "expired"
+
+	// Unpaid registrations hold their seats for this long by default
+	defaultSeatHoldMinutes = 15
+
+	// No order can hold more tickets than this, whatever the ticket type's
+	// own MaxPerOrder
+	MaxTicketsPerOrder = 100
+)
+
+var (
+	ErrTicketTypeRequired = errors.New("ticket type is required")
+	ErrTicketTypeNotFound = errors.New("ticket type not found")
+	ErrTicketNotOnSale    = errors.New("ticket type is not on sale")
+	ErrTicketSoldOut      = errors.New("ticket type is sold out")
+	ErrEventCancelled     = errors.New("event has been cancelled")
+	ErrTooManyTickets     = fmt.Errorf("at most %d tickets can be bought per order", MaxTicketsPerOrder)
+	ErrAmountTooLarge     = errors.New("order amount is too large")
+)
+
+// FetchEvent loads an event by its unique id.
+func FetchEvent(eventId string) (dbModel.Event, error) {
+	var event dbModel.Event
+	result, err := mongoSetup.FindOneDoc("events", bson.M{"uniqueId": eventId}, bson.M{})
+	if err != nil {
+		return event, err
+	}
+	if err := result.Decode(&event); err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+// SeatHoldDuration is how long seats of an unpaid registration stay reserved
+// while payment is pending, set with ORDER_HOLD_MINUTES.
+func SeatHoldDuration() time.Duration {
+	minutes, err := strconv.Atoi(commonutils.LoadEnv("ORDER_HOLD_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = defaultSeatHoldMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// GenerateTicketQR encodes a registration id as a base64 PNG QR code.
+func GenerateTicketQR(registrationId string) (string, error) {
+	qrCodeBytes, err := qrcode.Encode(registrationId, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(qrCodeBytes), nil
+}
+
+// IsPaidTicket reports whether registering for a ticket type needs a payment.
+func IsPaidTicket(ticketType *dbModel.TicketType) bool {
+	return ticketType != nil && ticketType.Price > 0
+}
+
+// ConfirmRegistrations marks every pending registration matched by filter as
+// confirmed and issues its QR code. It returns the ids of the registrations
+// confirmed by this call, so repeated calls do not confirm twice.
+func ConfirmRegistrations(filter bson.M) ([]string, error) {
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pendingFilter := bson.M{"status": RegistrationStatusPendingPayment}
+	for key, value := range filter {
+		pendingFilter[key] = value
+	}
+	cursor, err := col.Find(ctx, pendingFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registrations: %w", err)
+	}
+	var pending []dbModel.RegistrationData
+	if err := cursor.All(ctx, &pending); err != nil {
+		return nil, fmt.Errorf("failed to decode registrations: %w", err)
+	}
+
+	confirmed := []string{}
+	now := time.Now().Unix()
+	for _, registration := range pending {
+		qrCode, err := GenerateTicketQR(registration.RegistrationId)
+		if err != nil {
+			return confirmed, fmt.Errorf("failed to generate QR code: %w", err)
+		}
+		result, err := col.UpdateOne(ctx, bson.M{
+			"registrationid": registration.RegistrationId,
+			"status":         RegistrationStatusPendingPayment,
+		}, bson.M{"$set": bson.M{
+			"status":      RegistrationStatusConfirmed,
+			"qrcode":      qrCode,
+			"confirmedAt": now,
+			"updatedAt":   now,
+		}})
+		if err != nil {
+			return confirmed, fmt.Errorf("failed to confirm registration: %w", err)
+		}
+		if result.ModifiedCount > 0 {
+			confirmed = append(confirmed, registration.RegistrationId)
+		}
+	}
+	return confirmed, nil
+}
+
+// CloseRegistrations moves every pending or confirmed registration matched by
+// filter to the given final status (cancelled, refunded, ...), revokes their
+// QR codes and gives their seats back to the ticket types. It returns the
+// registrations it closed.
+func CloseRegistrations(filter bson.M, status string) ([]dbModel.RegistrationData, error) {
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	activeStatuses := bson.A{RegistrationStatusPendingPayment, RegistrationStatusConfirmed}
+	cursor, err := col.Find(ctx, bson.M{"$and": bson.A{filter, bson.M{"status": bson.M{"$in": activeStatuses}}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registrations: %w", err)
+	}
+	var active []dbModel.RegistrationData
+	if err := cursor.All(ctx, &active); err != nil {
+		return nil, fmt.Errorf("failed to decode registrations: %w", err)
+	}
+
+	closed := []dbModel.RegistrationData{}
+	now := time.Now().Unix()
+	for _, registration := range active {
+		result, err := col.UpdateOne(ctx, bson.M{
+			"registrationid": registration.RegistrationId,
+			"status":         bson.M{"$in": activeStatuses},
+		}, bson.M{
+			"$set": bson.M{
+				"status":    status,
+				"isActive":  false,
+				"updatedAt": now,
+			},
+			// The ticket is no longer valid
+			"$unset": bson.M{"qrcode": ""},
+		})
+		if err != nil {
+			return closed, fmt.Errorf("failed to update registration: %w", err)
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		if registration.TicketTypeId != "" {
+			if err := ReleaseTickets(registration.UniqueId, registration.TicketTypeId, 1); err != nil {
+				fmt.Println("Error releasing ticket:", err)
+			}
+		}
+		registration.Status = status
+		closed = append(closed, registration)
+	}
+	return closed, nil
+}
+
+// PrepareTicketTypes validates the ticket types of a new event and fills in
+// ids and defaults. Events created without ticket types but with a legacy
+// registration amount get a single "General" ticket type at that price, with
+// the legacy 5 and 10 ticket combos as bundles.
+func PrepareTicketTypes(ticketTypes []dbModel.TicketType, legacy dbModel.RegistrationPricingCombo) ([]dbModel.TicketType, error) {
+	if len(ticketTypes) == 0 && legacy.RegistrationAmount > 0 {
+		general := dbModel.TicketType{
+			Name:  "General",
+			Price: currencyutils.ToMinor(legacy.RegistrationAmount, DefaultCurrency),
+		}
+		for size, price := range map[int]string{5: legacy.Combo5Price, 10: legacy.Combo10Price} {
+			if strings.TrimSpace(price) == "" {
+				continue
+			}
+			bundlePrice, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid combo price '%s'", price)
+			}
+			general.Bundles = append(general.Bundles, dbModel.TicketBundle{Size: size, Price: currencyutils.ToMinor(bundlePrice, DefaultCurrency)})
+		}
+		sort.Slice(general.Bundles, func(i, j int) bool { return general.Bundles[i].Size < general.Bundles[j].Size })
+		ticketTypes = []dbModel.TicketType{general}
+	}
+
+	prepared := make([]dbModel.TicketType, 0, len(ticketTypes))
+	for _, ticketType := range ticketTypes {
+		ticketType.TicketTypeId = uuid.New().String()
+		ticketType.SoldCount = 0
+		if err := normaliseTicketType(&ticketType); err != nil {
+			return nil, err
+		}
+		prepared = append(prepared, ticketType)
+	}
+	return prepared, nil
+}
+
+// MergeTicketTypes applies an edited list of ticket types onto the existing
+// ones. Sold counts are always kept from the stored ticket types, ticket types
+// that already have sales cannot be removed and their quantity cannot drop
+// below what has been sold.
+func MergeTicketTypes(existing []dbModel.TicketType, updated []dbModel.TicketType) ([]dbModel.TicketType, error) {
+	existingById := make(map[string]dbModel.TicketType, len(existing))
+	for _, ticketType := range existing {
+		existingById[ticketType.TicketTypeId] = ticketType
+	}
+
+	merged := make([]dbModel.TicketType, 0, len(updated))
+	seen := make(map[string]bool, len(updated))
+	for _, ticketType := range updated {
+		if stored, ok := existingById[ticketType.TicketTypeId]; ok && ticketType.TicketTypeId != "" {
+			ticketType.SoldCount = stored.SoldCount
+			if ticketType.Quantity > 0 && ticketType.Quantity < stored.SoldCount {
+				return nil, fmt.Errorf("quantity of ticket type '%s' cannot be less than the %d already sold", stored.Name, stored.SoldCount)
+			}
+			seen[ticketType.TicketTypeId] = true
+		} else {
+			ticketType.TicketTypeId = uuid.New().String()
+			ticketType.SoldCount = 0
+		}
+		if err := normaliseTicketType(&ticketType); err != nil {
+			return nil, err
+		}
+		merged = append(merged, ticketType)
+	}
+
+	for _, stored := range existing {
+		if !seen[stored.TicketTypeId] && stored.SoldCount > 0 {
+			return nil, fmt.Errorf("ticket type '%s' already has sales and cannot be removed", stored.Name)
+		}
+	}
+	return merged, nil
+}
+
+func normaliseTicketType(ticketType *dbModel.TicketType) error {
+	ticketType.Name = strings.TrimSpace(ticketType.Name)
+	if ticketType.Name == "" {
+		return fmt.Errorf("ticket type name is required")
+	}
+	if ticketType.Price < 0 {
+		return fmt.Errorf("price of ticket type '%s' cannot be negative", ticketType.Name)
+	}
+	if ticketType.Quantity < 0 {
+		return fmt.Errorf("quantity of ticket type '%s' cannot be negative", ticketType.Name)
+	}
+	if ticketType.SaleStartsAt > 0 && ticketType.SaleEndsAt > 0 && ticketType.SaleEndsAt <= ticketType.SaleStartsAt {
+		return fmt.Errorf("sale window of ticket type '%s' ends before it starts", ticketType.Name)
+	}
+	if ticketType.MinPerOrder < 0 || ticketType.MaxPerOrder < 0 {
+		return fmt.Errorf("per-order limits of ticket type '%s' cannot be negative", ticketType.Name)
+	}
+	if ticketType.MaxPerOrder > 0 && ticketType.MinPerOrder > ticketType.MaxPerOrder {
+		return fmt.Errorf("minimum per order of ticket type '%s' exceeds its maximum", ticketType.Name)
+	}
+	if ticketType.Quantity > 0 && ticketType.MinPerOrder > ticketType.Quantity {
+		return fmt.Errorf("minimum per order of ticket type '%s' exceeds its quantity", ticketType.Name)
+	}
+
+	for i := range ticketType.Bundles {
+		bundle := &ticketType.Bundles[i]
+		if bundle.Size < 2 {
+			return fmt.Errorf("bundles of ticket type '%s' must contain at least 2 tickets", ticketType.Name)
+		}
+		if bundle.Size > MaxTicketsPerOrder {
+			return fmt.Errorf("bundles of ticket type '%s' can contain at most %d tickets", ticketType.Name, MaxTicketsPerOrder)
+		}
+		if bundle.Price < 0 {
+			return fmt.Errorf("bundle price of ticket type '%s' cannot be negative", ticketType.Name)
+		}
+		if bundle.BundleId == "" {
+			bundle.BundleId = uuid.New().String()
+		}
+		bundle.Name = strings.TrimSpace(bundle.Name)
+		if bundle.Name == "" {
+			bundle.Name = fmt.Sprintf("%d tickets", bundle.Size)
+		}
+	}
+
+	if strings.TrimSpace(ticketType.Currency) == "" {
+		ticketType.Currency = DefaultCurrency
+	}
+	currency, err := currencyutils.Normalise(ticketType.Currency)
+	if err != nil {
+		return fmt.Errorf("ticket type '%s': %w", ticketType.Name, err)
+	}
+	ticketType.Currency = currency
+	switch ticketType.Visibility {
+	case "":
+		ticketType.Visibility = TicketVisibilityPublic
+	case TicketVisibilityPublic, TicketVisibilityHidden:
+	default:
+		return fmt.Errorf("invalid visibility '%s' for ticket type '%s'", ticketType.Visibility, ticketType.Name)
+	}
+	return nil
+}
+
+// VisibleTicketTypes returns the ticket types a user may see. Hidden ticket
+// types are only listed for admins.
+func VisibleTicketTypes(ticketTypes []dbModel.TicketType, isAdmin bool) []dbModel.TicketType {
+	if isAdmin {
+		return ticketTypes
+	}
+	visible := []dbModel.TicketType{}
+	for _, ticketType := range ticketTypes {
+		if ticketType.Visibility != TicketVisibilityHidden {
+			visible = append(visible, ticketType)
+		}
+	}
+	return visible
+}
+
+// ApplyDisplayCurrency fills in the approximate prices of ticket types in the
+// viewer's currency. Prices that cannot be converted are left without one.
+func ApplyDisplayCurrency(ticketTypes []dbModel.TicketType, currency string, converter *currencyutils.Converter) {
+	for i := range ticketTypes {
+		ticketType := &ticketTypes[i]
+		price, err := converter.Convert(ticketType.Price, ticketType.Currency, currency)
+		if err != nil {
+			continue
+		}
+		ticketType.DisplayPrice = price
+		ticketType.DisplayCurrency = currency
+		for j := range ticketType.Bundles {
+			ticketType.Bundles[j].DisplayPrice, _ = converter.Convert(ticketType.Bundles[j].Price, ticketType.Currency, currency)
+		}
+	}
+}
+
+// SelectTicketType resolves the ticket type chosen during registration. When
+// no ticket type is given and the event has exactly one, that one is used.
+// Events without any ticket types return nil.
+func SelectTicketType(event dbModel.Event, ticketTypeId string) (*dbModel.TicketType, error) {
+	if len(event.TicketTypes) == 0 {
+		return nil, nil
+	}
+	if ticketTypeId == "" {
+		if len(event.TicketTypes) == 1 {
+			return &event.TicketTypes[0], nil
+		}
+		return nil, ErrTicketTypeRequired
+	}
+	for i := range event.TicketTypes {
+		if event.TicketTypes[i].TicketTypeId == ticketTypeId {
+			return &event.TicketTypes[i], nil
+		}
+	}
+	return nil, ErrTicketTypeNotFound
+}
+
+// TicketQuote is the number of tickets and the amount, in minor units, to
+// charge for a selection of a ticket type, either as single tickets or as
+// bundles.
+type TicketQuote struct {
+	TicketCount int
+	Amount      int64
+	Currency    string
+	Bundle      *dbModel.TicketBundle
+	BundleCount int
+}
+
+// QuoteTickets prices a purchase of a ticket type. When bundleId is given,
+// bundleCount bundles are bought at the bundle price, otherwise quantity
+// single tickets are bought at the ticket price. Orders are capped at
+// MaxTicketsPerOrder tickets.
+func QuoteTickets(ticketType dbModel.TicketType, bundleId string, bundleCount int, quantity int) (TicketQuote, error) {
+	quote := TicketQuote{Currency: ticketType.Currency}
+	if bundleId == "" {
+		if quantity <= 0 {
+			return quote, fmt.Errorf("quantity must be at least 1")
+		}
+		if quantity > MaxTicketsPerOrder {
+			return quote, ErrTooManyTickets
+		}
+		amount, err := multiplyPrice(ticketType.Price, quantity)
+		if err != nil {
+			return quote, err
+		}
+		quote.TicketCount = quantity
+		quote.Amount = amount
+		return quote, nil
+	}
+
+	if bundleCount <= 0 {
+		bundleCount = 1
+	}
+	for i := range ticketType.Bundles {
+		if ticketType.Bundles[i].BundleId == bundleId {
+			bundle := ticketType.Bundles[i]
+			if bundle.Size > MaxTicketsPerOrder || bundleCount > MaxTicketsPerOrder || bundle.Size*bundleCount > MaxTicketsPerOrder {
+				return quote, ErrTooManyTickets
+			}
+			amount, err := multiplyPrice(bundle.Price, bundleCount)
+			if err != nil {
+				return quote, err
+			}
+			quote.Bundle = &bundle
+			quote.BundleCount = bundleCount
+			quote.TicketCount = bundle.Size * bundleCount
+			quote.Amount = amount
+			return quote, nil
+		}
+	}
+	return quote, fmt.Errorf("bundle not found for ticket type '%s'", ticketType.Name)
+}
+
+// multiplyPrice is price times count, failing instead of overflowing.
+func multiplyPrice(price int64, count int) (int64, error) {
+	if price > 0 && int64(count) > math.MaxInt64/price {
+		return 0, ErrAmountTooLarge
+	}
+	return price * int64(count), nil
+}
+
+// CheckTicketAvailability verifies that the given quantity of a ticket type can
+// be bought right now, honouring the sale window, per-order limits and the
+// remaining seats.
+func CheckTicketAvailability(ticketType dbModel.TicketType, quantity int, now int64) error {
+	if ticketType.SaleStartsAt > 0 && now < ticketType.SaleStartsAt {
+		return ErrTicketNotOnSale
+	}
+	if ticketType.SaleEndsAt > 0 && now > ticketType.SaleEndsAt {
+		return ErrTicketNotOnSale
+	}
+	if ticketType.MinPerOrder > 0 && quantity < ticketType.MinPerOrder {
+		return fmt.Errorf("at least %d tickets of '%s' must be bought per order", ticketType.MinPerOrder, ticketType.Name)
+	}
+	if ticketType.MaxPerOrder > 0 && quantity > ticketType.MaxPerOrder {
+		return fmt.Errorf("at most %d tickets of '%s' can be bought per order", ticketType.MaxPerOrder, ticketType.Name)
+	}
+	if ticketType.Quantity > 0 && ticketType.SoldCount+quantity > ticketType.Quantity {
+		return ErrTicketSoldOut
+	}
+	return nil
+}
+
+// ReserveTickets atomically adds quantity to the sold count of a ticket type,
+// failing with ErrTicketSoldOut when not enough seats are left.
+func ReserveTickets(eventId string, ticketType dbModel.TicketType, quantity int) error {
+	db, col, err := mongoSetup.ConnectMongo("events")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	match := bson.M{"ticketTypeId": ticketType.TicketTypeId}
+	if ticketType.Quantity > 0 {
+		match["quantity"] = ticketType.Quantity
+		match["soldCount"] = bson.M{"$lte": ticketType.Quantity - quantity}
+	}
+	filter := bson.M{
+		"uniqueId":    eventId,
+		"ticketTypes": bson.M{"$elemMatch": match},
+	}
+	update := bson.M{"$inc": bson.M{
+		"ticketTypes.$.soldCount": quantity,
+		"registrationCount":       quantity,
+		"version":                 1,
+	}}
+
+	result, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to reserve tickets: %w", err)
+	}
+	if result.ModifiedCount == 0 {
+		return ErrTicketSoldOut
+	}
+	return nil
+}
+
+// ReleaseTickets gives back previously reserved seats of a ticket type.
+func ReleaseTickets(eventId string, ticketTypeId string, quantity int) error {
+	db, col, err := mongoSetup.ConnectMongo("events")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"uniqueId":    eventId,
+		"ticketTypes": bson.M{"$elemMatch": bson.M{"ticketTypeId": ticketTypeId, "soldCount": bson.M{"$gte": quantity}}},
+	}
+	update := bson.M{"$inc": bson.M{
+		"ticketTypes.$.soldCount": -quantity,
+		"registrationCount":       -quantity,
+		"version":                 1,
+	}}
+	if _, err := col.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to release tickets: %w", err)
+	}
+	return nil
+}
+
+// PrepareCancellationPolicy validates refund tiers and orders them from the
+// earliest cancellation to the latest.
+func PrepareCancellationPolicy(policy []dbModel.RefundTier) ([]dbModel.RefundTier, error) {
+	seen := map[int]bool{}
+	for _, tier := range policy {
+		if tier.DaysBeforeEvent < 0 {
+			return nil, fmt.Errorf("daysBeforeEvent cannot be negative")
+		}
+		if tier.Percent < 0 || tier.Percent > 100 {
+			return nil, fmt.Errorf("refund percent must be between 0 and 100")
+		}
+		if seen[tier.DaysBeforeEvent] {
+			return nil, fmt.Errorf("duplicate refund tier for %d days before the event", tier.DaysBeforeEvent)
+		}
+		seen[tier.DaysBeforeEvent] = true
+	}
+	sorted := append([]dbModel.RefundTier{}, policy...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].DaysBeforeEvent > sorted[j].DaysBeforeEvent })
+	return sorted, nil
+}
+
+// RefundPercent returns the share of the ticket price refunded when a
+// registration is cancelled at now. The first tier whose deadline has not
+// passed applies; without a matching tier nothing is refunded.
+func RefundPercent(policy []dbModel.RefundTier, eventDate int64, now int64) int {
+	sorted, err := PrepareCancellationPolicy(policy)
+	if err != nil {
+		return 0
+	}
+	for _, tier := range sorted {
+		if now <= eventDate-int64(tier.DaysBeforeEvent)*24*60*60 {
+			return tier.Percent
+		}
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package eventutils
+
+import (
+	dbModel "em_backend/models/db"
+	"testing"
+)
+
+func TestRefundPercent(t *testing.T) {
+	const day = 24 * 60 * 60
+	eventDate := int64(100 * day)
+	policy := []dbModel.RefundTier{
+		{DaysBeforeEvent: 1, Percent: 25},
+		{DaysBeforeEvent: 14, Percent: 100},
+		{DaysBeforeEvent: 7, Percent: 50},
+	}
+	tests := []struct {
+		name   string
+		policy []dbModel.RefundTier
+		now    int64
+		want   int
+	}{
+		{"well before every deadline", policy, eventDate - 30*day, 100},
+		{"on the first deadline", policy, eventDate - 14*day, 100},
+		{"just after the first deadline", policy, eventDate - 14*day + 1, 50},
+		{"between the last deadlines", policy, eventDate - 3*day, 25},
+		{"after the last deadline", policy, eventDate - day/2, 0},
+		{"after the event", policy, eventDate + day, 0},
+		{"no policy", nil, eventDate - 30*day, 0},
+		{"invalid policy", []dbModel.RefundTier{{DaysBeforeEvent: 7, Percent: 150}}, eventDate - 30*day, 0},
+		{"same day tier", []dbModel.RefundTier{{DaysBeforeEvent: 0, Percent: 10}}, eventDate, 10},
+	}
+	for _, test := range tests {
+		if got := RefundPercent(test.policy, eventDate, test.now); got != test.want {
+			t.Errorf("%s: RefundPercent = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
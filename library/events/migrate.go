@@ -0,0 +1,112 @@
+package eventutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	dbModel "em_backend/models/db"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateComboPrices gives events that only have the legacy combo prices a
+// "General" ticket type with the same price and bundles, as new events
+// created with combo prices get. Events already migrated are skipped, so it
+// is safe to run on every start.
+func MigrateComboPrices() error {
+	db, col, err := mongoSetup.ConnectMongo("events")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	withoutTicketTypes := bson.M{"$or": bson.A{
+		bson.M{"ticketTypes": bson.M{"$exists": false}},
+		bson.M{"ticketTypes": nil},
+		bson.M{"ticketTypes": bson.M{"$size": 0}},
+	}}
+	cursor, err := col.Find(ctx, bson.M{"$and": bson.A{
+		bson.M{"comboPrices.registrationAmount": bson.M{"$gt": 0}},
+		withoutTicketTypes,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to fetch events to migrate: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var legacy struct {
+			UniqueId          string                           `bson:"uniqueId"`
+			ComboPrices       dbModel.RegistrationPricingCombo `bson:"comboPrices"`
+			RegistrationCount int                              `bson:"registrationCount"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		ticketTypes, err := PrepareTicketTypes(nil, legacy.ComboPrices)
+		if err != nil {
+			fmt.Printf("Skipping combo prices of event %s: %v\n", legacy.UniqueId, err)
+			continue
+		}
+		// Tickets sold before count against the new ticket type
+		ticketTypes[0].SoldCount = legacy.RegistrationCount
+
+		_, err = col.UpdateOne(ctx,
+			bson.M{"$and": bson.A{bson.M{"uniqueId": legacy.UniqueId}, withoutTicketTypes}},
+			bson.M{
+				"$set":   bson.M{"ticketTypes": ticketTypes},
+				"$unset": bson.M{"comboPrices": ""},
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to migrate combo prices of event %s: %w", legacy.UniqueId, err)
+		}
+	}
+	return cursor.Err()
+}
+
+// MigrateRegistrationStatus marks registrations made before registrations
+// had a status as confirmed and active, so status filters and the unique
+// active registration index cover them. When a user registered for the same
+// event more than once, only the first registration stays active.
+func MigrateRegistrationStatus() error {
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, bson.M{"status": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to fetch registrations to migrate: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		set := bson.M{
+			"status":       RegistrationStatusConfirmed,
+			"isActive":     true,
+			"groupOrderId": "",
+		}
+		_, err := col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+		if mongo.IsDuplicateKeyError(err) {
+			set["isActive"] = false
+			_, err = col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate registration status: %w", err)
+		}
+	}
+	return cursor.Err()
+}
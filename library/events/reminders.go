@@ -0,0 +1,70 @@
+package eventutils
+
+import (
+	commonutils "em_backend/library/common"
+	dbModel "em_backend/models/db"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Reminders go out 7 days, 1 day and 1 hour before an event by default
+var defaultReminderOffsets = []int{7 * 24 * 60, 24 * 60, 60}
+
+// MaxReminderOffset is the earliest a reminder can be sent, in minutes
+// before the event.
+const MaxReminderOffset = 60 * 24 * 60
+
+// PrepareReminderOffsets validates reminder offsets, in minutes before the
+// event, and orders them from the earliest reminder to the latest.
+func PrepareReminderOffsets(offsets []int) ([]int, error) {
+	seen := map[int]bool{}
+	for _, offset := range offsets {
+		if offset <= 0 || offset > MaxReminderOffset {
+			return nil, fmt.Errorf("reminder offsets must be between 1 and %d minutes", MaxReminderOffset)
+		}
+		if seen[offset] {
+			return nil, fmt.Errorf("duplicate reminder %d minutes before the event", offset)
+		}
+		seen[offset] = true
+	}
+	sorted := append([]int{}, offsets...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	return sorted, nil
+}
+
+// ReminderOffsets returns the reminders of an event: its own, or the
+// platform's from REMINDER_OFFSETS (comma separated minutes) when it has none.
+func ReminderOffsets(event dbModel.Event) []int {
+	if event.RemindersDisabled {
+		return nil
+	}
+	if len(event.ReminderOffsets) > 0 {
+		return event.ReminderOffsets
+	}
+	return DefaultReminderOffsets()
+}
+
+// DefaultReminderOffsets are the reminders of events without their own.
+func DefaultReminderOffsets() []int {
+	configured := strings.TrimSpace(commonutils.LoadEnv("REMINDER_OFFSETS"))
+	if configured == "" {
+		return defaultReminderOffsets
+	}
+	var offsets []int
+	for _, value := range strings.Split(configured, ",") {
+		offset, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			fmt.Println("Invalid REMINDER_OFFSETS, using the default reminders")
+			return defaultReminderOffsets
+		}
+		offsets = append(offsets, offset)
+	}
+	prepared, err := PrepareReminderOffsets(offsets)
+	if err != nil {
+		fmt.Println("Invalid REMINDER_OFFSETS, using the default reminders:", err)
+		return defaultReminderOffsets
+	}
+	return prepared
+}
@@ -0,0 +1,415 @@
+package invoiceutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	invoiceModel "em_backend/models/invoice"
+	paymentModel "em_backend/models/payment"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultInvoicePrefix = "INV"
+	// Services of organising events and admission to them
+	defaultSACCode = "998596"
+	maxGSTRate     = 28
+)
+
+var (
+	ErrOrganizerNameRequired  = errors.New("organizer name is required")
+	ErrInvalidGSTIN           = errors.New("invalid GSTIN")
+	ErrInvalidStateCode       = errors.New("state code must be the two digit GST state code")
+	ErrInvalidGSTRate         = errors.New("GST rate must be between 0 and 28")
+	ErrGSTRateWithoutGSTIN    = errors.New("GST can only be charged by organizers with a GSTIN")
+	ErrInvalidPlatformFee     = errors.New("platform fee must be between 0 and 100 percent")
+	ErrInvalidBrandColor      = errors.New("brand colour must be a hex colour like #007BFF")
+	ErrInvalidLogoURL         = errors.New("logo URL must be an https URL")
+	ErrOrganizerNotFound      = errors.New("organizer not found")
+	ErrOrganizerNotConfigured = errors.New("event has no organizer and DEFAULT_ORGANIZER_ID is not set")
+	ErrOrderNotInvoiceable    = errors.New("only paid orders can be invoiced")
+	ErrInvoicePending         = errors.New("invoice is being issued, try again shortly")
+)
+
+// gstinPattern is the 15 character GSTIN: state code, PAN, entity number, Z
+// and a check character.
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+var stateCodePattern = regexp.MustCompile(`^[0-9]{2}$`)
+
+var brandColorPattern = regexp.MustCompile(`^#[0-9A-F]{6}$`)
+
+// Invoice numbers and financial years follow Indian time
+var invoiceLocation = time.FixedZone("IST", 5*60*60+30*60)
+
+// ValidateOrganizer normalises an organizer and checks its billing details.
+func ValidateOrganizer(organizer *invoiceModel.Organizer) error {
+	organizer.Name = strings.TrimSpace(organizer.Name)
+	organizer.GSTIN = strings.ToUpper(strings.TrimSpace(organizer.GSTIN))
+	organizer.PAN = strings.ToUpper(strings.TrimSpace(organizer.PAN))
+	organizer.StateCode = strings.TrimSpace(organizer.StateCode)
+	organizer.InvoicePrefix = strings.ToUpper(strings.TrimSpace(organizer.InvoicePrefix))
+	organizer.BrandColor = strings.ToUpper(strings.TrimSpace(organizer.BrandColor))
+	organizer.LogoURL = strings.TrimSpace(organizer.LogoURL)
+	organizer.SupportEmail = strings.TrimSpace(organizer.SupportEmail)
+
+	if organizer.Name == "" {
+		return ErrOrganizerNameRequired
+	}
+	if !stateCodePattern.MatchString(organizer.StateCode) {
+		return ErrInvalidStateCode
+	}
+	if organizer.GSTIN != "" {
+		if !gstinPattern.MatchString(organizer.GSTIN) || organizer.GSTIN[:2] != organizer.StateCode {
+			return ErrInvalidGSTIN
+		}
+	}
+	if organizer.GSTRate < 0 || organizer.GSTRate > maxGSTRate {
+		return ErrInvalidGSTRate
+	}
+	if organizer.GSTRate > 0 && organizer.GSTIN == "" {
+		return ErrGSTRateWithoutGSTIN
+	}
+	if organizer.PlatformFeePercent < 0 || organizer.PlatformFeePercent > 100 {
+		return ErrInvalidPlatformFee
+	}
+	if organizer.BrandColor != "" && !brandColorPattern.MatchString(organizer.BrandColor) {
+		return ErrInvalidBrandColor
+	}
+	// Logos are loaded by mail clients, which block plain http images
+	if organizer.LogoURL != "" && !strings.HasPrefix(organizer.LogoURL, "https://") {
+		return ErrInvalidLogoURL
+	}
+	if organizer.InvoicePrefix == "" {
+		organizer.InvoicePrefix = defaultInvoicePrefix
+	}
+	if organizer.SACCode == "" {
+		organizer.SACCode = defaultSACCode
+	}
+	return nil
+}
+
+// ValidateBillingDetails normalises the buyer details given with an order.
+func ValidateBillingDetails(details *invoiceModel.BillingDetails) error {
+	details.GSTIN = strings.ToUpper(strings.TrimSpace(details.GSTIN))
+	details.StateCode = strings.TrimSpace(details.StateCode)
+
+	if details.GSTIN != "" {
+		if !gstinPattern.MatchString(details.GSTIN) {
+			return ErrInvalidGSTIN
+		}
+		// A GSTIN identifies the buyer's state
+		if details.StateCode == "" {
+			details.StateCode = details.GSTIN[:2]
+		}
+		if details.GSTIN[:2] != details.StateCode {
+			return ErrInvalidGSTIN
+		}
+	}
+	if details.StateCode != "" && !stateCodePattern.MatchString(details.StateCode) {
+		return ErrInvalidStateCode
+	}
+	return nil
+}
+
+// FetchOrganizer loads an organizer by its id.
+func FetchOrganizer(organizerId string) (invoiceModel.Organizer, error) {
+	var organizer invoiceModel.Organizer
+	result, err := mongoSetup.FindOneDoc("organizers", bson.M{"organizerId": organizerId}, bson.M{})
+	if err != nil {
+		return organizer, err
+	}
+	if err := result.Decode(&organizer); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return organizer, ErrOrganizerNotFound
+		}
+		return organizer, err
+	}
+	return organizer, nil
+}
+
+// FetchInvoice loads the invoice of an order.
+func FetchInvoice(orderId string) (invoiceModel.Invoice, error) {
+	var invoice invoiceModel.Invoice
+	result, err := mongoSetup.FindOneDoc("invoices", bson.M{"orderId": orderId}, bson.M{})
+	if err != nil {
+		return invoice, err
+	}
+	err = result.Decode(&invoice)
+	return invoice, err
+}
+
+// FinancialYear returns the Indian financial year (April to March) of t, e.g.
+// "2024-25".
+func FinancialYear(t time.Time) string {
+	t = t.In(invoiceLocation)
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// nextInvoiceNumber allocates the next number in the organizer's series for
+// the financial year. Series restart every financial year. Use
+// claimInvoiceNumber, which allocates one number per order.
+func nextInvoiceNumber(organizer invoiceModel.Organizer, financialYear string) (string, error) {
+	db, col, err := mongoSetup.ConnectMongo("counters")
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err = col.FindOneAndUpdate(ctx,
+		bson.M{"_id": fmt.Sprintf("invoice:%s:%s", organizer.OrganizerId, financialYear)},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+	return fmt.Sprintf("%s/%s/%05d", organizer.InvoicePrefix, financialYear, counter.Seq), nil
+}
+
+// Claims of invoices that were not numbered within this time were abandoned
+// and can be taken over
+const invoiceClaimTimeout = time.Minute
+
+type invoiceClaim struct {
+	OrderId       string `bson:"orderId"`
+	InvoiceNumber string `bson:"invoiceNumber,omitempty"`
+	ClaimedAt     int64  `bson:"claimedAt"`
+}
+
+// claimInvoiceNumber returns the number of the invoice of an order. The order
+// is claimed first and only the holder of the claim allocates a number, which
+// is kept on the claim, so concurrent or failed attempts to issue the invoice
+// never leave gaps in the organizer's series.
+func claimInvoiceNumber(orderId string, organizer invoiceModel.Organizer, financialYear string) (string, error) {
+	db, col, err := mongoSetup.ConnectMongo("invoiceClaims")
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	_, err = col.InsertOne(ctx, invoiceClaim{OrderId: orderId, ClaimedAt: now})
+	if mongo.IsDuplicateKeyError(err) {
+		var claim invoiceClaim
+		if err := col.FindOne(ctx, bson.M{"orderId": orderId}).Decode(&claim); err != nil {
+			return "", fmt.Errorf("failed to fetch invoice claim: %w", err)
+		}
+		if claim.InvoiceNumber != "" {
+			return claim.InvoiceNumber, nil
+		}
+		// Take over a claim whose holder gave up before numbering it
+		result, err := col.UpdateOne(ctx, bson.M{
+			"orderId":       orderId,
+			"invoiceNumber": bson.M{"$exists": false},
+			"claimedAt":     bson.M{"$lte": now - int64(invoiceClaimTimeout/time.Second)},
+		}, bson.M{"$set": bson.M{"claimedAt": now}})
+		if err != nil {
+			return "", fmt.Errorf("failed to take over invoice claim: %w", err)
+		}
+		if result.ModifiedCount == 0 {
+			return "", ErrInvoicePending
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("failed to claim invoice: %w", err)
+	}
+
+	invoiceNumber, err := nextInvoiceNumber(organizer, financialYear)
+	if err != nil {
+		return "", err
+	}
+	if _, err := col.UpdateOne(ctx, bson.M{"orderId": orderId}, bson.M{"$set": bson.M{"invoiceNumber": invoiceNumber}}); err != nil {
+		return "", fmt.Errorf("failed to save invoice number %s: %w", invoiceNumber, err)
+	}
+	return invoiceNumber, nil
+}
+
+// splitTax splits a tax inclusive total into the taxable value and the tax.
+func splitTax(total int64, rate float64) (int64, int64) {
+	taxable := int64(math.Round(float64(total) * 100 / (100 + rate)))
+	return taxable, total - taxable
+}
+
+// BuildInvoice computes the invoice of a paid order without numbering or
+// storing it. Ticket prices include GST, so the tax is carved out of what the
+// buyer paid.
+func BuildInvoice(order paymentModel.OrderDetails, organizer invoiceModel.Organizer, eventName string, ticketTypeName string, now time.Time) invoiceModel.Invoice {
+	buyer := order.BillingDetails
+	if buyer.Email == "" {
+		buyer.Email = order.UserEmail
+	}
+
+	// Supply is within the organizer's state unless the buyer is elsewhere
+	placeOfSupply := organizer.StateCode
+	if buyer.StateCode != "" {
+		placeOfSupply = buyer.StateCode
+	}
+
+	quantity := order.TicketCount
+	if quantity < 1 {
+		quantity = 1
+	}
+	subtotal := order.Subtotal
+	if subtotal == 0 {
+		subtotal = order.Amount + order.DiscountAmount
+	}
+	description := eventName
+	if ticketTypeName != "" {
+		description = fmt.Sprintf("%s - %s ticket", eventName, ticketTypeName)
+	}
+
+	invoice := invoiceModel.Invoice{
+		InvoiceId:     uuid.New().String(),
+		DocumentType:  invoiceModel.DocumentTypeReceipt,
+		FinancialYear: FinancialYear(now),
+		OrganizerId:   organizer.OrganizerId,
+		Seller:        organizer,
+		Buyer:         buyer,
+		OrderId:       order.OrderID,
+		PaymentId:     order.PaymentId,
+		EventId:       order.EventId,
+		EventName:     eventName,
+		PlaceOfSupply: placeOfSupply,
+		Items: []invoiceModel.InvoiceItem{{
+			Description: description,
+			SACCode:     organizer.SACCode,
+			Quantity:    quantity,
+			UnitPrice:   subtotal / int64(quantity),
+			Amount:      subtotal,
+		}},
+		Currency:      order.Currency,
+		Subtotal:      subtotal,
+		Discount:      order.DiscountAmount,
+		TaxableAmount: order.Amount,
+		Total:         order.Amount,
+		IssuedAt:      now.Unix(),
+	}
+
+	if organizer.GSTIN == "" {
+		return invoice
+	}
+	invoice.DocumentType = invoiceModel.DocumentTypeTaxInvoice
+	if organizer.GSTRate == 0 {
+		return invoice
+	}
+
+	taxable, tax := splitTax(order.Amount, organizer.GSTRate)
+	invoice.TaxableAmount = taxable
+	if placeOfSupply == organizer.StateCode {
+		invoice.CGSTRate = organizer.GSTRate / 2
+		invoice.SGSTRate = organizer.GSTRate / 2
+		invoice.CGST = tax / 2
+		invoice.SGST = tax - invoice.CGST
+	} else {
+		invoice.IGSTRate = organizer.GSTRate
+		invoice.IGST = tax
+	}
+	return invoice
+}
+
+// EventOrganizer returns the organizer of an event, falling back to
+// DEFAULT_ORGANIZER_ID for events without one.
+func EventOrganizer(organizerId string) (invoiceModel.Organizer, error) {
+	if organizerId == "" {
+		organizerId = commonutils.LoadEnv("DEFAULT_ORGANIZER_ID")
+	}
+	if organizerId == "" {
+		return invoiceModel.Organizer{}, ErrOrganizerNotConfigured
+	}
+	return FetchOrganizer(organizerId)
+}
+
+// GenerateInvoice issues the invoice of a paid order, numbering it in the
+// organizer's series. An order is invoiced once; later calls return the
+// existing invoice.
+func GenerateInvoice(order paymentModel.OrderDetails) (invoiceModel.Invoice, error) {
+	if existing, err := FetchInvoice(order.OrderID); err == nil {
+		return existing, nil
+	}
+	if order.Status != "paid" && order.Status != "refunded" {
+		return invoiceModel.Invoice{}, ErrOrderNotInvoiceable
+	}
+
+	event, err := eventutils.FetchEvent(order.EventId)
+	if err != nil {
+		return invoiceModel.Invoice{}, fmt.Errorf("failed to fetch event: %w", err)
+	}
+	organizer, err := EventOrganizer(event.OrganizerId)
+	if err != nil {
+		return invoiceModel.Invoice{}, err
+	}
+	ticketTypeName := ""
+	for _, ticketType := range event.TicketTypes {
+		if ticketType.TicketTypeId == order.TicketTypeId {
+			ticketTypeName = ticketType.Name
+		}
+	}
+
+	// Invoices are dated when the payment was received
+	issuedAt := time.Now()
+	if order.PaidAt > 0 {
+		issuedAt = time.Unix(order.PaidAt, 0)
+	}
+	invoice := BuildInvoice(order, organizer, event.EventName, ticketTypeName, issuedAt)
+	invoice.InvoiceNumber, err = claimInvoiceNumber(order.OrderID, organizer, invoice.FinancialYear)
+	if err != nil {
+		return invoice, err
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("invoices")
+	if err != nil {
+		return invoice, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := col.InsertOne(ctx, invoice); err != nil {
+		// Another request invoiced the order first
+		if mongo.IsDuplicateKeyError(err) {
+			return FetchInvoice(order.OrderID)
+		}
+		return invoice, fmt.Errorf("failed to save invoice: %w", err)
+	}
+	return invoice, nil
+}
+
+// InvoiceFileName is the file name invoices are downloaded and attached as.
+func InvoiceFileName(invoice invoiceModel.Invoice) string {
+	return fmt.Sprintf("%s.pdf", strings.ReplaceAll(invoice.InvoiceNumber, "/", "-"))
+}
+
+// InvoiceAttachment returns the PDF invoice of an order, issuing it if
+// needed, for downloads and confirmation emails.
+func InvoiceAttachment(order paymentModel.OrderDetails) (string, []byte, error) {
+	invoice, err := GenerateInvoice(order)
+	if err != nil {
+		return "", nil, err
+	}
+	return InvoiceFileName(invoice), RenderInvoicePDF(invoice), nil
+}
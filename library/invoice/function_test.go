@@ -0,0 +1,97 @@
+package invoiceutils
+
+import (
+	invoiceModel "em_backend/models/invoice"
+	paymentModel "em_backend/models/payment"
+	"testing"
+	"time"
+)
+
+func TestSplitTax(t *testing.T) {
+	tests := []struct {
+		total       int64
+		rate        float64
+		wantTaxable int64
+		wantTax     int64
+	}{
+		{11800, 18, 10000, 1800},
+		{100, 18, 85, 15},
+		{999, 5, 951, 48},
+		{50000, 28, 39063, 10937},
+		{1, 18, 1, 0},
+		{0, 18, 0, 0},
+		{11800, 0, 11800, 0},
+	}
+	for _, test := range tests {
+		taxable, tax := splitTax(test.total, test.rate)
+		if taxable != test.wantTaxable || tax != test.wantTax {
+			t.Errorf("splitTax(%d, %v) = %d, %d, want %d, %d", test.total, test.rate, taxable, tax, test.wantTaxable, test.wantTax)
+		}
+	}
+}
+
+func TestBuildInvoiceTax(t *testing.T) {
+	tests := []struct {
+		name         string
+		amount       int64
+		gstin        string
+		rate         float64
+		buyerState   string
+		wantType     string
+		wantTaxable  int64
+		wantCGST     int64
+		wantSGST     int64
+		wantIGST     int64
+		wantCGSTRate float64
+	}{
+		{"intra-state even split", 11800, "29ABCDE1234F1Z5", 18, "", invoiceModel.DocumentTypeTaxInvoice, 10000, 900, 900, 0, 9},
+		{"intra-state odd paise go to SGST", 125, "29ABCDE1234F1Z5", 18, "29", invoiceModel.DocumentTypeTaxInvoice, 106, 9, 10, 0, 9},
+		{"inter-state", 125, "29ABCDE1234F1Z5", 18, "27", invoiceModel.DocumentTypeTaxInvoice, 106, 0, 0, 19, 0},
+		{"no GSTIN", 11800, "", 18, "", invoiceModel.DocumentTypeReceipt, 11800, 0, 0, 0, 0},
+		{"zero rate", 11800, "29ABCDE1234F1Z5", 0, "", invoiceModel.DocumentTypeTaxInvoice, 11800, 0, 0, 0, 0},
+	}
+	for _, test := range tests {
+		order := paymentModel.OrderDetails{
+			OrderID:     "order_1",
+			Amount:      test.amount,
+			Currency:    "INR",
+			TicketCount: 1,
+		}
+		order.BillingDetails.StateCode = test.buyerState
+		organizer := invoiceModel.Organizer{GSTIN: test.gstin, GSTRate: test.rate, StateCode: "29"}
+
+		invoice := BuildInvoice(order, organizer, "Event", "", time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC))
+		if invoice.DocumentType != test.wantType {
+			t.Errorf("%s: document type %q, want %q", test.name, invoice.DocumentType, test.wantType)
+		}
+		if invoice.TaxableAmount != test.wantTaxable || invoice.CGST != test.wantCGST || invoice.SGST != test.wantSGST || invoice.IGST != test.wantIGST {
+			t.Errorf("%s: taxable %d, CGST %d, SGST %d, IGST %d, want %d, %d, %d, %d", test.name,
+				invoice.TaxableAmount, invoice.CGST, invoice.SGST, invoice.IGST,
+				test.wantTaxable, test.wantCGST, test.wantSGST, test.wantIGST)
+		}
+		if invoice.CGSTRate != test.wantCGSTRate || invoice.SGSTRate != test.wantCGSTRate {
+			t.Errorf("%s: CGST rate %v, SGST rate %v, want %v", test.name, invoice.CGSTRate, invoice.SGSTRate, test.wantCGSTRate)
+		}
+		if sum := invoice.TaxableAmount + invoice.CGST + invoice.SGST + invoice.IGST; sum != invoice.Total {
+			t.Errorf("%s: taxable and tax add up to %d, total is %d", test.name, sum, invoice.Total)
+		}
+	}
+}
+
+func TestFinancialYear(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2024, time.April, 1, 0, 0, 0, 0, invoiceLocation), "2024-25"},
+		{time.Date(2024, time.March, 31, 23, 59, 0, 0, invoiceLocation), "2023-24"},
+		// Still 31 March in UTC, already April in India
+		{time.Date(2024, time.March, 31, 20, 0, 0, 0, time.UTC), "2024-25"},
+		{time.Date(2099, time.December, 1, 0, 0, 0, 0, invoiceLocation), "2099-00"},
+	}
+	for _, test := range tests {
+		if got := FinancialYear(test.at); got != test.want {
+			t.Errorf("FinancialYear(%v) = %q, want %q", test.at, got, test.want)
+		}
+	}
+}
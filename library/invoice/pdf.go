@@ -0,0 +1,318 @@
+package invoiceutils
+
+import (
+	"bytes"
+	currencyutils "em_backend/library/currency"
+	invoiceModel "em_backend/models/invoice"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A4 in points
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 50
+	lineHeight   = 14
+	columnGap    = 6
+	fontRegular  = "F1"
+	fontBold     = "F2"
+	fontSize     = 10
+	fontSizeHead = 16
+)
+
+// pdfWriter lays out lines of text on A4 pages using the standard Helvetica
+// fonts, which every PDF reader has, so no fonts need to be embedded.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     int
+}
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{}
+	w.newPage()
+	return w
+}
+
+func (w *pdfWriter) newPage() {
+	w.pages = append(w.pages, &bytes.Buffer{})
+	w.y = pageHeight - pageMargin
+}
+
+// winAnsiExtras maps the characters WinAnsiEncoding places in 0x80-0x9F, where
+// Latin-1 has control codes, to their byte.
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// winAnsiByte returns the WinAnsiEncoding byte of a character, false when the
+// standard fonts cannot show it.
+func winAnsiByte(r rune) (byte, bool) {
+	switch {
+	case r >= 32 && r <= 126, r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	c, ok := winAnsiExtras[r]
+	return c, ok
+}
+
+// pdfEscape makes text safe inside a PDF string. The fonts use
+// WinAnsiEncoding, so Latin-1 and the usual typographic punctuation are
+// written as octal escapes and anything else is replaced.
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		c, ok := winAnsiByte(r)
+		switch {
+		case !ok:
+			b.WriteByte('?')
+		case c == '\\' || c == '(' || c == ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c > 126:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Advance widths of the printable ASCII characters in thousandths of the font
+// size, from the Helvetica and Helvetica-Bold font metrics.
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// textWidth measures text in points. Characters outside ASCII are counted as
+// wide as a digit, which is close enough for accented letters.
+func textWidth(font string, size int, text string) float64 {
+	widths := &helveticaWidths
+	if font == fontBold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, r := range text {
+		if r >= 32 && r <= 126 {
+			total += widths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total*size) / 1000
+}
+
+// wrapText breaks text into lines no wider than width, at spaces where it can
+// and inside a word when the word alone is too wide.
+func wrapText(font string, size int, text string, width float64) []string {
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if textWidth(font, size, candidate) <= width {
+			current = candidate
+			continue
+		}
+		if current != "" {
+			lines = append(lines, current)
+		}
+		current = ""
+		for _, r := range word {
+			if current != "" && textWidth(font, size, current+string(r)) > width {
+				lines = append(lines, current)
+				current = ""
+			}
+			current += string(r)
+		}
+	}
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+func (w *pdfWriter) text(x int, font string, size int, text string) {
+	fmt.Fprintf(w.pages[len(w.pages)-1], "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, x, w.y, pdfEscape(text))
+}
+
+// line writes a row of columns at the given x offsets and moves down. Each
+// column ends where the next one starts and text too long for it is wrapped
+// onto further lines.
+func (w *pdfWriter) line(font string, columns map[int]string) {
+	offsets := make([]int, 0, len(columns))
+	for x := range columns {
+		offsets = append(offsets, x)
+	}
+	sort.Ints(offsets)
+	wrapped := make([][]string, len(offsets))
+	rows := 0
+	for i, x := range offsets {
+		end := pageWidth - pageMargin
+		if i+1 < len(offsets) {
+			end = offsets[i+1] - columnGap
+		}
+		wrapped[i] = wrapText(font, fontSize, columns[x], float64(end-x))
+		rows = max(rows, len(wrapped[i]))
+	}
+	for row := 0; row < rows; row++ {
+		if w.y < pageMargin {
+			w.newPage()
+		}
+		for i, x := range offsets {
+			if row < len(wrapped[i]) {
+				w.text(x, font, fontSize, wrapped[i][row])
+			}
+		}
+		w.y -= lineHeight
+	}
+}
+
+func (w *pdfWriter) gap() {
+	w.y -= lineHeight / 2
+}
+
+func (w *pdfWriter) rule() {
+	fmt.Fprintf(w.pages[len(w.pages)-1], "%d %d m %d %d l S\n", pageMargin, w.y+lineHeight-4, pageWidth-pageMargin, w.y+lineHeight-4)
+	w.gap()
+}
+
+// bytes assembles the document: catalog, page tree, fonts and one content
+// stream per page, followed by the cross reference table.
+func (w *pdfWriter) bytes() []byte {
+	var objects []string
+	pageCount := len(w.pages)
+	// 1 catalog, 2 page tree, 3 and 4 fonts, then a page and its contents for every page
+	kids := make([]string, pageCount)
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range w.pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, fontRegular, fontBold, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// RenderInvoicePDF renders an invoice as a one page A4 PDF.
+func RenderInvoicePDF(invoice invoiceModel.Invoice) []byte {
+	w := newPDFWriter()
+	left, right := pageMargin, 330
+
+	title := "RECEIPT"
+	if invoice.DocumentType == invoiceModel.DocumentTypeTaxInvoice {
+		title = "TAX INVOICE"
+	}
+	w.text(left, fontBold, fontSizeHead, title)
+	w.y -= 2 * lineHeight
+
+	issued := time.Unix(invoice.IssuedAt, 0).In(invoiceLocation).Format("02 Jan 2006")
+	w.line(fontBold, map[int]string{left: invoice.Seller.Name, right: "Invoice No: " + invoice.InvoiceNumber})
+	w.line(fontRegular, map[int]string{left: invoice.Seller.Address, right: "Date: " + issued})
+	w.line(fontRegular, map[int]string{left: fmt.Sprintf("%s (%s)", invoice.Seller.State, invoice.Seller.StateCode), right: "Order: " + invoice.OrderId})
+	seller := map[int]string{right: "Payment: " + invoice.PaymentId}
+	if invoice.Seller.GSTIN != "" {
+		seller[left] = "GSTIN: " + invoice.Seller.GSTIN
+	}
+	w.line(fontRegular, seller)
+	if invoice.Seller.Email != "" || invoice.Seller.Phone != "" {
+		w.line(fontRegular, map[int]string{left: strings.Trim(invoice.Seller.Email+" "+invoice.Seller.Phone, " ")})
+	}
+	w.gap()
+
+	// Buyer
+	w.line(fontBold, map[int]string{left: "Billed to"})
+	for _, text := range []string{invoice.Buyer.Name, invoice.Buyer.Institution, invoice.Buyer.Address, invoice.Buyer.Email} {
+		if text != "" {
+			w.line(fontRegular, map[int]string{left: text})
+		}
+	}
+	if invoice.Buyer.GSTIN != "" {
+		w.line(fontRegular, map[int]string{left: "GSTIN: " + invoice.Buyer.GSTIN})
+	}
+	w.line(fontRegular, map[int]string{left: "Place of supply: " + invoice.PlaceOfSupply})
+	w.gap()
+
+	// Items
+	descriptionX, sacX, quantityX, priceX, amountX := left, 300, 360, 400, 480
+	w.rule()
+	w.line(fontBold, map[int]string{descriptionX: "Description", sacX: "SAC", quantityX: "Qty", priceX: "Unit price", amountX: "Amount"})
+	w.rule()
+	for _, item := range invoice.Items {
+		w.line(fontRegular, map[int]string{
+			descriptionX: item.Description,
+			sacX:         item.SACCode,
+			quantityX:    fmt.Sprint(item.Quantity),
+			priceX:       currencyutils.Format(item.UnitPrice, invoice.Currency),
+			amountX:      currencyutils.Format(item.Amount, invoice.Currency),
+		})
+	}
+	w.rule()
+
+	// Totals
+	labelX := priceX
+	if invoice.Discount > 0 {
+		w.line(fontRegular, map[int]string{labelX: "Discount", amountX: currencyutils.Format(-invoice.Discount, invoice.Currency)})
+	}
+	w.line(fontRegular, map[int]string{labelX: "Taxable value", amountX: currencyutils.Format(invoice.TaxableAmount, invoice.Currency)})
+	if invoice.CGST > 0 || invoice.SGST > 0 {
+		w.line(fontRegular, map[int]string{labelX: fmt.Sprintf("CGST %g%%", invoice.CGSTRate), amountX: currencyutils.Format(invoice.CGST, invoice.Currency)})
+		w.line(fontRegular, map[int]string{labelX: fmt.Sprintf("SGST %g%%", invoice.SGSTRate), amountX: currencyutils.Format(invoice.SGST, invoice.Currency)})
+	}
+	if invoice.IGST > 0 {
+		w.line(fontRegular, map[int]string{labelX: fmt.Sprintf("IGST %g%%", invoice.IGSTRate), amountX: currencyutils.Format(invoice.IGST, invoice.Currency)})
+	}
+	w.line(fontBold, map[int]string{labelX: "Total", amountX: currencyutils.Format(invoice.Total, invoice.Currency)})
+	w.gap()
+
+	if invoice.DocumentType == invoiceModel.DocumentTypeReceipt {
+		w.line(fontRegular, map[int]string{left: "The seller is not registered under GST, no tax has been charged."})
+	}
+	w.line(fontRegular, map[int]string{left: "This is a computer generated document and needs no signature."})
+	return w.bytes()
+}
@@ -0,0 +1,54 @@
+package invoiceutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPDFEscape(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Plain text", "Plain text"},
+		{`a (b) \c`, `a \(b\) \\c`},
+		{"Café Zürich", `Caf\351 Z\374rich`},
+		{"€5 – “quoted”", `\2005 \226 \223quoted\224`},
+		{"Tab\there", "Tab?here"},
+		{"Seat ✓ 中", "Seat ? ?"},
+	}
+	for _, test := range tests {
+		if got := pdfEscape(test.text); got != test.want {
+			t.Errorf("pdfEscape(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	width := textWidth(fontRegular, fontSize, "Annual developer conference")
+	lines := wrapText(fontRegular, fontSize, "Annual developer conference 2026 with workshops and talks", width)
+	if len(lines) < 2 {
+		t.Fatalf("wrapText kept %q on one line", lines)
+	}
+	if lines[0] != "Annual developer conference" {
+		t.Errorf("first line = %q, want %q", lines[0], "Annual developer conference")
+	}
+	for _, line := range lines {
+		if textWidth(fontRegular, fontSize, line) > width {
+			t.Errorf("line %q is wider than %v", line, width)
+		}
+	}
+	if got := strings.Join(lines, " "); got != "Annual developer conference 2026 with workshops and talks" {
+		t.Errorf("wrapped text = %q, lost words", got)
+	}
+
+	long := strings.Repeat("x", 200)
+	for _, line := range wrapText(fontRegular, fontSize, long, 50) {
+		if textWidth(fontRegular, fontSize, line) > 50 {
+			t.Errorf("word piece %q is wider than 50", line)
+		}
+	}
+	if lines := wrapText(fontRegular, fontSize, "", 50); len(lines) != 1 || lines[0] != "" {
+		t.Errorf("wrapText of empty text = %q, want one empty line", lines)
+	}
+}
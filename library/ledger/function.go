@@ -0,0 +1,413 @@
+package ledgerutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	invoiceutils "em_backend/library/invoice"
+	ledgerModel "em_backend/models/ledger"
+	paymentModel "em_backend/models/payment"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ledger accounts. Balances are credits minus debits, so the organizer
+// payable and platform revenue accounts are positive and the provider
+// clearing account, money held by the payment providers, is negative.
+const (
+	AccountProviderClearing = "provider_clearing"
+	AccountPlatformRevenue  = "platform_revenue"
+	AccountGatewayFees      = "gateway_fees"
+
+	organizerAccountPrefix = "organizer_payable:"
+
+	// Sales of events without an organizer are owed to this account
+	UnassignedOrganizer = "unassigned"
+
+	defaultGatewayFeePercent = 2
+
+	// Payouts are pending until they are in the ledger
+	PayoutStatusPending = "pending"
+	PayoutStatusPosted  = "posted"
+
+	// Locks of payouts that did not finish within this time are released
+	payoutLockTimeout = time.Minute
+)
+
+var (
+	ErrUnbalancedTransaction = errors.New("ledger transaction debits and credits differ")
+	ErrInvalidPayoutAmount   = errors.New("payout amount must be positive")
+	ErrInsufficientBalance   = errors.New("payout exceeds the organizer balance")
+	ErrSaleNotRecorded       = errors.New("sale of the order is not in the ledger")
+	ErrPayoutInProgress      = errors.New("another payout to the organizer is being recorded, try again shortly")
+)
+
+// OrganizerAccount is the account of what the platform owes an organizer.
+func OrganizerAccount(organizerId string) string {
+	return organizerAccountPrefix + organizerId
+}
+
+// percentFromEnv reads a fee percentage, falling back when it is not set.
+func percentFromEnv(key string, fallback float64) float64 {
+	percent, err := strconv.ParseFloat(commonutils.LoadEnv(key), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return fallback
+	}
+	return percent
+}
+
+func percentOf(amount int64, percent float64) int64 {
+	return int64(math.Round(float64(amount) * percent / 100))
+}
+
+// postTransaction stores a balanced transaction. A transaction already
+// recorded for the same type and reference is left as it is.
+func postTransaction(transaction ledgerModel.LedgerTransaction) error {
+	var debits, credits int64
+	for _, entry := range transaction.Entries {
+		debits += entry.Debit
+		credits += entry.Credit
+	}
+	if debits != credits {
+		return ErrUnbalancedTransaction
+	}
+	transaction.TransactionId = uuid.New().String()
+	transaction.CreatedAt = time.Now().Unix()
+
+	db, col, err := mongoSetup.ConnectMongo("ledgerTransactions")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := col.InsertOne(ctx, transaction); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to save ledger transaction: %w", err)
+	}
+	return nil
+}
+
+// orderOrganizer returns the organizer an order's event is run by and the
+// platform fee charged to it.
+func orderOrganizer(eventId string) (string, float64, error) {
+	platformFee := percentFromEnv("PLATFORM_FEE_PERCENT", 0)
+
+	event, err := eventutils.FetchEvent(eventId)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to fetch event: %w", err)
+	}
+	organizer, err := invoiceutils.EventOrganizer(event.OrganizerId)
+	if err == invoiceutils.ErrOrganizerNotConfigured {
+		return UnassignedOrganizer, platformFee, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if organizer.PlatformFeePercent > 0 {
+		platformFee = organizer.PlatformFeePercent
+	}
+	return organizer.OrganizerId, platformFee, nil
+}
+
+// RecordSale records a captured order payment. The organizer is owed the
+// amount less the platform fee; the gateway fee, GATEWAY_FEE_PERCENT of the
+// amount, is kept by the provider and borne by the platform.
+func RecordSale(order paymentModel.OrderDetails) error {
+	organizerId, platformFeePercent, err := orderOrganizer(order.EventId)
+	if err != nil {
+		return err
+	}
+	platformFee := percentOf(order.Amount, platformFeePercent)
+	gatewayFee := percentOf(order.Amount, percentFromEnv("GATEWAY_FEE_PERCENT", defaultGatewayFeePercent))
+
+	return postTransaction(ledgerModel.LedgerTransaction{
+		Type:        ledgerModel.TransactionTypeSale,
+		Reference:   order.OrderID,
+		OrderId:     order.OrderID,
+		EventId:     order.EventId,
+		OrganizerId: organizerId,
+		Currency:    order.Currency,
+		Entries: []ledgerModel.LedgerEntry{
+			{Account: AccountProviderClearing, Debit: order.Amount - gatewayFee},
+			{Account: AccountGatewayFees, Debit: gatewayFee},
+			{Account: OrganizerAccount(organizerId), Credit: order.Amount - platformFee},
+			{Account: AccountPlatformRevenue, Credit: platformFee},
+		},
+	})
+}
+
+// RecordRefund records a processed refund of an order. The platform returns
+// its fee on the refunded share of the sale; gateway fees are not returned by
+// the providers and stay with the platform.
+func RecordRefund(orderId string, refundId string, amount int64) error {
+	var sale ledgerModel.LedgerTransaction
+	result, err := mongoSetup.FindOneDoc("ledgerTransactions", bson.M{"type": ledgerModel.TransactionTypeSale, "reference": orderId}, bson.M{})
+	if err != nil {
+		return err
+	}
+	if err := result.Decode(&sale); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrSaleNotRecorded
+		}
+		return err
+	}
+
+	var saleAmount, platformFee int64
+	for _, entry := range sale.Entries {
+		switch entry.Account {
+		case AccountProviderClearing, AccountGatewayFees:
+			saleAmount += entry.Debit
+		case AccountPlatformRevenue:
+			platformFee += entry.Credit
+		}
+	}
+	returnedFee := int64(0)
+	if saleAmount > 0 {
+		returnedFee = int64(math.Round(float64(platformFee) * float64(amount) / float64(saleAmount)))
+	}
+
+	return postTransaction(ledgerModel.LedgerTransaction{
+		Type:        ledgerModel.TransactionTypeRefund,
+		Reference:   refundId,
+		OrderId:     orderId,
+		EventId:     sale.EventId,
+		OrganizerId: sale.OrganizerId,
+		Currency:    sale.Currency,
+		Entries: []ledgerModel.LedgerEntry{
+			{Account: OrganizerAccount(sale.OrganizerId), Debit: amount - returnedFee},
+			{Account: AccountPlatformRevenue, Debit: returnedFee},
+			{Account: AccountProviderClearing, Credit: amount},
+		},
+	})
+}
+
+// RecordPayout records money paid out to an organizer. Payouts cannot exceed
+// what the organizer is owed in that currency, and only one payout per
+// organizer and currency is recorded at a time.
+func RecordPayout(request ledgerModel.PayoutRequest, createdBy string) (ledgerModel.Payout, error) {
+	payout := ledgerModel.Payout{
+		PayoutId:    uuid.New().String(),
+		OrganizerId: request.OrganizerId,
+		Amount:      request.Amount,
+		Currency:    request.Currency,
+		Reference:   request.Reference,
+		Note:        request.Note,
+		Status:      PayoutStatusPending,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now().Unix(),
+	}
+	if payout.Amount <= 0 {
+		return payout, ErrInvalidPayoutAmount
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("payouts")
+	if err != nil {
+		return payout, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// One payout per organizer and currency at a time, so the balance cannot
+	// be paid out twice
+	locks := db.Collection("payoutLocks")
+	lockId := fmt.Sprintf("%s:%s", payout.OrganizerId, payout.Currency)
+	now := time.Now().Unix()
+	_, err = locks.InsertOne(ctx, bson.M{"_id": lockId, "payoutId": payout.PayoutId, "lockedAt": now})
+	if mongo.IsDuplicateKeyError(err) {
+		// Take over the lock of a payout that never finished
+		var result *mongo.UpdateResult
+		result, err = locks.UpdateOne(ctx,
+			bson.M{"_id": lockId, "lockedAt": bson.M{"$lte": now - int64(payoutLockTimeout/time.Second)}},
+			bson.M{"$set": bson.M{"payoutId": payout.PayoutId, "lockedAt": now}},
+		)
+		if err == nil && result.ModifiedCount == 0 {
+			return payout, ErrPayoutInProgress
+		}
+	}
+	if err != nil {
+		return payout, fmt.Errorf("failed to lock payouts: %w", err)
+	}
+	defer locks.DeleteOne(context.TODO(), bson.M{"_id": lockId, "payoutId": payout.PayoutId})
+
+	balance, err := OrganizerBalance(payout.OrganizerId, payout.Currency)
+	if err != nil {
+		return payout, err
+	}
+	if payout.Amount > balance {
+		return payout, ErrInsufficientBalance
+	}
+
+	// The record comes first, so the ledger never has a payout without one
+	if _, err := col.InsertOne(ctx, payout); err != nil {
+		return payout, fmt.Errorf("failed to save payout: %w", err)
+	}
+	err = postTransaction(ledgerModel.LedgerTransaction{
+		Type:        ledgerModel.TransactionTypePayout,
+		Reference:   payout.PayoutId,
+		OrganizerId: payout.OrganizerId,
+		Currency:    payout.Currency,
+		Note:        payout.Reference,
+		Entries: []ledgerModel.LedgerEntry{
+			{Account: OrganizerAccount(payout.OrganizerId), Debit: payout.Amount},
+			{Account: AccountProviderClearing, Credit: payout.Amount},
+		},
+	})
+	if err != nil {
+		col.DeleteOne(context.TODO(), bson.M{"payoutId": payout.PayoutId})
+		return payout, err
+	}
+
+	payout.Status = PayoutStatusPosted
+	if _, err := col.UpdateOne(ctx, bson.M{"payoutId": payout.PayoutId}, bson.M{"$set": bson.M{"status": payout.Status}}); err != nil {
+		log.Printf("Failed to mark payout %s as posted: %v", payout.PayoutId, err)
+	}
+	return payout, nil
+}
+
+// Balances sums the ledger per account and currency over the transactions
+// matching filter, e.g. those of one organizer or event.
+func Balances(filter bson.M) ([]ledgerModel.AccountBalance, error) {
+	db, col, err := mongoSetup.ConnectMongo("ledgerTransactions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$unwind", Value: "$entries"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"account": "$entries.account", "currency": "$currency"},
+			"debit":  bson.M{"$sum": "$entries.debit"},
+			"credit": bson.M{"$sum": "$entries.credit"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"account":  "$_id.account",
+			"currency": "$_id.currency",
+			"debit":    1,
+			"credit":   1,
+			"balance":  bson.M{"$subtract": bson.A{"$credit", "$debit"}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "account", Value: 1}, {Key: "currency", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute balances: %w", err)
+	}
+	balances := []ledgerModel.AccountBalance{}
+	if err := cursor.All(ctx, &balances); err != nil {
+		return nil, fmt.Errorf("failed to decode balances: %w", err)
+	}
+	return balances, nil
+}
+
+// OrganizerBalance is what the platform owes an organizer in a currency.
+func OrganizerBalance(organizerId string, currency string) (int64, error) {
+	balances, err := Balances(bson.M{"organizerId": organizerId, "currency": currency})
+	if err != nil {
+		return 0, err
+	}
+	for _, balance := range balances {
+		if balance.Account == OrganizerAccount(organizerId) {
+			return balance.Balance, nil
+		}
+	}
+	return 0, nil
+}
+
+// BuildStatement lists how the amount owed to an organizer changed between
+// from and to, with the balances either side.
+func BuildStatement(organizerId string, currency string, from int64, to int64) (ledgerModel.Statement, error) {
+	statement := ledgerModel.Statement{
+		OrganizerId: organizerId,
+		Currency:    currency,
+		From:        from,
+		To:          to,
+		Lines:       []ledgerModel.StatementLine{},
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("ledgerTransactions")
+	if err != nil {
+		return statement, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx,
+		bson.M{"organizerId": organizerId, "currency": currency, "createdAt": bson.M{"$lte": to}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return statement, fmt.Errorf("failed to fetch ledger transactions: %w", err)
+	}
+	var transactions []ledgerModel.LedgerTransaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return statement, fmt.Errorf("failed to decode ledger transactions: %w", err)
+	}
+
+	account := OrganizerAccount(organizerId)
+	balance := int64(0)
+	for _, transaction := range transactions {
+		var net, platformFee int64
+		for _, entry := range transaction.Entries {
+			switch entry.Account {
+			case account:
+				net += entry.Credit - entry.Debit
+			case AccountPlatformRevenue:
+				platformFee += entry.Credit - entry.Debit
+			}
+		}
+		balance += net
+		if transaction.CreatedAt < from {
+			statement.OpeningBalance = balance
+			continue
+		}
+
+		line := ledgerModel.StatementLine{
+			Date:        transaction.CreatedAt,
+			Type:        transaction.Type,
+			Reference:   transaction.Reference,
+			OrderId:     transaction.OrderId,
+			EventId:     transaction.EventId,
+			PlatformFee: platformFee,
+			Net:         net,
+			Balance:     balance,
+		}
+		switch transaction.Type {
+		case ledgerModel.TransactionTypeSale:
+			line.Gross = net + platformFee
+			statement.Sales += line.Gross
+		case ledgerModel.TransactionTypeRefund:
+			line.Gross = net + platformFee
+			statement.Refunds -= line.Gross
+		case ledgerModel.TransactionTypePayout:
+			statement.Payouts -= net
+		}
+		statement.PlatformFees += platformFee
+		statement.Lines = append(statement.Lines, line)
+	}
+	statement.ClosingBalance = balance
+	return statement, nil
+}
@@ -0,0 +1,44 @@
+package ledgerutils
+
+import (
+	"bytes"
+	currencyutils "em_backend/library/currency"
+	ledgerModel "em_backend/models/ledger"
+	"encoding/csv"
+	"time"
+)
+
+// StatementCSV renders a settlement statement as CSV, with the opening and
+// closing balances as the first and last rows.
+func StatementCSV(statement ledgerModel.Statement) ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+
+	date := func(unix int64) string {
+		return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04:05")
+	}
+	rows := [][]string{
+		{"Date (UTC)", "Type", "Reference", "Order", "Event", "Gross", "Platform fee", "Net", "Balance", "Currency"},
+		{date(statement.From), "opening_balance", "", "", "", "", "", "", currencyutils.FormatDecimal(statement.OpeningBalance, statement.Currency), statement.Currency},
+	}
+	for _, line := range statement.Lines {
+		rows = append(rows, []string{
+			date(line.Date),
+			line.Type,
+			line.Reference,
+			line.OrderId,
+			line.EventId,
+			currencyutils.FormatDecimal(line.Gross, statement.Currency),
+			currencyutils.FormatDecimal(line.PlatformFee, statement.Currency),
+			currencyutils.FormatDecimal(line.Net, statement.Currency),
+			currencyutils.FormatDecimal(line.Balance, statement.Currency),
+			statement.Currency,
+		})
+	}
+	rows = append(rows, []string{date(statement.To), "closing_balance", "", "", "", "", "", "", currencyutils.FormatDecimal(statement.ClosingBalance, statement.Currency), statement.Currency})
+
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
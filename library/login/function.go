@@ -8,10 +8,6 @@ import (
 	"log"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	credendials "github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ses"
 	"github.com/go-redis/redis"
 
 	"github.com/dgrijalva/jwt-go"
@@ -19,7 +15,7 @@ import (
 
 	mongoSetup "em_backend/configs/mongo"
 	redisSetup "em_backend/configs/redis"
-	commonutils "em_backend/library/common"
+	mailutils "em_backend/library/mail"
 	common_responses "em_backend/responses/common"
 	loginRespo "em_backend/responses/login"
 
@@ -151,7 +147,9 @@ func GenerateOTP() string {
 	return fmt.Sprintf("%04d", rand.Intn(10000))
 }
 
-func SendRegisterOrForgotPasswordEmail(email string, mailType string) (bool, error) {
+// SendRegisterOrForgotPasswordEmail emails a verification code, in the
+// recipient's locale when there is a template for it.
+func SendRegisterOrForgotPasswordEmail(email string, mailType string, locale string) (bool, error) {
 	r, err := redisSetup.ConnectToRedis()
 	if err != nil {
 		fmt.Println("Err connecting to redis", err)
@@ -161,7 +159,6 @@ func SendRegisterOrForgotPasswordEmail(email string, mailType string) (bool, err
 	generatedPassword := GenerateOTP()
 
 	expiryTime := 5 * time.Minute
-	email = "dukone.contact@gmail.com"
 	key := fmt.Sprintf("emailverification:%s", email)
 
 	err = r.Set(key, generatedPassword, expiryTime).Err()
@@ -170,80 +167,18 @@ func SendRegisterOrForgotPasswordEmail(email string, mailType string) (bool, err
 		fmt.Println("Cannot set generated password in redis")
 	}
 
-	const (
-		sender    = "dukone.contact@gmail.com"
-		awsRegion = "us-east-1"
-	)
-
-	actionMessage := ""
-	if mailType == "forgotpassword" {
-		actionMessage = "Please use the verification code below to reset your password:"
-	} else {
-		actionMessage = "Please use the verification code below to complete your registration on STUNI"
-	}
-	bodyHTML := fmt.Sprintf(`
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<style>
-			body { font-family: Arial, sans-serif; color: #333; margin: 20px; }
-			.container { max-width: 600px; margin: 0 auto; padding: 20px; border: 1px solid #ddd; border-radius: 10px; background-color: #f9f9f9; }
-			h2 { color: #007BFF; }
-			.code { font-weight: bold; font-size: 20px; color: #d9534f; }
-			.footer { font-size: 12px; color: #777; margin-top: 20px; }
-		</style>
-	</head>
-	<body>
-		<div class="container">
-			<h2>STUNI Email Verification</h2>
-			<p>Hi,</p>
-			<p>%s</p>
-			<p class="code">%s</p>
-			<p>This code will expire in <strong>%d minutes</strong>.</p>
-			<p>If you did not request this code, please ignore this email.</p>
-			<p>Best regards,</p>
-			<p>The STUNI Team</p>
-			<div class="footer">
-				<p>Note: This is an automated email. Please do not reply.</p>
-			</div>
-		</div>
-	</body>
-	</html>`, actionMessage, string(generatedPassword), int(expiryTime/time.Minute))
-	fmt.Println()
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(awsRegion),
-		Credentials: credendials.NewStaticCredentials(commonutils.LoadEnv("AWS_KEY"), commonutils.LoadEnv("AWS_SKEY"), ""),
+	message, err := mailutils.RenderMessage(email, mailutils.TemplateVerification, locale, "", map[string]interface{}{
+		"Purpose":       mailType,
+		"Code":          generatedPassword,
+		"ExpiryMinutes": int(expiryTime / time.Minute),
 	})
 	if err != nil {
-		log.Printf("Failed to create AWS session: %v", err)
+		log.Printf("Failed to render verification email: %v", err)
 		return false, err
 	}
 
-	// Create SES service client
-	svc := ses.New(sess)
-
-	// Compose email input
-	input := &ses.SendEmailInput{
-		Destination: &ses.Destination{
-			ToAddresses: []*string{
-				aws.String(email),
-			},
-		},
-		Message: &ses.Message{
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Data: aws.String(bodyHTML),
-				},
-			},
-			Subject: &ses.Content{
-				Data: aws.String("STUNI Email Verification"),
-			},
-		},
-		Source: aws.String(sender),
-	}
-
-	// Send the email
-	_, err = svc.SendEmail(input)
+	// Send the email through the configured mailer
+	err = mailutils.Send(message)
 	if err != nil {
 		log.Printf("Failed to send email: %v", err)
 		return false, err
@@ -0,0 +1,145 @@
+package mailutils
+
+import (
+	"bytes"
+	commonutils "em_backend/library/common"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultSinkDir = "tmp/mail"
+
+var (
+	ErrSinkMessageNotFound = errors.New("email not found in the mail sink")
+
+	sinkIdPattern = regexp.MustCompile(`^[0-9]+-[a-z0-9.@_-]+\.eml$`)
+	unsafeIdChars = regexp.MustCompile(`[^a-z0-9.@_-]+`)
+)
+
+// SinkMessage summarises an email written to the local sink.
+type SinkMessage struct {
+	Id      string `json:"id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Date    string `json:"date"`
+	Size    int64  `json:"size"`
+}
+
+// fileMailer writes every email to MAIL_SINK_DIR as an .eml file, which any
+// mail client can open, so email flows can be tried without a mail server.
+type fileMailer struct {
+	dir string
+}
+
+func newFileMailer() *fileMailer {
+	return &fileMailer{dir: SinkDir()}
+}
+
+// SinkDir is the directory the file mailer writes to.
+func SinkDir() string {
+	if dir := strings.TrimSpace(commonutils.LoadEnv("MAIL_SINK_DIR")); dir != "" {
+		return dir
+	}
+	return defaultSinkDir
+}
+
+func (m *fileMailer) Name() string {
+	return DriverFile
+}
+
+func (m *fileMailer) Send(message Message) error {
+	message, err := prepare(message)
+	if err != nil {
+		return err
+	}
+	raw, err := BuildMIME(message)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail sink directory: %w", err)
+	}
+
+	recipient := unsafeIdChars.ReplaceAllString(strings.ToLower(message.To[0]), "_")
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), recipient)
+	if err := os.WriteFile(filepath.Join(m.dir, name), raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write email to the mail sink: %w", err)
+	}
+	fmt.Println("Email written to", filepath.Join(m.dir, name))
+	return nil
+}
+
+// ListSinkMessages returns the emails in the sink, newest first, optionally
+// only those sent to the given address.
+func ListSinkMessages(to string) ([]SinkMessage, error) {
+	entries, err := os.ReadDir(SinkDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SinkMessage{}, nil
+		}
+		return nil, fmt.Errorf("failed to read mail sink: %w", err)
+	}
+
+	to = strings.ToLower(strings.TrimSpace(to))
+	messages := []SinkMessage{}
+	for _, entry := range entries {
+		if entry.IsDir() || !sinkIdPattern.MatchString(entry.Name()) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(SinkDir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			continue
+		}
+		if to != "" && !strings.Contains(strings.ToLower(parsed.Header.Get("To")), to) {
+			continue
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		if err != nil {
+			subject = parsed.Header.Get("Subject")
+		}
+		messages = append(messages, SinkMessage{
+			Id:      entry.Name(),
+			From:    parsed.Header.Get("From"),
+			To:      parsed.Header.Get("To"),
+			Subject: subject,
+			Date:    parsed.Header.Get("Date"),
+			Size:    int64(len(raw)),
+		})
+	}
+	// File names start with the time they were written
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Id > messages[j].Id
+	})
+	return messages, nil
+}
+
+// ReadSinkMessage returns the raw .eml file of an email in the sink.
+func ReadSinkMessage(id string) ([]byte, error) {
+	// Ids are file names, anything else could escape the sink directory
+	if !sinkIdPattern.MatchString(id) {
+		return nil, ErrSinkMessageNotFound
+	}
+	file, err := os.Open(filepath.Join(SinkDir(), id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSinkMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to open email: %w", err)
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,112 @@
+package mailutils
+
+import (
+	commonutils "em_backend/library/common"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	DriverSES  = "ses"
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+
+	// defaultSender is used until MAIL_FROM is configured
+	defaultSender = "STUNI <dukone.contact@gmail.com>"
+)
+
+var (
+	ErrNoRecipients   = errors.New("email has no recipients")
+	ErrInvalidAddress = errors.New("invalid email address")
+)
+
+// Attachment is a file sent along with an email. Attachments with a
+// ContentID are sent inline and can be referenced from the HTML body as
+// cid:<ContentID>.
+type Attachment struct {
+	FileName    string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+// Message is an email ready to be delivered. From defaults to MAIL_FROM.
+type Message struct {
+	From        string
+	To          []string
+	ReplyTo     string
+	Subject     string
+	HTML        string
+	Text        string
+	Headers     map[string]string
+	Attachments []Attachment
+}
+
+// Mailer delivers emails through one transport.
+type Mailer interface {
+	Name() string
+	Send(message Message) error
+}
+
+// ActiveMailer returns the mailer selected by MAIL_DRIVER. SES stays the
+// default so existing deployments keep working without new configuration.
+func ActiveMailer() Mailer {
+	mailer, err := MailerByName(commonutils.LoadEnv("MAIL_DRIVER"))
+	if err != nil {
+		fmt.Println(err, "- falling back to ses")
+		return newSESMailer()
+	}
+	return mailer
+}
+
+// MailerByName returns the mailer with the given driver name.
+func MailerByName(name string) (Mailer, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", DriverSES:
+		return newSESMailer(), nil
+	case DriverSMTP:
+		return newSMTPMailer(), nil
+	case DriverFile:
+		return newFileMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver '%s'", name)
+	}
+}
+
+// IsFileMailerActive reports whether emails are written to the local sink,
+// which enables the developer inbox endpoints.
+func IsFileMailerActive() bool {
+	return ActiveMailer().Name() == DriverFile
+}
+
+// Sender is the From address used when a message does not set one.
+func Sender() string {
+	if sender := strings.TrimSpace(commonutils.LoadEnv("MAIL_FROM")); sender != "" {
+		return sender
+	}
+	return defaultSender
+}
+
+// Send delivers a message through the active mailer.
+func Send(message Message) error {
+	return ActiveMailer().Send(message)
+}
+
+// prepare fills in defaults and checks the message can be sent.
+func prepare(message Message) (Message, error) {
+	if message.From == "" {
+		message.From = Sender()
+	}
+	var recipients []string
+	for _, to := range message.To {
+		if to = strings.TrimSpace(to); to != "" {
+			recipients = append(recipients, to)
+		}
+	}
+	if len(recipients) == 0 {
+		return message, ErrNoRecipients
+	}
+	message.To = recipients
+	return message, nil
+}
@@ -0,0 +1,212 @@
+package mailutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BuildMIME renders a message as an RFC 5322 email. The bodies go in a
+// multipart/alternative part, inline attachments are wrapped with the HTML in
+// multipart/related and everything else is attached with multipart/mixed.
+func BuildMIME(message Message) ([]byte, error) {
+	var out bytes.Buffer
+
+	from, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return nil, fmt.Errorf("%w: sender '%s': %v", ErrInvalidAddress, message.From, err)
+	}
+	to := make([]string, 0, len(message.To))
+	for _, recipient := range message.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("%w: recipient '%s': %v", ErrInvalidAddress, recipient, err)
+		}
+		to = append(to, address.String())
+	}
+
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	headers := map[string]string{
+		"From":         from.String(),
+		"To":           strings.Join(to, ", "),
+		"Subject":      mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%s@%s>", uuid.New().String(), domain),
+		"MIME-Version": "1.0",
+	}
+	if message.ReplyTo != "" {
+		headers["Reply-To"] = message.ReplyTo
+	}
+	for key, value := range message.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(key)] = value
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&out, "%s: %s\r\n", key, headers[key])
+	}
+
+	contentType, body, err := buildBody(message)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&out, "Content-Type: %s\r\n\r\n", contentType)
+	out.Write(body)
+	return out.Bytes(), nil
+}
+
+// buildBody nests the parts from the inside out and returns the content type
+// and body of the outermost one.
+func buildBody(message Message) (string, []byte, error) {
+	var inline, attached []Attachment
+	for _, attachment := range message.Attachments {
+		if attachment.ContentID != "" {
+			inline = append(inline, attachment)
+		} else {
+			attached = append(attached, attachment)
+		}
+	}
+
+	var alternative bytes.Buffer
+	alternativeWriter := multipart.NewWriter(&alternative)
+	if err := writeBodies(alternativeWriter, message); err != nil {
+		return "", nil, err
+	}
+	contentType := fmt.Sprintf("multipart/alternative; boundary=%s", alternativeWriter.Boundary())
+	body := alternative.Bytes()
+
+	for _, group := range []struct {
+		subtype     string
+		attachments []Attachment
+	}{{"related", inline}, {"mixed", attached}} {
+		if len(group.attachments) == 0 {
+			continue
+		}
+		var wrapped bytes.Buffer
+		writer := multipart.NewWriter(&wrapped)
+		part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+		if err != nil {
+			return "", nil, err
+		}
+		part.Write(body)
+		for _, attachment := range group.attachments {
+			if err := writeAttachment(writer, attachment); err != nil {
+				return "", nil, err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return "", nil, err
+		}
+		contentType = fmt.Sprintf("multipart/%s; boundary=%s", group.subtype, writer.Boundary())
+		body = wrapped.Bytes()
+	}
+	return contentType, body, nil
+}
+
+func writeBodies(alternative *multipart.Writer, message Message) error {
+	text := message.Text
+	if text == "" {
+		text = htmlToText(message.HTML)
+	}
+	bodies := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", message.HTML},
+	}
+	for _, body := range bodies {
+		if body.content == "" {
+			continue
+		}
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		writer := quotedprintable.NewWriter(part)
+		writer.Write([]byte(body.content))
+		if err := writer.Close(); err != nil {
+			return err
+		}
+	}
+	return alternative.Close()
+}
+
+func writeAttachment(parent *multipart.Writer, attachment Attachment) error {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	header := textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("%s; name=%q", contentType, attachment.FileName)},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	if attachment.ContentID != "" {
+		disposition = "inline"
+		header.Set("Content-ID", fmt.Sprintf("<%s>", attachment.ContentID))
+	}
+	header.Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, attachment.FileName))
+	part, err := parent.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	// Base64 lines must not be longer than 76 characters
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 76 {
+		part.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	_, err = part.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+// htmlToText gives HTML-only emails a rough plain text alternative by
+// dropping tags and collapsing whitespace.
+func htmlToText(html string) string {
+	var b strings.Builder
+	inTag, inStyle := false, false
+	for i := 0; i < len(html); i++ {
+		c := html[i]
+		switch {
+		case c == '<':
+			inTag = true
+			rest := strings.ToLower(html[i:])
+			if strings.HasPrefix(rest, "<style") {
+				inStyle = true
+			} else if strings.HasPrefix(rest, "</style") {
+				inStyle = false
+			} else if strings.HasPrefix(rest, "<p") || strings.HasPrefix(rest, "<br") || strings.HasPrefix(rest, "<h") || strings.HasPrefix(rest, "</div") {
+				b.WriteByte('\n')
+			}
+		case c == '>':
+			inTag = false
+		case !inTag && !inStyle:
+			b.WriteByte(c)
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
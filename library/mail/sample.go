@@ -0,0 +1,82 @@
+package mailutils
+
+// sampleData fills every field the built-in templates use, so previews and
+// override checks render the way a real email would.
+var sampleData = map[string]map[string]interface{}{
+	TemplateVerification: {
+		"Purpose":       "register",
+		"Code":          "1234",
+		"ExpiryMinutes": 5,
+	},
+	TemplateRegistrationConfirmation: {
+		"Name":           "Asha Rao",
+		"EventName":      "Campus Hackathon",
+		"EventDate":      "Sat, 14 Nov 2026 10:00 IST",
+		"Venue":          "Main Auditorium",
+		"TicketType":     "Early Bird",
+		"RegistrationId": "3f1c2d9e-7a44-4d2b-9c1e-5b7f0e6a8d21",
+		"ManageURL":      "https://example.com/registrations/3f1c2d9e",
+		"QRContentID":    "",
+	},
+	TemplateTicket: {
+		"Name":        "Asha Rao",
+		"EventName":   "Campus Hackathon",
+		"EventDate":   "Sat, 14 Nov 2026 10:00 IST",
+		"Venue":       "Main Auditorium",
+		"TicketType":  "Early Bird",
+		"TicketId":    "3f1c2d9e-7a44-4d2b-9c1e-5b7f0e6a8d21",
+		"QRContentID": "",
+	},
+	TemplatePaymentReceipt: {
+		"Name":      "Asha Rao",
+		"EventName": "Campus Hackathon",
+		"Amount":    "INR 1180.00",
+		"Items": []map[string]interface{}{
+			{"Description": "Campus Hackathon - Early Bird", "Quantity": 2, "Amount": "INR 1180.00"},
+		},
+		"OrderId":       "order_Nc8e2kq1",
+		"PaymentId":     "pay_Nc8e3Lx9",
+		"InvoiceNumber": "INV/2026-27/00042",
+	},
+	TemplateEventUpdate: {
+		"Name":      "Asha Rao",
+		"EventName": "Campus Hackathon",
+		"Changes": []map[string]interface{}{
+			{"Field": "Date", "Old": "Sat, 14 Nov 2026 10:00 IST", "New": "Sun, 15 Nov 2026 11:00 IST"},
+			{"Field": "Venue", "Old": "Main Auditorium", "New": "Seminar Hall 2"},
+		},
+		"ManageURL": "https://example.com/registrations/3f1c2d9e",
+	},
+	TemplateEventCancellation: {
+		"Name":         "Asha Rao",
+		"EventName":    "Campus Hackathon",
+		"EventDate":    "Sat, 14 Nov 2026 10:00 IST",
+		"Reason":       "The venue is unavailable because of the elections.",
+		"RefundAmount": "INR 590.00",
+	},
+	TemplateEventReminder: {
+		"Name":        "Asha Rao",
+		"EventName":   "Campus Hackathon",
+		"EventDate":   "Sat, 14 Nov 2026 10:00 IST",
+		"StartsIn":    "tomorrow",
+		"Venue":       "Main Auditorium",
+		"MeetingLink": "",
+	},
+	TemplateAnnouncement: {
+		"Name":       "Asha Rao",
+		"EventName":  "Campus Hackathon",
+		"Subject":    "Room change for the opening session",
+		"Paragraphs": []string{"The opening session has moved to Seminar Hall 2.", "Please bring your laptop charger and student ID."},
+		"Message":    "The opening session has moved to Seminar Hall 2.\n\nPlease bring your laptop charger and student ID.",
+		"Organizer":  "STUNI Events",
+	},
+}
+
+// SampleData returns a copy of the sample data of a template.
+func SampleData(name string) map[string]interface{} {
+	data := map[string]interface{}{}
+	for key, value := range sampleData[name] {
+		data[key] = value
+	}
+	return data
+}
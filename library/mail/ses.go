@@ -0,0 +1,70 @@
+package mailutils
+
+import (
+	commonutils "em_backend/library/common"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+)
+
+const defaultAWSRegion = "us-east-1"
+
+// sesMailer sends raw MIME emails through Amazon SES, so attachments and
+// inline images go through the same path as plain emails.
+type sesMailer struct {
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func newSESMailer() *sesMailer {
+	region := strings.TrimSpace(commonutils.LoadEnv("AWS_REGION"))
+	if region == "" {
+		region = defaultAWSRegion
+	}
+	return &sesMailer{
+		region:    region,
+		accessKey: commonutils.LoadEnv("AWS_KEY"),
+		secretKey: commonutils.LoadEnv("AWS_SKEY"),
+	}
+}
+
+func (m *sesMailer) Name() string {
+	return DriverSES
+}
+
+func (m *sesMailer) Send(message Message) error {
+	message, err := prepare(message)
+	if err != nil {
+		return err
+	}
+	raw, err := BuildMIME(message)
+	if err != nil {
+		return err
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(m.region),
+		Credentials: credentials.NewStaticCredentials(m.accessKey, m.secretKey, ""),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	destinations := make([]*string, len(message.To))
+	for i, to := range message.To {
+		destinations[i] = aws.String(to)
+	}
+	_, err = ses.New(sess).SendRawEmail(&ses.SendRawEmailInput{
+		Destinations: destinations,
+		RawMessage:   &ses.RawMessage{Data: raw},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email through SES: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package mailutils
+
+import (
+	commonutils "em_backend/library/common"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+const defaultSMTPPort = "587"
+
+// smtpMailer sends through any SMTP server. net/smtp upgrades the connection
+// with STARTTLS whenever the server offers it.
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+}
+
+func newSMTPMailer() *smtpMailer {
+	port := strings.TrimSpace(commonutils.LoadEnv("SMTP_PORT"))
+	if port == "" {
+		port = defaultSMTPPort
+	}
+	return &smtpMailer{
+		host:     strings.TrimSpace(commonutils.LoadEnv("SMTP_HOST")),
+		port:     port,
+		username: commonutils.LoadEnv("SMTP_USERNAME"),
+		password: commonutils.LoadEnv("SMTP_PASSWORD"),
+	}
+}
+
+func (m *smtpMailer) Name() string {
+	return DriverSMTP
+}
+
+func (m *smtpMailer) Send(message Message) error {
+	if m.host == "" {
+		return fmt.Errorf("SMTP_HOST is not configured")
+	}
+	message, err := prepare(message)
+	if err != nil {
+		return err
+	}
+	raw, err := BuildMIME(message)
+	if err != nil {
+		return err
+	}
+
+	// The envelope takes bare addresses, not display names
+	from, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return fmt.Errorf("%w: sender '%s': %v", ErrInvalidAddress, message.From, err)
+	}
+	recipients := make([]string, len(message.To))
+	for i, to := range message.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("%w: recipient '%s': %v", ErrInvalidAddress, to, err)
+		}
+		recipients[i] = address.Address
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(m.host, m.port), auth, from.Address, recipients, raw); err != nil {
+		return fmt.Errorf("failed to send email through SMTP: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,513 @@
+package mailutils
+
+import (
+	"bytes"
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	invoiceutils "em_backend/library/invoice"
+	mailModel "em_backend/models/mail"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TemplateVerification             = "verification"
+	TemplateRegistrationConfirmation = "registration_confirmation"
+	TemplateTicket                   = "ticket"
+	TemplatePaymentReceipt           = "payment_receipt"
+	TemplateEventUpdate              = "event_update"
+	TemplateEventCancellation        = "event_cancellation"
+	TemplateEventReminder            = "event_reminder"
+	TemplateAnnouncement             = "announcement"
+
+	DefaultLocale = "en"
+
+	TemplateSourceBuiltin  = "builtin"
+	TemplateSourceOverride = "override"
+
+	defaultBrandName  = "STUNI"
+	defaultBrandColor = "#007BFF"
+)
+
+var (
+	ErrUnknownTemplate = errors.New("unknown email template")
+	ErrInvalidLocale   = errors.New("locale must look like en or en-IN")
+	ErrSubjectRequired = errors.New("template subject is required")
+	ErrHTMLRequired    = errors.New("template HTML is required")
+	ErrInvalidTemplate = errors.New("invalid email template")
+)
+
+// TemplateNames lists every email the platform sends.
+var TemplateNames = []string{
+	TemplateVerification,
+	TemplateRegistrationConfirmation,
+	TemplateTicket,
+	TemplatePaymentReceipt,
+	TemplateEventUpdate,
+	TemplateEventCancellation,
+	TemplateEventReminder,
+	TemplateAnnouncement,
+}
+
+// The built-in templates live in templates/<locale>/<name>.html and .txt.
+// The HTML file defines the "heading" and "content" blocks of layout.html,
+// the text file the "subject" and the "content" block of layout.txt.
+//
+//go:embed templates
+var builtinTemplates embed.FS
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// layoutStrings holds the strings of the layouts in every built-in locale.
+var layoutStrings = map[string]map[string]string{
+	"en": {
+		"regards":   "Best regards,",
+		"support":   "Need help? Write to",
+		"automated": "Note: This is an automated email. Please do not reply.",
+	},
+	"hi": {
+		"regards":   "शुभकामनाओं सहित,",
+		"support":   "सहायता चाहिए? लिखें",
+		"automated": "नोट: यह एक स्वचालित ईमेल है। कृपया इसका उत्तर न दें।",
+	},
+}
+
+// Brand is what the layout shows of the sender: the platform, or the
+// organizer of the event the email is about.
+type Brand struct {
+	Name         string `json:"name"`
+	LogoURL      string `json:"logoUrl,omitempty"`
+	Color        string `json:"color"`
+	SupportEmail string `json:"supportEmail,omitempty"`
+}
+
+// DefaultBrand is the platform's own branding.
+func DefaultBrand() Brand {
+	name := strings.TrimSpace(commonutils.LoadEnv("MAIL_BRAND_NAME"))
+	if name == "" {
+		name = defaultBrandName
+	}
+	return Brand{
+		Name:         name,
+		LogoURL:      strings.TrimSpace(commonutils.LoadEnv("MAIL_BRAND_LOGO_URL")),
+		Color:        defaultBrandColor,
+		SupportEmail: strings.TrimSpace(commonutils.LoadEnv("MAIL_SUPPORT_EMAIL")),
+	}
+}
+
+// BrandFor returns the branding of an organizer, falling back to the
+// platform's for anything the organizer has not set.
+func BrandFor(organizerId string) Brand {
+	brand := DefaultBrand()
+	if organizerId == "" {
+		return brand
+	}
+	organizer, err := invoiceutils.FetchOrganizer(organizerId)
+	if err != nil {
+		if !errors.Is(err, invoiceutils.ErrOrganizerNotFound) {
+			log.Printf("Failed to load branding of organizer %s: %v", organizerId, err)
+		}
+		return brand
+	}
+	brand.Name = organizer.Name
+	if organizer.LogoURL != "" {
+		brand.LogoURL = organizer.LogoURL
+	}
+	if organizer.BrandColor != "" {
+		brand.Color = organizer.BrandColor
+	}
+	if organizer.SupportEmail != "" {
+		brand.SupportEmail = organizer.SupportEmail
+	} else if organizer.Email != "" {
+		brand.SupportEmail = organizer.Email
+	}
+	return brand
+}
+
+// NormaliseLocale lower-cases a locale such as en_IN to en-in. An empty
+// locale is the default one.
+func NormaliseLocale(locale string) (string, error) {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if locale == "" {
+		return DefaultLocale, nil
+	}
+	if !localePattern.MatchString(locale) {
+		return "", ErrInvalidLocale
+	}
+	return locale, nil
+}
+
+// localeChain lists the locales to try for a locale, most specific first:
+// hi-in falls back to hi and then to the default locale.
+func localeChain(locale string) []string {
+	locale, err := NormaliseLocale(locale)
+	if err != nil {
+		return []string{DefaultLocale}
+	}
+	chain := []string{locale}
+	if language, _, found := strings.Cut(locale, "-"); found {
+		chain = append(chain, language)
+	}
+	if chain[len(chain)-1] != DefaultLocale {
+		chain = append(chain, DefaultLocale)
+	}
+	return chain
+}
+
+func isTemplateName(name string) bool {
+	for _, known := range TemplateNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+func builtinFile(locale string, name string) (string, bool) {
+	content, err := fs.ReadFile(builtinTemplates, path.Join("templates", locale, name))
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
+
+// BuiltinLocales lists the locales that have built-in templates.
+func BuiltinLocales() []string {
+	entries, _ := fs.ReadDir(builtinTemplates, "templates")
+	var locales []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			locales = append(locales, entry.Name())
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Render renders a template for a recipient with the given locale. Overrides
+// saved for the organizer win over platform wide ones, which win over the
+// built-in templates; within each the most specific locale wins.
+func Render(name string, locale string, organizerId string, data map[string]interface{}) (mailModel.RenderedEmail, error) {
+	if !isTemplateName(name) {
+		return mailModel.RenderedEmail{}, ErrUnknownTemplate
+	}
+	chain := localeChain(locale)
+
+	// A broken database should not stop emails going out with the
+	// built-in templates
+	overrides, err := fetchOverrides(name, organizerId, chain)
+	if err != nil {
+		log.Printf("Failed to load email template overrides for %s: %v", name, err)
+	}
+	for _, candidate := range chain {
+		for _, owner := range []string{organizerId, ""} {
+			for i := range overrides {
+				if overrides[i].Locale == candidate && overrides[i].OrganizerId == owner {
+					return renderTemplate(name, &overrides[i], candidate, BrandFor(organizerId), data)
+				}
+			}
+		}
+		if _, found := builtinFile(candidate, name+".html"); found {
+			return renderTemplate(name, nil, candidate, BrandFor(organizerId), data)
+		}
+	}
+	return mailModel.RenderedEmail{}, ErrUnknownTemplate
+}
+
+// renderTemplate renders an override, or the built-in template of locale
+// when override is nil.
+func renderTemplate(name string, override *mailModel.EmailTemplate, locale string, brand Brand, data map[string]interface{}) (mailModel.RenderedEmail, error) {
+	rendered := mailModel.RenderedEmail{Locale: locale, Source: TemplateSourceBuiltin}
+	layoutHTML, _ := builtinFile("", "layout.html")
+	layoutText, _ := builtinFile("", "layout.txt")
+
+	htmlTemplate, err := htmltemplate.New("layout").Funcs(htmlFuncs(locale)).Parse(layoutHTML)
+	if err != nil {
+		return rendered, err
+	}
+	textTemplate, err := texttemplate.New("layout").Funcs(textFuncs(locale)).Parse(layoutText)
+	if err != nil {
+		return rendered, err
+	}
+
+	if override == nil {
+		content, _ := builtinFile(locale, name+".html")
+		if _, err := htmlTemplate.Parse(content); err != nil {
+			return rendered, fmt.Errorf("failed to parse %s template: %w", name, err)
+		}
+		content, _ = builtinFile(locale, name+".txt")
+		if _, err := textTemplate.Parse(content); err != nil {
+			return rendered, fmt.Errorf("failed to parse %s template: %w", name, err)
+		}
+	} else {
+		rendered.Source = TemplateSourceOverride
+		parts := []struct {
+			parse func(string, string) error
+			name  string
+			body  string
+		}{
+			{parseHTMLPart(htmlTemplate), "heading", override.Subject},
+			{parseHTMLPart(htmlTemplate), "content", override.HTML},
+			{parseTextPart(textTemplate), "subject", override.Subject},
+			{parseTextPart(textTemplate), "content", override.Text},
+		}
+		for _, part := range parts {
+			if err := part.parse(part.name, part.body); err != nil {
+				return rendered, fmt.Errorf("failed to parse %s of the %s template: %w", part.name, name, err)
+			}
+		}
+	}
+
+	values := map[string]interface{}{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Brand"] = brand
+	values["Locale"] = locale
+
+	var subject, html, text bytes.Buffer
+	if err := textTemplate.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return rendered, fmt.Errorf("failed to render subject of the %s template: %w", name, err)
+	}
+	if err := htmlTemplate.ExecuteTemplate(&html, "layout", values); err != nil {
+		return rendered, fmt.Errorf("failed to render the %s template: %w", name, err)
+	}
+	rendered.Subject = strings.Join(strings.Fields(subject.String()), " ")
+	rendered.HTML = html.String()
+
+	// Overrides without a plain text body get one made from their HTML
+	if override != nil && strings.TrimSpace(override.Text) == "" {
+		rendered.Text = htmlToText(rendered.HTML)
+		return rendered, nil
+	}
+	if err := textTemplate.ExecuteTemplate(&text, "layout", values); err != nil {
+		return rendered, fmt.Errorf("failed to render the %s template: %w", name, err)
+	}
+	rendered.Text = strings.TrimSpace(text.String())
+	return rendered, nil
+}
+
+func parseHTMLPart(t *htmltemplate.Template) func(string, string) error {
+	return func(name string, body string) error {
+		_, err := t.New(name).Parse(body)
+		return err
+	}
+}
+
+func parseTextPart(t *texttemplate.Template) func(string, string) error {
+	return func(name string, body string) error {
+		_, err := t.New(name).Parse(body)
+		return err
+	}
+}
+
+// translate looks up a layout string, falling back to the default locale.
+func translate(locale string) func(string) string {
+	return func(key string) string {
+		for _, candidate := range localeChain(locale) {
+			if text, found := layoutStrings[candidate][key]; found {
+				return text
+			}
+		}
+		return key
+	}
+}
+
+func htmlFuncs(locale string) htmltemplate.FuncMap {
+	return htmltemplate.FuncMap{
+		"translate": translate(locale),
+		// Inline attachments are referenced as cid: URLs, which html/template
+		// would otherwise treat as unsafe
+		"cid": func(contentId string) htmltemplate.URL {
+			return htmltemplate.URL("cid:" + contentId)
+		},
+	}
+}
+
+func textFuncs(locale string) texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"translate": translate(locale),
+		"cid": func(contentId string) string {
+			return "cid:" + contentId
+		},
+	}
+}
+
+// RenderMessage renders a template into a message for one recipient.
+func RenderMessage(to string, name string, locale string, organizerId string, data map[string]interface{}) (Message, error) {
+	rendered, err := Render(name, locale, organizerId, data)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      []string{to},
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	}, nil
+}
+
+func fetchOverrides(name string, organizerId string, locales []string) ([]mailModel.EmailTemplate, error) {
+	db, col, err := mongoSetup.ConnectMongo("emailTemplates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, bson.M{
+		"name":        name,
+		"locale":      bson.M{"$in": locales},
+		"organizerId": bson.M{"$in": []string{organizerId, ""}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query email templates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var overrides []mailModel.EmailTemplate
+	if err := cursor.All(ctx, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to decode email templates: %w", err)
+	}
+	return overrides, nil
+}
+
+// ValidateTemplateOverride normalises an override and checks it renders
+// with the template's sample data.
+func ValidateTemplateOverride(override *mailModel.EmailTemplate) (mailModel.RenderedEmail, error) {
+	override.Name = strings.TrimSpace(override.Name)
+	override.OrganizerId = strings.TrimSpace(override.OrganizerId)
+	if !isTemplateName(override.Name) {
+		return mailModel.RenderedEmail{}, ErrUnknownTemplate
+	}
+	locale, err := NormaliseLocale(override.Locale)
+	if err != nil {
+		return mailModel.RenderedEmail{}, err
+	}
+	override.Locale = locale
+	if strings.TrimSpace(override.Subject) == "" {
+		return mailModel.RenderedEmail{}, ErrSubjectRequired
+	}
+	if strings.TrimSpace(override.HTML) == "" {
+		return mailModel.RenderedEmail{}, ErrHTMLRequired
+	}
+	preview, err := renderTemplate(override.Name, override, locale, BrandFor(override.OrganizerId), SampleData(override.Name))
+	if err != nil {
+		return preview, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return preview, nil
+}
+
+// IsTemplateValidationError reports whether an error is about the template
+// itself rather than a failure to save it.
+func IsTemplateValidationError(err error) bool {
+	for _, target := range []error{ErrUnknownTemplate, ErrInvalidLocale, ErrSubjectRequired, ErrHTMLRequired, ErrInvalidTemplate} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveTemplateOverride stores an override, replacing the one with the same
+// name, locale and organizer.
+func SaveTemplateOverride(override mailModel.EmailTemplate, updatedBy string) (mailModel.EmailTemplate, mailModel.RenderedEmail, error) {
+	preview, err := ValidateTemplateOverride(&override)
+	if err != nil {
+		return override, preview, err
+	}
+	override.UpdatedBy = updatedBy
+	override.UpdatedAt = time.Now().Unix()
+
+	db, col, err := mongoSetup.ConnectMongo("emailTemplates")
+	if err != nil {
+		return override, preview, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"name": override.Name, "locale": override.Locale, "organizerId": override.OrganizerId}
+	_, err = col.ReplaceOne(ctx, filter, override, options.Replace().SetUpsert(true))
+	if err != nil {
+		return override, preview, fmt.Errorf("failed to save email template: %w", err)
+	}
+	return override, preview, nil
+}
+
+// DeleteTemplateOverride removes an override, so the next one in line is
+// used again. It reports whether there was one to remove.
+func DeleteTemplateOverride(key mailModel.EmailTemplateKey) (bool, error) {
+	if !isTemplateName(key.Name) {
+		return false, ErrUnknownTemplate
+	}
+	locale, err := NormaliseLocale(key.Locale)
+	if err != nil {
+		return false, err
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("emailTemplates")
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := col.DeleteOne(ctx, bson.M{"name": key.Name, "locale": locale, "organizerId": strings.TrimSpace(key.OrganizerId)})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete email template: %w", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// ListTemplateOverrides returns the saved overrides, optionally of one
+// template or organizer.
+func ListTemplateOverrides(name string, organizerId string) ([]mailModel.EmailTemplate, error) {
+	db, col, err := mongoSetup.ConnectMongo("emailTemplates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if name != "" {
+		filter["name"] = name
+	}
+	if organizerId != "" {
+		filter["organizerId"] = organizerId
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "organizerId", Value: 1}, {Key: "locale", Value: 1}})
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query email templates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	overrides := []mailModel.EmailTemplate{}
+	if err := cursor.All(ctx, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to decode email templates: %w", err)
+	}
+	return overrides, nil
+}
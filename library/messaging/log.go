@@ -0,0 +1,16 @@
+package messagingutils
+
+import "log"
+
+// logNotifier only logs messages, for development and until a provider is
+// configured.
+type logNotifier struct{}
+
+func (logNotifier) Name() string {
+	return DriverLog
+}
+
+func (logNotifier) Send(message TextMessage) error {
+	log.Printf("[%s] to %s: %s", message.Channel, message.To, message.Body)
+	return nil
+}
@@ -0,0 +1,143 @@
+package messagingutils
+
+import (
+	commonutils "em_backend/library/common"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	ChannelSMS      = "sms"
+	ChannelWhatsApp = "whatsapp"
+
+	DriverTwilio = "twilio"
+	DriverLog    = "log"
+
+	// Numbers without a country code are assumed to be Indian
+	defaultCountryCode = "91"
+)
+
+var (
+	ErrUnknownChannel = errors.New("unknown messaging channel")
+	ErrInvalidPhone   = errors.New("invalid phone number")
+	ErrEmptyMessage   = errors.New("message has no text")
+	// ErrRejected is returned when the provider refuses a message, retrying
+	// it will not help
+	ErrRejected = errors.New("message rejected by provider")
+)
+
+// Channels lists the channels text messages can be sent through.
+var Channels = []string{ChannelSMS, ChannelWhatsApp}
+
+// TextMessage is a text ready to be sent to a phone number in E.164 format.
+type TextMessage struct {
+	Channel string
+	To      string
+	Body    string
+}
+
+// Notifier delivers text messages through one provider.
+type Notifier interface {
+	Name() string
+	Send(message TextMessage) error
+}
+
+// IsChannel reports whether channel is a text messaging channel.
+func IsChannel(channel string) bool {
+	for _, known := range Channels {
+		if channel == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveNotifier returns the notifier of a channel, selected by SMS_DRIVER or
+// WHATSAPP_DRIVER. Without configuration messages are only logged, so nothing
+// is sent to real phones by accident.
+func ActiveNotifier(channel string) (Notifier, error) {
+	var driver string
+	switch channel {
+	case ChannelSMS:
+		driver = commonutils.LoadEnv("SMS_DRIVER")
+	case ChannelWhatsApp:
+		driver = commonutils.LoadEnv("WHATSAPP_DRIVER")
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownChannel, channel)
+	}
+	return NotifierByName(driver)
+}
+
+// NotifierByName returns the notifier with the given driver name.
+func NotifierByName(name string) (Notifier, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", DriverLog:
+		return logNotifier{}, nil
+	case DriverTwilio:
+		return newTwilioNotifier(), nil
+	default:
+		return nil, fmt.Errorf("unknown messaging driver '%s'", name)
+	}
+}
+
+// Send delivers a text message through the notifier of its channel.
+func Send(message TextMessage) error {
+	to, err := NormalisePhone(message.To)
+	if err != nil {
+		return err
+	}
+	message.To = to
+	if strings.TrimSpace(message.Body) == "" {
+		return ErrEmptyMessage
+	}
+	notifier, err := ActiveNotifier(message.Channel)
+	if err != nil {
+		return err
+	}
+	return notifier.Send(message)
+}
+
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// NormalisePhone turns a phone number into E.164, e.g. "098765 43210" into
+// "+919876543210". Numbers without a country code get DEFAULT_COUNTRY_CODE.
+func NormalisePhone(phone string) (string, error) {
+	var digits strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + strings.TrimPrefix(number, "00")
+	default:
+		countryCode := strings.TrimPrefix(strings.TrimSpace(commonutils.LoadEnv("DEFAULT_COUNTRY_CODE")), "+")
+		if countryCode == "" {
+			countryCode = defaultCountryCode
+		}
+		number = "+" + countryCode + strings.TrimLeft(number, "0")
+	}
+	if !phonePattern.MatchString(number) {
+		return "", ErrInvalidPhone
+	}
+	return number, nil
+}
+
+// MaskPhone hides all but the last digits of a phone number.
+func MaskPhone(phone string) string {
+	if len(phone) <= 4 {
+		return phone
+	}
+	return strings.Repeat("*", len(phone)-4) + phone[len(phone)-4:]
+}
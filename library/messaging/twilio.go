@@ -0,0 +1,76 @@
+package messagingutils
+
+import (
+	commonutils "em_backend/library/common"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const twilioAPI = "https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json"
+
+// twilioNotifier sends SMS and WhatsApp messages with the Twilio API, from
+// TWILIO_SMS_FROM and TWILIO_WHATSAPP_FROM respectively.
+type twilioNotifier struct {
+	accountSid   string
+	authToken    string
+	smsFrom      string
+	whatsAppFrom string
+	client       *http.Client
+}
+
+func newTwilioNotifier() twilioNotifier {
+	return twilioNotifier{
+		accountSid:   commonutils.LoadEnv("TWILIO_ACCOUNT_SID"),
+		authToken:    commonutils.LoadEnv("TWILIO_AUTH_TOKEN"),
+		smsFrom:      commonutils.LoadEnv("TWILIO_SMS_FROM"),
+		whatsAppFrom: commonutils.LoadEnv("TWILIO_WHATSAPP_FROM"),
+		client:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (t twilioNotifier) Name() string {
+	return DriverTwilio
+}
+
+func (t twilioNotifier) Send(message TextMessage) error {
+	if t.accountSid == "" || t.authToken == "" {
+		return fmt.Errorf("twilio is not configured")
+	}
+	from, to := t.smsFrom, message.To
+	if message.Channel == ChannelWhatsApp {
+		from, to = "whatsapp:"+t.whatsAppFrom, "whatsapp:"+message.To
+	}
+
+	form := url.Values{"From": {from}, "To": {to}, "Body": {message.Body}}
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf(twilioAPI, t.accountSid), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create twilio request: %w", err)
+	}
+	request.SetBasicAuth(t.accountSid, t.authToken)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to send %s: %w", message.Channel, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 300 {
+		return nil
+	}
+
+	var failure struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(response.Body).Decode(&failure)
+	err = fmt.Errorf("twilio returned %d: %d %s", response.StatusCode, failure.Code, failure.Message)
+	// Client errors other than rate limiting fail the same way every time
+	if response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	return err
+}
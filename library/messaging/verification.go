@@ -0,0 +1,174 @@
+package messagingutils
+
+import (
+	"context"
+	"crypto/rand"
+	mongoSetup "em_backend/configs/mongo"
+	redisSetup "em_backend/configs/redis"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	phoneCodeExpiry      = 10 * time.Minute
+	maxPhoneCodeAttempts = 5
+
+	// A new code can be sent to a user or a number once a minute, and at
+	// most maxPhoneCodesPerDay times a day
+	phoneCodeCooldown   = time.Minute
+	maxPhoneCodesPerDay = 10
+)
+
+var (
+	ErrCodeExpired     = errors.New("verification code has expired, request a new one")
+	ErrCodeInvalid     = errors.New("invalid verification code")
+	ErrTooManyAttempts = errors.New("too many attempts, try again later")
+	ErrResendTooSoon   = errors.New("a code was sent recently, wait a minute before requesting another")
+	ErrTooManyCodes    = errors.New("too many codes requested today, try again tomorrow")
+)
+
+func phoneVerificationKey(email string) string {
+	return fmt.Sprintf("phoneverification:%s", email)
+}
+
+// The attempts are kept apart from the code so that sending a new code does
+// not reset them.
+func phoneAttemptsKey(email string) string {
+	return fmt.Sprintf("phoneverification:attempts:%s", email)
+}
+
+// allowPhoneCode applies the resend cooldown and the daily cap to both the
+// user and the number.
+func allowPhoneCode(r *redis.Client, email string, phone string) error {
+	subjects := []string{"user:" + email, "phone:" + phone}
+	for _, subject := range subjects {
+		sent, err := r.SetNX(fmt.Sprintf("phoneverification:cooldown:%s", subject), 1, phoneCodeCooldown).Result()
+		if err != nil {
+			return fmt.Errorf("failed to check resend cooldown: %w", err)
+		}
+		if !sent {
+			return ErrResendTooSoon
+		}
+	}
+	for _, subject := range subjects {
+		key := fmt.Sprintf("phoneverification:daily:%s", subject)
+		count, err := r.Incr(key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to count verification codes: %w", err)
+		}
+		if count == 1 {
+			r.Expire(key, 24*time.Hour)
+		}
+		if count > maxPhoneCodesPerDay {
+			return ErrTooManyCodes
+		}
+	}
+	return nil
+}
+
+// SendPhoneVerification texts a code to a number a user wants to add to
+// their profile. The number is only saved once the code is confirmed with
+// VerifyPhone.
+func SendPhoneVerification(email string, phone string, channel string) (string, error) {
+	if channel == "" {
+		channel = ChannelSMS
+	}
+	if !IsChannel(channel) {
+		return "", fmt.Errorf("%w '%s'", ErrUnknownChannel, channel)
+	}
+	phone, err := NormalisePhone(phone)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := redisSetup.ConnectToRedis()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	defer r.Close()
+
+	if err := allowPhoneCode(r, email, phone); err != nil {
+		return "", err
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate verification code: %w", err)
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	key := phoneVerificationKey(email)
+	if err := r.HMSet(key, map[string]interface{}{"phone": phone, "code": code}).Err(); err != nil {
+		return "", fmt.Errorf("failed to store verification code: %w", err)
+	}
+	r.Expire(key, phoneCodeExpiry)
+
+	err = Send(TextMessage{
+		Channel: channel,
+		To:      phone,
+		Body:    fmt.Sprintf("Your STUNI verification code is %s. It expires in %d minutes.", code, int(phoneCodeExpiry/time.Minute)),
+	})
+	if err != nil {
+		r.Del(key)
+		return "", err
+	}
+	return phone, nil
+}
+
+// VerifyPhone checks the code sent by SendPhoneVerification and saves the
+// number on the user's profile as verified.
+func VerifyPhone(email string, code string) (string, error) {
+	r, err := redisSetup.ConnectToRedis()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	defer r.Close()
+
+	key := phoneVerificationKey(email)
+	attemptsKey := phoneAttemptsKey(email)
+	if attempts, _ := r.Get(attemptsKey).Int64(); attempts >= maxPhoneCodeAttempts {
+		return "", ErrTooManyAttempts
+	}
+	pending, err := r.HGetAll(key).Result()
+	if err != nil && err != redis.Nil {
+		return "", fmt.Errorf("failed to fetch verification code: %w", err)
+	}
+	if pending["code"] == "" {
+		return "", ErrCodeExpired
+	}
+	if strings.TrimSpace(code) != pending["code"] {
+		attempts, _ := r.Incr(attemptsKey).Result()
+		if attempts == 1 {
+			r.Expire(attemptsKey, phoneCodeExpiry)
+		}
+		if attempts >= maxPhoneCodeAttempts {
+			r.Del(key)
+			return "", ErrTooManyAttempts
+		}
+		return "", ErrCodeInvalid
+	}
+	r.Del(key, attemptsKey)
+
+	db, col, err := mongoSetup.ConnectMongo("userData")
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	phone := pending["phone"]
+	if _, err := col.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{
+		"phone":           phone,
+		"phoneVerified":   true,
+		"phoneVerifiedAt": time.Now().Unix(),
+	}}); err != nil {
+		return "", fmt.Errorf("failed to save phone number: %w", err)
+	}
+	return phone, nil
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	redisSetup "em_backend/configs/redis"
+	common_resp "em_backend/responses/common"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// Stored responses are replayed for retries within this window
+	idempotencyTTL = 24 * time.Hour
+	// A claim is dropped after this long if its request never finished. It
+	// is refreshed while the handler runs, so slow handlers keep it.
+	idempotencyClaimTTL     = time.Minute
+	idempotencyClaimRefresh = idempotencyClaimTTL / 3
+
+	idempotencyStateProcessing = "processing"
+	idempotencyStateDone       = "done"
+)
+
+// The client is shared by all requests; it keeps its own connection pool
+var (
+	idempotencyRedis     *redis.Client
+	idempotencyRedisLock sync.Mutex
+)
+
+// idempotencyClient returns the shared Redis client, connecting on first use.
+func idempotencyClient() (*redis.Client, error) {
+	idempotencyRedisLock.Lock()
+	defer idempotencyRedisLock.Unlock()
+	if idempotencyRedis == nil {
+		client, err := redisSetup.ConnectToRedis()
+		if err != nil {
+			return nil, err
+		}
+		idempotencyRedis = client
+	}
+	return idempotencyRedis, nil
+}
+
+type idempotencyRecord struct {
+	State       string `json:"state"`
+	RequestHash string `json:"requestHash"`
+	StatusCode  int    `json:"statusCode,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// IdempotencyMiddleware makes state changing requests safe to retry. When a
+// request carries an Idempotency-Key header, the first response for that key
+// is stored and replayed for later requests with the same key and body. Keys
+// are scoped to the session user and the route. It must run after the
+// authentication middleware and is mounted only on routes that change state.
+func IdempotencyMiddleware(ctx *fiber.Ctx) error {
+	key := strings.TrimSpace(ctx.Get(IdempotencyKeyHeader))
+	if key == "" {
+		return ctx.Next()
+	}
+	if len(key) > 255 {
+		return ctx.JSON(common_resp.FailureResponse{
+			Status:  "400 Bad Request",
+			Message: "Idempotency-Key is too long",
+		})
+	}
+
+	redisClient, err := idempotencyClient()
+	if err != nil {
+		// Without Redis the request is handled as if it had no key
+		fmt.Println("Idempotency disabled, Redis unavailable:", err)
+		return ctx.Next()
+	}
+
+	sessionUserData, _ := ctx.Locals("userData").(common_resp.LoginDetails)
+	redisKey := fmt.Sprintf("idempotency:%s:%s:%s", sessionUserData.Email, ctx.Path(), key)
+	bodyHash := sha256.Sum256(ctx.Body())
+	requestHash := hex.EncodeToString(bodyHash[:])
+
+	// Claim the key; only the first request with it is processed
+	claim, _ := json.Marshal(idempotencyRecord{State: idempotencyStateProcessing, RequestHash: requestHash})
+	claimed, err := redisClient.SetNX(redisKey, claim, idempotencyClaimTTL).Result()
+	if err != nil {
+		fmt.Println("Error claiming idempotency key:", err)
+		return ctx.Next()
+	}
+
+	if !claimed {
+		value, err := redisClient.Get(redisKey).Result()
+		var record idempotencyRecord
+		if err == nil {
+			err = json.Unmarshal([]byte(value), &record)
+		}
+		if err != nil {
+			fmt.Println("Error reading idempotency key:", err)
+			return ctx.JSON(common_resp.FailureResponse{
+				Status:  "409 Conflict",
+				Message: "A request with this Idempotency-Key is in progress, please retry",
+			})
+		}
+		if record.RequestHash != requestHash {
+			return ctx.JSON(common_resp.FailureResponse{
+				Status:  "422 Unprocessable Entity",
+				Message: "Idempotency-Key was already used with a different request",
+			})
+		}
+		if record.State != idempotencyStateDone {
+			return ctx.JSON(common_resp.FailureResponse{
+				Status:  "409 Conflict",
+				Message: "A request with this Idempotency-Key is in progress, please retry",
+			})
+		}
+
+		// Replay the stored response
+		ctx.Set("Idempotent-Replayed", "true")
+		if record.ContentType != "" {
+			ctx.Set(fiber.HeaderContentType, record.ContentType)
+		}
+		return ctx.Status(record.StatusCode).SendString(record.Body)
+	}
+
+	stopRefresh := refreshClaim(redisClient, redisKey)
+	// Also stops refreshing if the handler panics
+	defer stopRefresh()
+	err = ctx.Next()
+	stopRefresh()
+	if err != nil {
+		redisClient.Del(redisKey)
+		return err
+	}
+
+	// Server errors are not stored so the retry is processed again
+	body := ctx.Response().Body()
+	statusCode := ctx.Response().StatusCode()
+	if statusCode >= fiber.StatusInternalServerError || isServerErrorBody(body) {
+		redisClient.Del(redisKey)
+		return nil
+	}
+
+	record, _ := json.Marshal(idempotencyRecord{
+		State:       idempotencyStateDone,
+		RequestHash: requestHash,
+		StatusCode:  statusCode,
+		ContentType: string(ctx.Response().Header.ContentType()),
+		Body:        string(body),
+	})
+	if err := redisClient.Set(redisKey, record, idempotencyTTL).Err(); err != nil {
+		fmt.Println("Error storing idempotent response:", err)
+	}
+	return nil
+}
+
+// refreshClaim keeps extending a claim until the returned function is called.
+// That function only returns once refreshing has stopped, so a later write of
+// the stored response cannot have its expiry changed, and may be called again.
+func refreshClaim(redisClient *redis.Client, redisKey string) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(idempotencyClaimRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := redisClient.Expire(redisKey, idempotencyClaimTTL).Err(); err != nil {
+					fmt.Println("Error refreshing idempotency claim:", err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+		<-stopped
+	}
+}
+
+// isServerErrorBody reports whether a JSON response reports a 5xx status in
+// its body, which is how most handlers signal failures.
+func isServerErrorBody(body []byte) bool {
+	var response struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return false
+	}
+	return strings.HasPrefix(response.Status, "5")
+}
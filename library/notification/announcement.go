@@ -0,0 +1,318 @@
+package notifyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	eventutils "em_backend/library/events"
+	mailutils "em_backend/library/mail"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JobAnnouncement = "announcement"
+
+	SegmentCheckedIn    = "checked_in"
+	SegmentNotCheckedIn = "not_checked_in"
+
+	maxAnnouncementSubject = 150
+	maxAnnouncementMessage = 5000
+)
+
+var (
+	ErrInvalidAnnouncement = errors.New("invalid announcement")
+	ErrEventNotFound       = errors.New("event not found")
+	ErrNoMatchingAttendees = errors.New("no registrants match the announcement's segment")
+)
+
+// ValidateAnnouncement trims an announcement and checks it can be sent.
+func ValidateAnnouncement(request *notificationModel.AnnouncementReq) error {
+	request.Subject = strings.TrimSpace(request.Subject)
+	request.Message = strings.TrimSpace(request.Message)
+	switch {
+	case request.EventId == "":
+		return fmt.Errorf("%w: event ID is required", ErrInvalidAnnouncement)
+	case request.Subject == "":
+		return fmt.Errorf("%w: subject is required", ErrInvalidAnnouncement)
+	case len(request.Subject) > maxAnnouncementSubject:
+		return fmt.Errorf("%w: subject can be at most %d characters", ErrInvalidAnnouncement, maxAnnouncementSubject)
+	case request.Message == "":
+		return fmt.Errorf("%w: message is required", ErrInvalidAnnouncement)
+	case len(request.Message) > maxAnnouncementMessage:
+		return fmt.Errorf("%w: message can be at most %d characters", ErrInvalidAnnouncement, maxAnnouncementMessage)
+	}
+	switch request.Segment.CheckIn {
+	case "", SegmentCheckedIn, SegmentNotCheckedIn:
+	default:
+		return fmt.Errorf("%w: check-in segment must be %s or %s", ErrInvalidAnnouncement, SegmentCheckedIn, SegmentNotCheckedIn)
+	}
+	return nil
+}
+
+// segmentFilter matches the confirmed registrations of an event in a segment.
+func segmentFilter(eventId string, segment notificationModel.AnnouncementSegment) bson.M {
+	filter := bson.M{
+		"uniqueId": eventId,
+		"status":   eventutils.RegistrationStatusConfirmed,
+	}
+	// Ticket verification has stored the flag under both spellings
+	checkedIn := bson.A{
+		bson.M{"isticketverified": true},
+		bson.M{"isTicketVerified": true},
+	}
+	switch segment.CheckIn {
+	case SegmentCheckedIn:
+		filter["$or"] = checkedIn
+	case SegmentNotCheckedIn:
+		filter["$nor"] = checkedIn
+	}
+	if len(segment.TicketTypeIds) > 0 {
+		filter["ticketTypeId"] = bson.M{"$in": segment.TicketTypeIds}
+	}
+	if segment.TeamCaptains {
+		filter["teamDetailsForm.0"] = bson.M{"$exists": true}
+	}
+	return filter
+}
+
+// SendAnnouncement saves an announcement in the history of its event and
+// queues it for every registrant in its segment, by email and in their
+// in-app feed. Each person receives it once however many tickets they hold.
+func SendAnnouncement(request notificationModel.AnnouncementReq, createdBy string) (notificationModel.Announcement, error) {
+	var announcement notificationModel.Announcement
+	if err := ValidateAnnouncement(&request); err != nil {
+		return announcement, err
+	}
+	if _, err := eventutils.FetchEvent(request.EventId); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return announcement, ErrEventNotFound
+		}
+		return announcement, fmt.Errorf("failed to fetch event: %w", err)
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return announcement, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, segmentFilter(request.EventId, request.Segment), options.Find().SetProjection(bson.M{
+		"registrationid": 1, "primaryemailid": 1, "attendeeEmail": 1, "groupOrderId": 1,
+	}))
+	if err != nil {
+		return announcement, fmt.Errorf("failed to fetch registrations: %w", err)
+	}
+	var registrations []dbModel.RegistrationData
+	if err := cursor.All(ctx, &registrations); err != nil {
+		return announcement, fmt.Errorf("failed to decode registrations: %w", err)
+	}
+
+	// One registration per person; team captains are whoever registered
+	recipients := map[string]string{}
+	for _, registration := range registrations {
+		email := registration.AttendeeEmail
+		if request.Segment.TeamCaptains {
+			email = registration.PrimaryEmailId
+		} else if email == "" {
+			// Group tickets nobody has been assigned to yet
+			if registration.GroupOrderId != "" {
+				continue
+			}
+			email = registration.PrimaryEmailId
+		}
+		email = strings.ToLower(strings.TrimSpace(email))
+		if _, found := recipients[email]; !found && email != "" {
+			recipients[email] = registration.RegistrationId
+		}
+	}
+	if len(recipients) == 0 {
+		return announcement, ErrNoMatchingAttendees
+	}
+
+	announcement = notificationModel.Announcement{
+		AnnouncementId: uuid.New().String(),
+		Subject:        request.Subject,
+		Message:        request.Message,
+		Segment:        request.Segment,
+		Recipients:     len(recipients),
+		CreatedBy:      createdBy,
+		CreatedAt:      time.Now().Unix(),
+	}
+	if _, err := db.Collection("events").UpdateOne(ctx, bson.M{"uniqueId": request.EventId}, bson.M{
+		"$push": bson.M{"announcements": announcement},
+	}); err != nil {
+		return announcement, fmt.Errorf("failed to save announcement: %w", err)
+	}
+
+	for email, registrationId := range recipients {
+		EnqueueLogged(JobAnnouncement, notificationModel.NotificationPayload{
+			RegistrationId: registrationId,
+			EventId:        request.EventId,
+			AnnouncementId: announcement.AnnouncementId,
+		}, fmt.Sprintf("%s:%s:%s", JobAnnouncement, announcement.AnnouncementId, email))
+	}
+	return announcement, nil
+}
+
+// ListAnnouncements returns the announcements of an event, newest first,
+// with how many of their notifications are pending, sent or failed.
+func ListAnnouncements(eventId string) ([]notificationModel.AnnouncementReport, error) {
+	db, col, err := mongoSetup.ConnectMongo("events")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var event dbModel.Event
+	err = col.FindOne(ctx, bson.M{"uniqueId": eventId}, options.FindOne().SetProjection(bson.M{"announcements": 1})).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrEventNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch event: %w", err)
+	}
+
+	reports := []notificationModel.AnnouncementReport{}
+	if len(event.Announcements) == 0 {
+		return reports, nil
+	}
+	ids := []string{}
+	for _, announcement := range event.Announcements {
+		ids = append(ids, announcement.AnnouncementId)
+	}
+
+	cursor, err := db.Collection("notificationJobs").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"type": JobAnnouncement, "payload.announcementId": bson.M{"$in": ids}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"announcementId": "$payload.announcementId", "status": "$status"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count announcement deliveries: %w", err)
+	}
+	var counts []struct {
+		Id struct {
+			AnnouncementId string `bson:"announcementId"`
+			Status         string `bson:"status"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, fmt.Errorf("failed to decode announcement deliveries: %w", err)
+	}
+
+	byId := map[string]*notificationModel.AnnouncementReport{}
+	for i := len(event.Announcements) - 1; i >= 0; i-- {
+		reports = append(reports, notificationModel.AnnouncementReport{Announcement: event.Announcements[i]})
+	}
+	for i := range reports {
+		byId[reports[i].AnnouncementId] = &reports[i]
+	}
+	for _, count := range counts {
+		report, found := byId[count.Id.AnnouncementId]
+		if !found {
+			continue
+		}
+		switch count.Id.Status {
+		case JobStatusSent:
+			report.Sent += count.Count
+		case JobStatusDead:
+			report.Failed += count.Count
+		default:
+			report.Pending += count.Count
+		}
+	}
+	return reports, nil
+}
+
+// sendAnnouncement delivers an announcement to one registrant, in their
+// feed and by email.
+func sendAnnouncement(job notificationModel.NotificationJob) error {
+	event, err := fetchEvent(job.Payload.EventId)
+	if err != nil {
+		return err
+	}
+	var announcement *notificationModel.Announcement
+	for i := range event.Announcements {
+		if event.Announcements[i].AnnouncementId == job.Payload.AnnouncementId {
+			announcement = &event.Announcements[i]
+		}
+	}
+	if announcement == nil {
+		return permanent(fmt.Errorf("announcement %s not found", job.Payload.AnnouncementId))
+	}
+
+	registrations, err := fetchRegistrations([]string{job.Payload.RegistrationId})
+	if err != nil {
+		return err
+	}
+	if len(registrations) == 0 || registrations[0].Status != eventutils.RegistrationStatusConfirmed {
+		return nil
+	}
+	registration := registrations[0]
+	to := registrationRecipient(registration)
+	if announcement.Segment.TeamCaptains {
+		to = lookupRecipient(registration.PrimaryEmailId, "")
+	}
+
+	if err := addToFeed(notificationModel.FeedItem{
+		UserEmail: to.Email,
+		Type:      FeedAnnouncement,
+		Title:     fmt.Sprintf("%s: %s", event.EventName, announcement.Subject),
+		Body:      announcement.Message,
+		EventId:   event.UniqueId,
+		SourceId:  job.DedupeKey,
+	}); err != nil {
+		return err
+	}
+
+	organizer := ""
+	if event.OrganizerId != "" {
+		organizer = mailutils.BrandFor(event.OrganizerId).Name
+	}
+	message, err := mailutils.RenderMessage(to.Email, mailutils.TemplateAnnouncement, to.Locale, event.OrganizerId, map[string]interface{}{
+		"Name":       to.greetingName(),
+		"EventName":  event.EventName,
+		"Subject":    announcement.Subject,
+		"Message":    announcement.Message,
+		"Paragraphs": paragraphs(announcement.Message),
+		"Organizer":  organizer,
+	})
+	if err != nil {
+		return permanent(err)
+	}
+	if err := deliver(message); err != nil {
+		return err
+	}
+
+	queueTextMessages(JobAnnouncement, jobSource(job), to,
+		fmt.Sprintf("%s: %s - %s", event.EventName, announcement.Subject, announcement.Message))
+	return nil
+}
+
+// paragraphs splits text at blank lines.
+func paragraphs(text string) []string {
+	var result []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+	return result
+}
@@ -0,0 +1,259 @@
+package notifyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	currencyutils "em_backend/library/currency"
+	eventutils "em_backend/library/events"
+	invoiceutils "em_backend/library/invoice"
+	mailutils "em_backend/library/mail"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	paymentModel "em_backend/models/payment"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const qrContentId = "ticket-qr"
+
+// SendRegistrationConfirmations emails the attendee of every confirmed
+// registration among registrationIds their QR ticket and a calendar invite.
+// Group tickets nobody has been assigned to yet are skipped, the buyer hands
+// them out from the group order.
+func SendRegistrationConfirmations(registrationIds []string) error {
+	registrations, err := fetchRegistrations(registrationIds)
+	if err != nil {
+		return err
+	}
+
+	events := map[string]dbModel.Event{}
+	var errs []error
+	for _, registration := range registrations {
+		if registration.Status != eventutils.RegistrationStatusConfirmed {
+			continue
+		}
+		if registration.GroupOrderId != "" && registration.AttendeeEmail == "" {
+			continue
+		}
+		event, found := events[registration.UniqueId]
+		if !found {
+			if event, err = fetchEvent(registration.UniqueId); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			events[registration.UniqueId] = event
+		}
+		if err := sendTicketEmail(JobRegistrationConfirmation, event, registration); err != nil {
+			errs = append(errs, fmt.Errorf("registration %s: %w", registration.RegistrationId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendTicket emails a group ticket to the attendee it was assigned to.
+func SendTicket(registrationId string) error {
+	registrations, err := fetchRegistrations([]string{registrationId})
+	if err != nil {
+		return err
+	}
+	if len(registrations) == 0 || registrations[0].Status != eventutils.RegistrationStatusConfirmed {
+		return nil
+	}
+	event, err := fetchEvent(registrations[0].UniqueId)
+	if err != nil {
+		return err
+	}
+	return sendTicketEmail(JobTicket, event, registrations[0])
+}
+
+// sendTicketEmail sends the confirmation or ticket email of a registration
+// with its QR code inline and the event as a calendar invite, and texts it
+// to attendees who chose to.
+func sendTicketEmail(notificationType string, event dbModel.Event, registration dbModel.RegistrationData) error {
+	templateName := mailutils.TemplateRegistrationConfirmation
+	if notificationType == JobTicket {
+		templateName = mailutils.TemplateTicket
+	}
+	to := registrationRecipient(registration)
+
+	// Registrations confirmed before QR codes were stored get a fresh one
+	qrCode := registration.QrCode
+	if qrCode == "" {
+		var err error
+		if qrCode, err = eventutils.GenerateTicketQR(registration.RegistrationId); err != nil {
+			return fmt.Errorf("failed to generate QR code: %w", err)
+		}
+	}
+	qrPNG, err := base64.StdEncoding.DecodeString(qrCode)
+	if err != nil {
+		return fmt.Errorf("failed to decode QR code: %w", err)
+	}
+
+	message, err := mailutils.RenderMessage(to.Email, templateName, to.Locale, event.OrganizerId, map[string]interface{}{
+		"Name":           to.greetingName(),
+		"EventName":      event.EventName,
+		"EventDate":      FormatEventDate(event.EventDate),
+		"Venue":          eventVenue(event),
+		"TicketType":     registration.TicketTypeName,
+		"RegistrationId": registration.RegistrationId,
+		"TicketId":       registration.RegistrationId,
+		"ManageURL":      eventutils.RegistrationManageURL(registration.RegistrationId),
+		"QRContentID":    qrContentId,
+	})
+	if err != nil {
+		return permanent(err)
+	}
+	message.Attachments = []mailutils.Attachment{
+		{
+			FileName:    fmt.Sprintf("ticket-%s.png", registration.RegistrationId),
+			ContentType: "image/png",
+			ContentID:   qrContentId,
+			Data:        qrPNG,
+		},
+		calendarAttachment(event),
+	}
+	if notificationType == JobRegistrationConfirmation {
+		err := addToFeed(notificationModel.FeedItem{
+			UserEmail: to.Email,
+			Type:      FeedRegistrationConfirmed,
+			Title:     "Registration confirmed",
+			Body: fmt.Sprintf("You're registered for %s on %s. Your ticket ID is %s.",
+				event.EventName, FormatEventDate(event.EventDate), registration.RegistrationId),
+			EventId:  event.UniqueId,
+			SourceId: fmt.Sprintf("%s:%s:%s", FeedRegistrationConfirmed, registration.RegistrationId, to.Email),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := deliver(message); err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("You're registered for %s on %s. Ticket ID: %s. Your QR ticket is in your email.",
+		event.EventName, FormatEventDate(event.EventDate), registration.RegistrationId)
+	queueTextMessages(notificationType, fmt.Sprintf("%s:%s:%s", notificationType, registration.RegistrationId, to.Email), to, text)
+	return nil
+}
+
+// SendPaymentReceipt emails the buyer of a paid order a receipt with the
+// order's invoice attached. The receipt still goes out if the order cannot
+// be invoiced, e.g. when its event has no organizer configured.
+func SendPaymentReceipt(order paymentModel.OrderDetails) error {
+	event, err := fetchEvent(order.EventId)
+	if err != nil {
+		return err
+	}
+	to := lookupRecipient(order.UserEmail, order.BillingDetails.Name)
+
+	items := []map[string]interface{}{}
+	invoiceNumber := ""
+	var attachments []mailutils.Attachment
+	invoice, err := invoiceutils.GenerateInvoice(order)
+	if errors.Is(err, invoiceutils.ErrInvoicePending) {
+		// Retry once the request issuing it is done
+		return err
+	}
+	if err == nil {
+		invoiceNumber = invoice.InvoiceNumber
+		for _, item := range invoice.Items {
+			items = append(items, map[string]interface{}{
+				"Description": item.Description,
+				"Quantity":    item.Quantity,
+				"Amount":      currencyutils.Format(item.Amount, order.Currency),
+			})
+		}
+		attachments = append(attachments, mailutils.Attachment{
+			FileName:    invoiceutils.InvoiceFileName(invoice),
+			ContentType: "application/pdf",
+			Data:        invoiceutils.RenderInvoicePDF(invoice),
+		})
+	} else {
+		log.Printf("Sending receipt of order %s without an invoice: %v", order.OrderID, err)
+		items = append(items, map[string]interface{}{
+			"Description": event.EventName,
+			"Quantity":    order.TicketCount,
+			"Amount":      currencyutils.Format(order.Amount, order.Currency),
+		})
+	}
+
+	message, err := mailutils.RenderMessage(to.Email, mailutils.TemplatePaymentReceipt, to.Locale, event.OrganizerId, map[string]interface{}{
+		"Name":          to.greetingName(),
+		"EventName":     event.EventName,
+		"Amount":        currencyutils.Format(order.Amount, order.Currency),
+		"Items":         items,
+		"OrderId":       order.OrderID,
+		"PaymentId":     order.PaymentId,
+		"InvoiceNumber": invoiceNumber,
+	})
+	if err != nil {
+		return permanent(err)
+	}
+	message.Attachments = attachments
+	return deliver(message)
+}
+
+func fetchRegistrations(registrationIds []string) ([]dbModel.RegistrationData, error) {
+	if len(registrationIds) == 0 {
+		return nil, nil
+	}
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, bson.M{"registrationid": bson.M{"$in": registrationIds}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registrations: %w", err)
+	}
+	var registrations []dbModel.RegistrationData
+	if err := cursor.All(ctx, &registrations); err != nil {
+		return nil, fmt.Errorf("failed to decode registrations: %w", err)
+	}
+	return registrations, nil
+}
+
+// deliver sends an email, marking failures that retrying cannot fix.
+func deliver(message mailutils.Message) error {
+	err := mailutils.Send(message)
+	if errors.Is(err, mailutils.ErrNoRecipients) || errors.Is(err, mailutils.ErrInvalidAddress) {
+		return permanent(err)
+	}
+	return err
+}
+
+func fetchEvent(eventId string) (dbModel.Event, error) {
+	event, err := eventutils.FetchEvent(eventId)
+	if err == mongo.ErrNoDocuments {
+		return event, permanent(fmt.Errorf("event %s not found", eventId))
+	}
+	if err != nil {
+		return event, fmt.Errorf("failed to fetch event %s: %w", eventId, err)
+	}
+	return event, nil
+}
+
+func fetchOrder(orderId string) (paymentModel.OrderDetails, error) {
+	var order paymentModel.OrderDetails
+	result, err := mongoSetup.FindOneDoc("orderDetails", bson.M{"orderId": orderId}, bson.M{})
+	if err != nil {
+		return order, fmt.Errorf("failed to fetch order %s: %w", orderId, err)
+	}
+	if err := result.Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return order, permanent(fmt.Errorf("order %s not found", orderId))
+		}
+		return order, fmt.Errorf("failed to decode order %s: %w", orderId, err)
+	}
+	return order, nil
+}
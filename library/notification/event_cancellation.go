@@ -0,0 +1,106 @@
+package notifyutils
+
+import (
+	currencyutils "em_backend/library/currency"
+	mailutils "em_backend/library/mail"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	"fmt"
+	"strings"
+)
+
+const JobEventCancellation = "event_cancellation"
+
+// QueueEventCancellation queues an email telling the people holding the given
+// registrations of a cancelled event about it: the buyer of each
+// registration or group order, with refundAmount when their payment was
+// refunded, and the attendees group tickets were assigned to. Call it with
+// the registrations of one order at a time so the refund is shown to the
+// right buyer.
+func QueueEventCancellation(eventId string, registrations []dbModel.RegistrationData, reason string, refundAmount int64, currency string) {
+	for _, registration := range registrations {
+		// One email to the buyer per registration or group order
+		purchase := registration.RegistrationId
+		if registration.GroupOrderId != "" {
+			purchase = registration.GroupOrderId
+		}
+		EnqueueLogged(JobEventCancellation, notificationModel.NotificationPayload{
+			RegistrationId: registration.RegistrationId,
+			EventId:        eventId,
+			Email:          registration.PrimaryEmailId,
+			Reason:         reason,
+			RefundAmount:   refundAmount,
+			Currency:       currency,
+		}, fmt.Sprintf("%s:%s:%s", JobEventCancellation, purchase, registration.PrimaryEmailId))
+
+		attendee := strings.TrimSpace(registration.AttendeeEmail)
+		if attendee == "" || strings.EqualFold(attendee, registration.PrimaryEmailId) {
+			continue
+		}
+		EnqueueLogged(JobEventCancellation, notificationModel.NotificationPayload{
+			RegistrationId: registration.RegistrationId,
+			EventId:        eventId,
+			Email:          attendee,
+			Reason:         reason,
+		}, fmt.Sprintf("%s:%s:%s", JobEventCancellation, registration.RegistrationId, attendee))
+	}
+}
+
+// sendEventCancellation emails someone holding a registration of an event
+// that was cancelled, with the refund of their payment, if any.
+func sendEventCancellation(job notificationModel.NotificationJob) error {
+	registrations, err := fetchRegistrations([]string{job.Payload.RegistrationId})
+	if err != nil {
+		return err
+	}
+	if len(registrations) == 0 {
+		return nil
+	}
+	registration := registrations[0]
+
+	event, err := fetchEvent(registration.UniqueId)
+	if err != nil {
+		return err
+	}
+
+	name := ""
+	if strings.EqualFold(job.Payload.Email, registration.AttendeeEmail) {
+		name = registration.AttendeeName
+	}
+	to := lookupRecipient(job.Payload.Email, name)
+	refundAmount := ""
+	if job.Payload.RefundAmount > 0 {
+		refundAmount = currencyutils.Format(job.Payload.RefundAmount, job.Payload.Currency)
+	}
+	message, err := mailutils.RenderMessage(to.Email, mailutils.TemplateEventCancellation, to.Locale, event.OrganizerId, map[string]interface{}{
+		"Name":         to.greetingName(),
+		"EventName":    event.EventName,
+		"EventDate":    FormatEventDate(event.EventDate),
+		"Reason":       job.Payload.Reason,
+		"RefundAmount": refundAmount,
+	})
+	if err != nil {
+		return permanent(err)
+	}
+
+	summary := fmt.Sprintf("%s on %s has been cancelled.", event.EventName, FormatEventDate(event.EventDate))
+	if refundAmount != "" {
+		summary += fmt.Sprintf(" A refund of %s has been issued.", refundAmount)
+	}
+	err = addToFeed(notificationModel.FeedItem{
+		UserEmail: to.Email,
+		Type:      FeedEventCancelled,
+		Title:     fmt.Sprintf("%s has been cancelled", event.EventName),
+		Body:      summary,
+		EventId:   event.UniqueId,
+		SourceId:  jobSource(job),
+	})
+	if err != nil {
+		return err
+	}
+	if err := deliver(message); err != nil {
+		return err
+	}
+	queueTextMessages(JobEventCancellation, jobSource(job), to, summary)
+	return nil
+}
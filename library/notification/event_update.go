@@ -0,0 +1,163 @@
+package notifyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	eventutils "em_backend/library/events"
+	mailutils "em_backend/library/mail"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const JobEventUpdate = "event_update"
+
+// EventChanges lists the changes between two versions of an event that
+// attendees are told about: when, where and how it takes place, and where
+// to join it online.
+func EventChanges(before dbModel.Event, after dbModel.Event) []notificationModel.EventChange {
+	var changes []notificationModel.EventChange
+	if before.EventDate != after.EventDate {
+		changes = append(changes, notificationModel.EventChange{
+			Field: "Date",
+			Old:   FormatEventDate(before.EventDate),
+			New:   FormatEventDate(after.EventDate),
+		})
+	}
+	if strings.TrimSpace(before.EventLocation) != strings.TrimSpace(after.EventLocation) {
+		changes = append(changes, notificationModel.EventChange{
+			Field: "Venue",
+			Old:   changeValue(before.EventLocation),
+			New:   changeValue(after.EventLocation),
+		})
+	}
+	if !strings.EqualFold(strings.TrimSpace(before.EventMode), strings.TrimSpace(after.EventMode)) {
+		changes = append(changes, notificationModel.EventChange{
+			Field: "Mode",
+			Old:   changeValue(before.EventMode),
+			New:   changeValue(after.EventMode),
+		})
+	}
+	if strings.TrimSpace(before.MeetingLink) != strings.TrimSpace(after.MeetingLink) {
+		changes = append(changes, notificationModel.EventChange{
+			Field: "Meeting link",
+			Old:   changeValue(before.MeetingLink),
+			New:   changeValue(after.MeetingLink),
+		})
+	}
+	return changes
+}
+
+func changeValue(value string) string {
+	if value = strings.TrimSpace(value); value == "" {
+		return "Not set"
+	}
+	return value
+}
+
+// QueueEventUpdate queues an email with the changes and the updated calendar
+// invite for every confirmed registration of an event. Call it after the
+// change and its CalendarSequence are saved. Events that are over, cancelled
+// or deactivated are not announced.
+func QueueEventUpdate(event dbModel.Event, changes []notificationModel.EventChange) {
+	if len(changes) == 0 || event.EventDate <= time.Now().Unix() ||
+		event.Status == eventutils.EventStatusCancelled || event.Status == eventutils.EventStatusInactive {
+		return
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		log.Printf("Failed to queue update of event %s: %v", event.UniqueId, err)
+		return
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, bson.M{
+		"uniqueId": event.UniqueId,
+		"status":   eventutils.RegistrationStatusConfirmed,
+	}, options.Find().SetProjection(bson.M{"registrationid": 1}))
+	if err != nil {
+		log.Printf("Failed to queue update of event %s: %v", event.UniqueId, err)
+		return
+	}
+	var registrations []dbModel.RegistrationData
+	if err := cursor.All(ctx, &registrations); err != nil {
+		log.Printf("Failed to queue update of event %s: %v", event.UniqueId, err)
+		return
+	}
+
+	// The sequence identifies the edit, so each attendee hears of it once
+	for _, registration := range registrations {
+		EnqueueLogged(JobEventUpdate, notificationModel.NotificationPayload{
+			RegistrationId: registration.RegistrationId,
+			EventId:        event.UniqueId,
+			Changes:        changes,
+		}, fmt.Sprintf("%s:%s:%d", JobEventUpdate, registration.RegistrationId, event.CalendarSequence))
+	}
+}
+
+// sendEventUpdate emails an attendee what changed about their event, with
+// the event as it is now as a calendar invite.
+func sendEventUpdate(job notificationModel.NotificationJob) error {
+	registrations, err := fetchRegistrations([]string{job.Payload.RegistrationId})
+	if err != nil {
+		return err
+	}
+	if len(registrations) == 0 || registrations[0].Status != eventutils.RegistrationStatusConfirmed {
+		return nil
+	}
+	registration := registrations[0]
+	if registration.GroupOrderId != "" && registration.AttendeeEmail == "" {
+		return nil
+	}
+
+	event, err := fetchEvent(registration.UniqueId)
+	if err != nil {
+		return err
+	}
+	if event.Status == eventutils.EventStatusCancelled || event.Status == eventutils.EventStatusInactive {
+		return nil
+	}
+
+	to := registrationRecipient(registration)
+	message, err := mailutils.RenderMessage(to.Email, mailutils.TemplateEventUpdate, to.Locale, event.OrganizerId, map[string]interface{}{
+		"Name":      to.greetingName(),
+		"EventName": event.EventName,
+		"Changes":   job.Payload.Changes,
+		"ManageURL": eventutils.RegistrationManageURL(registration.RegistrationId),
+	})
+	if err != nil {
+		return permanent(err)
+	}
+	message.Attachments = []mailutils.Attachment{calendarAttachment(event)}
+
+	summary := fmt.Sprintf("%s has changed.", event.EventName)
+	for _, change := range job.Payload.Changes {
+		summary += fmt.Sprintf(" %s: %s -> %s.", change.Field, change.Old, change.New)
+	}
+	err = addToFeed(notificationModel.FeedItem{
+		UserEmail: to.Email,
+		Type:      FeedEventChanged,
+		Title:     fmt.Sprintf("%s has changed", event.EventName),
+		Body:      summary,
+		EventId:   event.UniqueId,
+		SourceId:  jobSource(job),
+	})
+	if err != nil {
+		return err
+	}
+	if err := deliver(message); err != nil {
+		return err
+	}
+	queueTextMessages(JobEventUpdate, jobSource(job), to, summary)
+	return nil
+}
@@ -0,0 +1,166 @@
+package notifyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	notificationModel "em_backend/models/notification"
+	paymentModel "em_backend/models/payment"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Types of in-app notifications
+const (
+	FeedAnnouncement          = "announcement"
+	FeedRegistrationConfirmed = "registration_confirmed"
+	FeedPaymentFailed         = "payment_failed"
+	FeedEventChanged          = "event_changed"
+	FeedEventCancelled        = "event_cancelled"
+	// FeedWaitlistPromoted is reserved for when events get waitlists
+	FeedWaitlistPromoted = "waitlist_promoted"
+
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+// addToFeed adds a notification to a user's in-app feed. Items with a
+// SourceId already in the feed are dropped, so retried jobs add them once.
+func addToFeed(item notificationModel.FeedItem) error {
+	db, col, err := mongoSetup.ConnectMongo("inAppNotifications")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	item.NotificationId = uuid.New().String()
+	item.UserEmail = strings.ToLower(strings.TrimSpace(item.UserEmail))
+	item.CreatedAt = time.Now().Unix()
+	if _, err := col.InsertOne(ctx, item); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to add notification to feed: %w", err)
+	}
+	return nil
+}
+
+// ListFeed returns a page of a user's in-app notifications, newest first,
+// and how many of all their notifications are unread. Pass the createdAt of
+// the last item as Before to get the next page.
+func ListFeed(email string, request notificationModel.FeedListRequest) ([]notificationModel.FeedItem, int64, error) {
+	db, col, err := mongoSetup.ConnectMongo("inAppNotifications")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	filter := bson.M{"userEmail": email}
+	if request.Before > 0 {
+		filter["createdAt"] = bson.M{"$lt": request.Before}
+	}
+	if request.UnreadOnly {
+		filter["readAt"] = 0
+	}
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultFeedLimit
+	}
+	if limit > maxFeedLimit {
+		limit = maxFeedLimit
+	}
+
+	cursor, err := col.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch notifications: %w", err)
+	}
+	items := []notificationModel.FeedItem{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode notifications: %w", err)
+	}
+
+	unread, err := col.CountDocuments(ctx, bson.M{"userEmail": email, "readAt": 0})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return items, unread, nil
+}
+
+// UnreadCount is the number on a user's notification badge.
+func UnreadCount(email string) (int64, error) {
+	db, col, err := mongoSetup.ConnectMongo("inAppNotifications")
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	unread, err := col.CountDocuments(ctx, bson.M{"userEmail": strings.ToLower(strings.TrimSpace(email)), "readAt": 0})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return unread, nil
+}
+
+// MarkFeedRead marks notifications of a user as read, all of them when
+// notificationIds is empty, and returns how many were unread.
+func MarkFeedRead(email string, notificationIds []string) (int64, error) {
+	db, col, err := mongoSetup.ConnectMongo("inAppNotifications")
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"userEmail": strings.ToLower(strings.TrimSpace(email)), "readAt": 0}
+	if len(notificationIds) > 0 {
+		filter["notificationId"] = bson.M{"$in": notificationIds}
+	}
+	result, err := col.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"readAt": time.Now().Unix()}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// NotifyPaymentFailed tells the buyer of an order in their feed that a
+// payment attempt failed and the order can still be paid.
+func NotifyPaymentFailed(order paymentModel.OrderDetails, paymentId string, reason string) {
+	eventName := "your event"
+	if event, err := fetchEvent(order.EventId); err == nil {
+		eventName = event.EventName
+	}
+	body := fmt.Sprintf("Your payment for %s did not go through.", eventName)
+	if reason = strings.TrimSpace(reason); reason != "" {
+		body += " " + strings.TrimSuffix(reason, ".") + "."
+	}
+	body += " Your seats are held, you can try again until the order expires."
+
+	err := addToFeed(notificationModel.FeedItem{
+		UserEmail: order.UserEmail,
+		Type:      FeedPaymentFailed,
+		Title:     "Payment failed",
+		Body:      body,
+		EventId:   order.EventId,
+		SourceId:  fmt.Sprintf("%s:%s:%s", FeedPaymentFailed, order.OrderID, paymentId),
+	})
+	if err != nil {
+		log.Printf("Failed to add failed payment of order %s to feed: %v", order.OrderID, err)
+	}
+}
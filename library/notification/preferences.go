@@ -0,0 +1,138 @@
+package notifyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	messagingutils "em_backend/library/messaging"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrUnknownCategory = errors.New("unknown notification category")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrUnknownType     = errors.New("notification type cannot be sent as a text")
+	ErrPhoneRequired   = errors.New("verify a phone number to receive texts")
+)
+
+// Categories lists the notifications users can mute.
+var Categories = []string{CategoryReminders}
+
+// ValidatePreferences checks every muted category, notification type and
+// channel exists and removes duplicates.
+func ValidatePreferences(preferences *notificationModel.NotificationPreferences) error {
+	known := map[string]bool{}
+	for _, category := range Categories {
+		known[category] = true
+	}
+	seen := map[string]bool{}
+	muted := []string{}
+	for _, category := range preferences.Muted {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !known[category] {
+			return fmt.Errorf("%w '%s'", ErrUnknownCategory, category)
+		}
+		if !seen[category] {
+			seen[category] = true
+			muted = append(muted, category)
+		}
+	}
+	sort.Strings(muted)
+	preferences.Muted = muted
+
+	textTypes := map[string]bool{}
+	for _, notificationType := range TextNotificationTypes {
+		textTypes[notificationType] = true
+	}
+	channels := map[string][]string{}
+	for notificationType, selected := range preferences.Channels {
+		if !textTypes[notificationType] {
+			return fmt.Errorf("%w '%s'", ErrUnknownType, notificationType)
+		}
+		seen := map[string]bool{}
+		for _, channel := range selected {
+			channel = strings.ToLower(strings.TrimSpace(channel))
+			if !messagingutils.IsChannel(channel) {
+				return fmt.Errorf("%w '%s'", messagingutils.ErrUnknownChannel, channel)
+			}
+			if !seen[channel] {
+				seen[channel] = true
+				channels[notificationType] = append(channels[notificationType], channel)
+			}
+		}
+		sort.Strings(channels[notificationType])
+	}
+	preferences.Channels = channels
+	return nil
+}
+
+// FetchPreferences loads the notification preferences of a user.
+func FetchPreferences(email string) (notificationModel.NotificationPreferences, error) {
+	var user dbModel.UserData
+	result, err := mongoSetup.FindOneDoc("userData", bson.M{"email": email}, bson.M{"notificationPreferences": 1})
+	if err != nil {
+		return user.NotificationPreferences, err
+	}
+	if err := result.Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return user.NotificationPreferences, ErrUserNotFound
+		}
+		return user.NotificationPreferences, err
+	}
+	if user.NotificationPreferences.Muted == nil {
+		user.NotificationPreferences.Muted = []string{}
+	}
+	return user.NotificationPreferences, nil
+}
+
+// SavePreferences replaces the notification preferences of a user.
+func SavePreferences(email string, preferences notificationModel.NotificationPreferences) (notificationModel.NotificationPreferences, error) {
+	if err := ValidatePreferences(&preferences); err != nil {
+		return preferences, err
+	}
+
+	db, col, err := mongoSetup.ConnectMongo("userData")
+	if err != nil {
+		return preferences, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Texts need a number that is known to belong to the user
+	if len(preferences.Channels) > 0 {
+		var user dbModel.UserData
+		err := col.FindOne(ctx, bson.M{"email": email}, options.FindOne().SetProjection(bson.M{"phoneVerified": 1})).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			return preferences, ErrUserNotFound
+		}
+		if err != nil {
+			return preferences, fmt.Errorf("failed to fetch user: %w", err)
+		}
+		if !user.PhoneVerified {
+			return preferences, ErrPhoneRequired
+		}
+	}
+
+	result, err := col.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{
+		"notificationPreferences": preferences,
+		"updatedAt":               time.Now().Unix(),
+	}})
+	if err != nil {
+		return preferences, fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return preferences, ErrUserNotFound
+	}
+	return preferences, nil
+}
@@ -0,0 +1,393 @@
+package notifyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	notificationModel "em_backend/models/notification"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JobRegistrationConfirmation = "registration_confirmation"
+	JobTicket                   = "ticket"
+	JobPaymentReceipt           = "payment_receipt"
+
+	JobStatusPending    = "pending"
+	JobStatusProcessing = "processing"
+	JobStatusSent       = "sent"
+	JobStatusDead       = "dead"
+
+	defaultMaxAttempts      = 8
+	defaultPollSeconds      = 5
+	jobBatchSize            = 50
+	baseRetryDelay          = 30 * time.Second
+	maxRetryDelay           = 6 * time.Hour
+	jobLockDuration         = 5 * time.Minute
+	maxRecordedFailures     = 10
+	notificationsCollection = "notificationJobs"
+)
+
+var ErrUnknownJobType = errors.New("unknown notification job type")
+
+// PermanentError marks a failure retrying cannot fix, such as a registration
+// that no longer exists. Jobs failing with it are dead-lettered at once.
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func permanent(err error) error {
+	return PermanentError{Err: err}
+}
+
+// jobHandlers deliver each type of job. They are set up in init because
+// handlers queue follow-up jobs, e.g. text messages after an email.
+var jobHandlers map[string]func(notificationModel.NotificationJob) error
+
+func init() {
+	jobHandlers = map[string]func(notificationModel.NotificationJob) error{
+		JobRegistrationConfirmation: func(job notificationModel.NotificationJob) error {
+			return SendRegistrationConfirmations([]string{job.Payload.RegistrationId})
+		},
+		JobTicket: func(job notificationModel.NotificationJob) error {
+			return SendTicket(job.Payload.RegistrationId)
+		},
+		JobPaymentReceipt: func(job notificationModel.NotificationJob) error {
+			order, err := fetchOrder(job.Payload.OrderId)
+			if err != nil {
+				return err
+			}
+			return SendPaymentReceipt(order)
+		},
+		JobEventReminder:     sendEventReminder,
+		JobEventUpdate:       sendEventUpdate,
+		JobEventCancellation: sendEventCancellation,
+		JobAnnouncement:      sendAnnouncement,
+		JobTextMessage:       sendTextMessage,
+	}
+}
+
+// RegisterJobHandler adds the handler of a job type that another package
+// queues, e.g. webhook deliveries. Call it from the package's init.
+func RegisterJobHandler(jobType string, handler func(notificationModel.NotificationJob) error) {
+	jobHandlers[jobType] = handler
+}
+
+// wake lets Enqueue start the worker right away instead of at its next poll
+var wake = make(chan struct{}, 1)
+
+// Enqueue adds a job to the outbox. A job with the same dedupe key as one
+// already queued is dropped, so callers can enqueue without checking first.
+func Enqueue(jobType string, payload notificationModel.NotificationPayload, dedupeKey string) error {
+	if _, found := jobHandlers[jobType]; !found {
+		return ErrUnknownJobType
+	}
+
+	db, col, err := mongoSetup.ConnectMongo(notificationsCollection)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	job := notificationModel.NotificationJob{
+		JobId:         uuid.New().String(),
+		Type:          jobType,
+		Payload:       payload,
+		DedupeKey:     dedupeKey,
+		Status:        JobStatusPending,
+		MaxAttempts:   maxAttempts(),
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := col.InsertOne(ctx, job); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to queue notification: %w", err)
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// EnqueueLogged enqueues a job, logging instead of failing the caller, for
+// handlers whose response must not depend on the notification.
+func EnqueueLogged(jobType string, payload notificationModel.NotificationPayload, dedupeKey string) {
+	if err := Enqueue(jobType, payload, dedupeKey); err != nil {
+		log.Printf("Failed to queue %s notification %s: %v", jobType, dedupeKey, err)
+	}
+}
+
+func maxAttempts() int {
+	attempts, err := strconv.Atoi(commonutils.LoadEnv("NOTIFICATION_MAX_ATTEMPTS"))
+	if err != nil || attempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return attempts
+}
+
+// retryDelay doubles with every attempt up to maxRetryDelay, with up to 20%
+// jitter so jobs that failed together do not retry together.
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// StartNotificationWorker delivers due jobs every NOTIFICATION_POLL_SECONDS
+// and whenever a job is queued. It blocks, so start it in its own goroutine.
+func StartNotificationWorker() {
+	seconds, err := strconv.Atoi(commonutils.LoadEnv("NOTIFICATION_POLL_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = defaultPollSeconds
+	}
+
+	ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := ProcessDueJobs(); err != nil {
+			log.Printf("Notification worker failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// ProcessDueJobs claims and delivers the jobs that are due, one at a time so
+// several workers can share the queue. Jobs locked by a worker that died are
+// picked up again once their lock expires.
+func ProcessDueJobs() error {
+	db, col, err := mongoSetup.ConnectMongo(notificationsCollection)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	for i := 0; i < jobBatchSize; i++ {
+		job, err := claimJob(col)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := finishJob(col, job, runJob(job)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func claimJob(col *mongo.Collection) (notificationModel.NotificationJob, error) {
+	var job notificationModel.NotificationJob
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": JobStatusPending, "nextAttemptAt": bson.M{"$lte": now.Unix()}},
+		bson.M{"status": JobStatusProcessing, "lockedUntil": bson.M{"$lt": now.Unix()}},
+	}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      JobStatusProcessing,
+			"lockedUntil": now.Add(jobLockDuration).Unix(),
+			"updatedAt":   now.Unix(),
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"nextAttemptAt": 1}).
+		SetReturnDocument(options.After)
+	err := col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+// runJob delivers a job, turning a panic in a handler into a failure so one
+// bad job cannot stop the worker.
+func runJob(job notificationModel.NotificationJob) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("notification handler panicked: %v", recovered)
+		}
+	}()
+	handler, found := jobHandlers[job.Type]
+	if !found {
+		return permanent(ErrUnknownJobType)
+	}
+	return handler(job)
+}
+
+// finishJob records the outcome of an attempt: sent, retried later or dead.
+func finishJob(col *mongo.Collection, job notificationModel.NotificationJob, jobErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var update bson.M
+	if jobErr == nil {
+		update = bson.M{"$set": bson.M{
+			"status":      JobStatusSent,
+			"sentAt":      now.Unix(),
+			"lockedUntil": 0,
+			"updatedAt":   now.Unix(),
+		}}
+	} else {
+		failure := notificationModel.JobFailure{Attempt: job.Attempts, Error: jobErr.Error(), At: now.Unix()}
+		set := bson.M{
+			"lastError":   jobErr.Error(),
+			"lockedUntil": 0,
+			"updatedAt":   now.Unix(),
+		}
+		var permanentErr PermanentError
+		if errors.As(jobErr, &permanentErr) || job.Attempts >= job.MaxAttempts {
+			set["status"] = JobStatusDead
+			set["deadAt"] = now.Unix()
+			log.Printf("Notification job %s (%s) dead-lettered after %d attempts: %v", job.JobId, job.Type, job.Attempts, jobErr)
+		} else {
+			set["status"] = JobStatusPending
+			set["nextAttemptAt"] = now.Add(retryDelay(job.Attempts)).Unix()
+		}
+		update = bson.M{
+			"$set":  set,
+			"$push": bson.M{"failures": bson.M{"$each": bson.A{failure}, "$slice": -maxRecordedFailures}},
+		}
+	}
+
+	// Only the worker holding the lock may finish the job
+	_, err := col.UpdateOne(ctx, bson.M{"jobId": job.JobId, "status": JobStatusProcessing, "attempts": job.Attempts}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update notification job: %w", err)
+	}
+	return nil
+}
+
+// ReplayJobs moves dead jobs back into the queue with a fresh set of
+// attempts. It returns how many were replayed.
+func ReplayJobs(request notificationModel.ReplayJobsRequest, replayedBy string) (int64, error) {
+	db, col, err := mongoSetup.ConnectMongo(notificationsCollection)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": JobStatusDead}
+	if len(request.JobIds) > 0 {
+		filter["jobId"] = bson.M{"$in": request.JobIds}
+	}
+	if request.Type != "" {
+		filter["type"] = request.Type
+	}
+	now := time.Now().Unix()
+	result, err := col.UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		"status":        JobStatusPending,
+		"attempts":      0,
+		"maxAttempts":   maxAttempts(),
+		"nextAttemptAt": now,
+		"replayedBy":    replayedBy,
+		"replayedAt":    now,
+		"updatedAt":     now,
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay notification jobs: %w", err)
+	}
+	if result.ModifiedCount > 0 {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return result.ModifiedCount, nil
+}
+
+// ListJobs returns the most recent jobs matching the request.
+func ListJobs(request notificationModel.NotificationJobListRequest) ([]notificationModel.NotificationJob, error) {
+	db, col, err := mongoSetup.ConnectMongo(notificationsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if request.JobId != "" {
+		filter["jobId"] = request.JobId
+	}
+	if request.Status != "" {
+		filter["status"] = request.Status
+	}
+	if request.Type != "" {
+		filter["type"] = request.Type
+	}
+	cursor, err := col.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(100))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch notification jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []notificationModel.NotificationJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode notification jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// QueueRegistrationConfirmations queues the confirmation email of each
+// registration, once per registration.
+func QueueRegistrationConfirmations(registrationIds []string) {
+	for _, registrationId := range registrationIds {
+		EnqueueLogged(JobRegistrationConfirmation,
+			notificationModel.NotificationPayload{RegistrationId: registrationId},
+			JobRegistrationConfirmation+":"+registrationId)
+	}
+}
+
+// QueuePaymentReceipt queues the receipt of a paid order, once per order.
+func QueuePaymentReceipt(orderId string) {
+	EnqueueLogged(JobPaymentReceipt, notificationModel.NotificationPayload{OrderId: orderId}, JobPaymentReceipt+":"+orderId)
+}
+
+// QueueTicket queues a group ticket for the attendee it was assigned to;
+// reassigning it to someone else sends it again.
+func QueueTicket(registrationId string, attendeeEmail string) {
+	EnqueueLogged(JobTicket, notificationModel.NotificationPayload{RegistrationId: registrationId},
+		JobTicket+":"+registrationId+":"+attendeeEmail)
+}
@@ -0,0 +1,39 @@
+package notifyutils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{0, baseRetryDelay},
+		{1, baseRetryDelay},
+		{2, 2 * baseRetryDelay},
+		{3, 4 * baseRetryDelay},
+		{6, 32 * baseRetryDelay},
+		{20, maxRetryDelay},
+		{1000, maxRetryDelay},
+	}
+	for _, test := range tests {
+		// Jitter adds up to a fifth of the delay
+		for i := 0; i < 100; i++ {
+			delay := retryDelay(test.attempts)
+			if delay < test.base || delay > test.base+test.base/5 {
+				t.Fatalf("retryDelay(%d) = %v, want between %v and %v", test.attempts, delay, test.base, test.base+test.base/5)
+			}
+		}
+	}
+
+	// Jobs that failed together should not all retry at the same moment
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 50; i++ {
+		seen[retryDelay(4)] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("retryDelay(4) has no jitter")
+	}
+}
@@ -0,0 +1,124 @@
+package notifyutils
+
+import (
+	mongoSetup "em_backend/configs/mongo"
+	eventutils "em_backend/library/events"
+	mailutils "em_backend/library/mail"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Event times are shown in Indian time
+var eventLocation = time.FixedZone("IST", 5*60*60+30*60)
+
+// recipient is who an email goes to and how to address them.
+type recipient struct {
+	Email       string
+	Name        string
+	Locale      string
+	Preferences notificationModel.NotificationPreferences
+	// Phone is the verified number texts go to, if any
+	Phone string
+}
+
+// registrationRecipient is who is told about a registration: the attendee a
+// group ticket was assigned to, otherwise the buyer.
+func registrationRecipient(registration dbModel.RegistrationData) recipient {
+	email := registration.AttendeeEmail
+	if email == "" {
+		email = registration.PrimaryEmailId
+	}
+	return lookupRecipient(email, registration.AttendeeName)
+}
+
+// lookupRecipient finds the name and locale of a user. Attendees of group
+// tickets may not have an account, they get name and the default locale.
+func lookupRecipient(email string, name string) recipient {
+	to := recipient{Email: strings.TrimSpace(email), Name: strings.TrimSpace(name)}
+	result, err := mongoSetup.FindOneDoc("userData", bson.M{"email": to.Email}, bson.M{
+		"userName": 1, "locale": 1, "notificationPreferences": 1, "phone": 1, "phoneVerified": 1,
+	})
+	if err != nil {
+		return to
+	}
+	var user dbModel.UserData
+	if err := result.Decode(&user); err != nil {
+		return to
+	}
+	if to.Name == "" {
+		to.Name = user.UserName
+	}
+	to.Locale = user.Locale
+	to.Preferences = user.NotificationPreferences
+	if user.PhoneVerified {
+		to.Phone = user.Phone
+	}
+	return to
+}
+
+// mutes reports whether the recipient turned off a category of notifications.
+func (r recipient) mutes(category string) bool {
+	for _, muted := range r.Preferences.Muted {
+		if muted == category {
+			return true
+		}
+	}
+	return false
+}
+
+// greetingName is the name an email opens with.
+func (r recipient) greetingName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return "there"
+}
+
+// FormatEventDate formats an event's start time for emails.
+func FormatEventDate(unix int64) string {
+	return time.Unix(unix, 0).In(eventLocation).Format("Mon, 02 Jan 2006 15:04 MST")
+}
+
+// eventVenue is where an event takes place, its mode for online events.
+func eventVenue(event dbModel.Event) string {
+	if event.EventLocation != "" {
+		return event.EventLocation
+	}
+	return event.EventMode
+}
+
+func calendarFileName(event dbModel.Event) string {
+	return fmt.Sprintf("%s.ics", fileSlug(event.EventName, "event"))
+}
+
+// calendarAttachment attaches an event as a calendar invite.
+func calendarAttachment(event dbModel.Event) mailutils.Attachment {
+	return mailutils.Attachment{
+		FileName:    calendarFileName(event),
+		ContentType: "text/calendar; method=" + eventutils.CalendarMethodPublish + "; charset=utf-8",
+		Data:        eventutils.EventCalendar(event, eventutils.CalendarMethodPublish),
+	}
+}
+
+// fileSlug makes text usable as a file name.
+func fileSlug(text string, fallback string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteRune('-')
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		return fallback
+	}
+	return slug
+}
@@ -0,0 +1,232 @@
+package notifyutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	mailutils "em_backend/library/mail"
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	JobEventReminder = "event_reminder"
+
+	CategoryReminders = "reminders"
+
+	defaultReminderScanSeconds = 60
+)
+
+// StartReminderScheduler queues due event reminders every
+// REMINDER_SCAN_SECONDS. What was sent is kept in MongoDB, so a restart
+// neither loses nor repeats reminders. It blocks, so start it in its own
+// goroutine.
+func StartReminderScheduler() {
+	seconds, err := strconv.Atoi(commonutils.LoadEnv("REMINDER_SCAN_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = defaultReminderScanSeconds
+	}
+
+	ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := DispatchDueReminders(); err != nil {
+			log.Printf("Reminder dispatch failed: %v", err)
+		}
+	}
+}
+
+// DispatchDueReminders queues the due reminder of every upcoming event. When
+// several reminders of an event are due, e.g. after downtime, only the latest
+// is sent. Each reminder goes to the registrations confirmed before it was
+// due; later registrants get the confirmation instead.
+func DispatchDueReminders() error {
+	db, col, err := mongoSetup.ConnectMongo("events")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	cursor, err := col.Find(ctx, bson.M{
+		"status":            bson.M{"$nin": bson.A{eventutils.EventStatusCancelled, eventutils.EventStatusInactive}},
+		"remindersDisabled": bson.M{"$ne": true},
+		"eventDate": bson.M{
+			"$gt":  now,
+			"$lte": now + int64(eventutils.MaxReminderOffset)*60,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch upcoming events: %w", err)
+	}
+	var events []dbModel.Event
+	if err := cursor.All(ctx, &events); err != nil {
+		return fmt.Errorf("failed to decode events: %w", err)
+	}
+
+	dispatches := db.Collection("reminderDispatches")
+	registrations := db.Collection("registrations")
+	for _, event := range events {
+		offset, due := dueReminder(event, now)
+		if !due {
+			continue
+		}
+		if err := dispatchReminder(ctx, dispatches, registrations, event, offset); err != nil {
+			log.Printf("Failed to dispatch reminder of event %s: %v", event.UniqueId, err)
+		}
+	}
+	return nil
+}
+
+// dueReminder returns the latest reminder of an event that is due.
+func dueReminder(event dbModel.Event, now int64) (int, bool) {
+	offsets := append([]int{}, eventutils.ReminderOffsets(event)...)
+	sort.Ints(offsets)
+	for _, offset := range offsets {
+		if event.EventDate-int64(offset)*60 <= now {
+			return offset, true
+		}
+	}
+	return 0, false
+}
+
+func dispatchReminder(ctx context.Context, dispatches *mongo.Collection, registrations *mongo.Collection, event dbModel.Event, offset int) error {
+	key := bson.M{"eventId": event.UniqueId, "eventDate": event.EventDate, "offset": offset}
+	if err := dispatches.FindOne(ctx, key).Err(); err == nil {
+		return nil
+	} else if err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to check reminder dispatch: %w", err)
+	}
+
+	dueAt := event.EventDate - int64(offset)*60
+	cursor, err := registrations.Find(ctx, bson.M{
+		"uniqueId": event.UniqueId,
+		"status":   eventutils.RegistrationStatusConfirmed,
+		// Registrations from before confirmation times were kept have none
+		"$or": bson.A{
+			bson.M{"confirmedAt": bson.M{"$lte": dueAt}},
+			bson.M{"confirmedAt": bson.M{"$exists": false}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch registrations: %w", err)
+	}
+	var registrants []dbModel.RegistrationData
+	if err := cursor.All(ctx, &registrants); err != nil {
+		return fmt.Errorf("failed to decode registrations: %w", err)
+	}
+
+	// Queue first and record the dispatch last: if this stops halfway the
+	// next run queues again and the dedupe keys drop what was already queued
+	for _, registration := range registrants {
+		payload := notificationModel.NotificationPayload{
+			RegistrationId: registration.RegistrationId,
+			EventId:        event.UniqueId,
+			EventDate:      event.EventDate,
+			ReminderOffset: offset,
+		}
+		dedupeKey := fmt.Sprintf("%s:%s:%d:%d", JobEventReminder, registration.RegistrationId, event.EventDate, offset)
+		if err := Enqueue(JobEventReminder, payload, dedupeKey); err != nil {
+			return err
+		}
+	}
+
+	dispatch := notificationModel.ReminderDispatch{
+		EventId:      event.UniqueId,
+		EventDate:    event.EventDate,
+		Offset:       offset,
+		Registrants:  len(registrants),
+		DispatchedAt: time.Now().Unix(),
+	}
+	if _, err := dispatches.InsertOne(ctx, dispatch); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to record reminder dispatch: %w", err)
+	}
+	return nil
+}
+
+// sendEventReminder delivers one queued reminder, unless the event moved,
+// started, was cancelled or deactivated, or the attendee muted reminders
+// since.
+func sendEventReminder(job notificationModel.NotificationJob) error {
+	registrations, err := fetchRegistrations([]string{job.Payload.RegistrationId})
+	if err != nil {
+		return err
+	}
+	if len(registrations) == 0 || registrations[0].Status != eventutils.RegistrationStatusConfirmed {
+		return nil
+	}
+	registration := registrations[0]
+	if registration.GroupOrderId != "" && registration.AttendeeEmail == "" {
+		return nil
+	}
+
+	event, err := fetchEvent(registration.UniqueId)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if event.Status == eventutils.EventStatusCancelled || event.Status == eventutils.EventStatusInactive || event.RemindersDisabled ||
+		event.EventDate != job.Payload.EventDate || event.EventDate <= now {
+		return nil
+	}
+
+	to := registrationRecipient(registration)
+	if to.mutes(CategoryReminders) {
+		return nil
+	}
+
+	message, err := mailutils.RenderMessage(to.Email, mailutils.TemplateEventReminder, to.Locale, event.OrganizerId, map[string]interface{}{
+		"Name":        to.greetingName(),
+		"EventName":   event.EventName,
+		"EventDate":   FormatEventDate(event.EventDate),
+		"StartsIn":    startsIn(time.Duration(event.EventDate-now) * time.Second),
+		"Venue":       eventVenue(event),
+		"MeetingLink": event.MeetingLink,
+	})
+	if err != nil {
+		return permanent(err)
+	}
+	if err := deliver(message); err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Reminder: %s starts %s, %s.", event.EventName,
+		startsIn(time.Duration(event.EventDate-now)*time.Second), FormatEventDate(event.EventDate))
+	if venue := eventVenue(event); venue != "" {
+		text += " Venue: " + venue
+	}
+	queueTextMessages(JobEventReminder, jobSource(job), to, text)
+	return nil
+}
+
+// startsIn describes how far away an event is, e.g. "in 3 hours".
+func startsIn(d time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("in 1 %s", unit)
+		}
+		return fmt.Sprintf("in %d %ss", n, unit)
+	}
+	switch {
+	case d < 90*time.Second:
+		return "in a minute"
+	case d < time.Hour:
+		return plural(int64(d.Round(time.Minute)/time.Minute), "minute")
+	case d.Round(time.Hour) < 24*time.Hour:
+		return plural(int64(d.Round(time.Hour)/time.Hour), "hour")
+	default:
+		return plural(int64((d+12*time.Hour)/(24*time.Hour)), "day")
+	}
+}
@@ -0,0 +1,33 @@
+package notifyutils
+
+import (
+	dbModel "em_backend/models/db"
+	"testing"
+)
+
+func TestDueReminder(t *testing.T) {
+	const minute = 60
+	eventDate := int64(1_000_000)
+	event := dbModel.Event{EventDate: eventDate, ReminderOffsets: []int{7 * 24 * 60, 60, 24 * 60}}
+	tests := []struct {
+		name       string
+		event      dbModel.Event
+		now        int64
+		wantOffset int
+		wantDue    bool
+	}{
+		{"before the first reminder", event, eventDate - 8*24*60*minute, 0, false},
+		{"at the first reminder", event, eventDate - 7*24*60*minute, 7 * 24 * 60, true},
+		{"between the first reminders", event, eventDate - 2*24*60*minute, 7 * 24 * 60, true},
+		{"latest passed reminder wins", event, eventDate - 12*60*minute, 24 * 60, true},
+		{"last reminder", event, eventDate - 30*minute, 60, true},
+		{"after the event", event, eventDate + minute, 60, true},
+		{"reminders disabled", dbModel.Event{EventDate: eventDate, ReminderOffsets: []int{60}, RemindersDisabled: true}, eventDate, 0, false},
+	}
+	for _, test := range tests {
+		offset, due := dueReminder(test.event, test.now)
+		if offset != test.wantOffset || due != test.wantDue {
+			t.Errorf("%s: dueReminder = %d, %v, want %d, %v", test.name, offset, due, test.wantOffset, test.wantDue)
+		}
+	}
+}
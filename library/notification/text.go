@@ -0,0 +1,74 @@
+package notifyutils
+
+import (
+	messagingutils "em_backend/library/messaging"
+	notificationModel "em_backend/models/notification"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	JobTextMessage = "text_message"
+
+	// Longer texts are cut, SMS providers split and bill them per segment
+	maxTextLength = 320
+)
+
+// TextNotificationTypes lists the notifications users can also receive by
+// SMS or WhatsApp.
+var TextNotificationTypes = []string{
+	JobRegistrationConfirmation,
+	JobTicket,
+	JobEventReminder,
+	JobEventUpdate,
+	JobEventCancellation,
+	JobAnnouncement,
+}
+
+// queueTextMessages queues a text of a notification on every channel the
+// recipient chose for its type. source identifies the notification so each
+// text is queued once.
+func queueTextMessages(notificationType string, source string, to recipient, text string) {
+	if to.Phone == "" {
+		return
+	}
+	for _, channel := range to.Preferences.Channels[notificationType] {
+		EnqueueLogged(JobTextMessage, notificationModel.NotificationPayload{
+			Channel: channel,
+			Phone:   to.Phone,
+			Text:    truncateText(text),
+		}, fmt.Sprintf("%s:%s:%s", JobTextMessage, source, channel))
+	}
+}
+
+// jobSource identifies the notification a job delivers.
+func jobSource(job notificationModel.NotificationJob) string {
+	if job.DedupeKey != "" {
+		return job.DedupeKey
+	}
+	return job.JobId
+}
+
+func sendTextMessage(job notificationModel.NotificationJob) error {
+	err := messagingutils.Send(messagingutils.TextMessage{
+		Channel: job.Payload.Channel,
+		To:      job.Payload.Phone,
+		Body:    job.Payload.Text,
+	})
+	if errors.Is(err, messagingutils.ErrInvalidPhone) || errors.Is(err, messagingutils.ErrUnknownChannel) ||
+		errors.Is(err, messagingutils.ErrEmptyMessage) || errors.Is(err, messagingutils.ErrRejected) {
+		return permanent(err)
+	}
+	return err
+}
+
+func truncateText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxTextLength {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:maxTextLength-1])) + "…"
+}
@@ -0,0 +1,222 @@
+package paymentutils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	commonutils "em_backend/library/common"
+	paymentModel "em_backend/models/payment"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeProvider is an in-process payment provider for local development. It
+// keeps orders in memory and signs payments and webhooks with
+// FAKE_PAYMENT_SECRET, so the whole paid registration flow works offline. It
+// is only available when PAYMENT_PROVIDER=fake and the secret is set.
+type fakeProvider struct {
+	mu      sync.Mutex
+	orders  map[string]*fakeOrder
+	refunds map[string]paymentModel.ProviderRefund
+}
+
+type fakeOrder struct {
+	order     paymentModel.OrderResponse
+	paymentId string
+	refunded  int64
+	paidAt    int64
+}
+
+// FakeWebhook is the body of webhooks sent by the fake provider.
+type FakeWebhook struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	OrderID   string `json:"orderId"`
+	PaymentID string `json:"paymentId"`
+	RefundID  string `json:"refundId,omitempty"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+}
+
+var fakeProviderInstance = &fakeProvider{
+	orders:  map[string]*fakeOrder{},
+	refunds: map[string]paymentModel.ProviderRefund{},
+}
+
+func fakeSecret() string {
+	return commonutils.LoadEnv("FAKE_PAYMENT_SECRET")
+}
+
+func fakeSign(data []byte) string {
+	if fakeSecret() == "" {
+		return ""
+	}
+	h := hmac.New(sha256.New, []byte(fakeSecret()))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (p *fakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (p *fakeProvider) CreateOrder(req paymentModel.ProviderOrderRequest) (paymentModel.OrderResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order := paymentModel.OrderResponse{
+		ID:       "order_fake_" + uuid.New().String(),
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Receipt:  req.Receipt,
+		Status:   ProviderOrderCreated,
+		Provider: ProviderFake,
+	}
+	p.orders[order.ID] = &fakeOrder{order: order}
+	return order, nil
+}
+
+func (p *fakeProvider) VerifyPayment(verification paymentModel.PaymentVerification) (bool, error) {
+	expected := fakeSign([]byte(verification.OrderID + "|" + verification.PaymentID))
+	if expected == "" {
+		return false, nil
+	}
+	return hmac.Equal([]byte(expected), []byte(verification.Signature)), nil
+}
+
+func (p *fakeProvider) FetchOrderStatus(orderId string) (paymentModel.ProviderOrderStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Orders are forgotten on restart; nothing was paid for them in this process
+	stored, ok := p.orders[orderId]
+	if !ok {
+		return paymentModel.ProviderOrderStatus{OrderID: orderId, Status: ProviderOrderCreated}, nil
+	}
+	status := paymentModel.ProviderOrderStatus{
+		OrderID:   orderId,
+		Status:    stored.order.Status,
+		Amount:    stored.order.Amount,
+		Currency:  stored.order.Currency,
+		PaymentID: stored.paymentId,
+	}
+	if stored.order.Status == ProviderOrderPaid {
+		status.AmountPaid = stored.order.Amount
+	}
+	return status, nil
+}
+
+func (p *fakeProvider) Refund(paymentId string, amount int64, notes map[string]string) (paymentModel.ProviderRefund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, stored := range p.orders {
+		if stored.paymentId != paymentId {
+			continue
+		}
+		if stored.refunded+amount > stored.order.Amount {
+			return paymentModel.ProviderRefund{}, fmt.Errorf("refund exceeds the captured amount")
+		}
+		stored.refunded += amount
+		refund := paymentModel.ProviderRefund{
+			RefundID:  "rfnd_fake_" + uuid.New().String(),
+			PaymentID: paymentId,
+			Amount:    amount,
+			Currency:  stored.order.Currency,
+			Status:    "processed",
+		}
+		p.refunds[refund.RefundID] = refund
+		return refund, nil
+	}
+	return paymentModel.ProviderRefund{}, fmt.Errorf("fake payment %s not found", paymentId)
+}
+
+func (p *fakeProvider) ParseWebhook(body []byte, headers map[string]string) (paymentModel.ProviderWebhookEvent, error) {
+	event := paymentModel.ProviderWebhookEvent{}
+	if !VerifyWebhookSignature(body, headers["X-Fake-Signature"], fakeSecret()) {
+		return event, ErrInvalidWebhookSignature
+	}
+	var webhook FakeWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return event, fmt.Errorf("invalid webhook body: %w", err)
+	}
+	return paymentModel.ProviderWebhookEvent{
+		EventID:   webhook.ID,
+		Type:      webhook.Type,
+		OrderID:   webhook.OrderID,
+		PaymentID: webhook.PaymentID,
+		RefundID:  webhook.RefundID,
+		Amount:    webhook.Amount,
+		Currency:  webhook.Currency,
+	}, nil
+}
+
+func (p *fakeProvider) ListPayments(from int64, to int64) ([]paymentModel.ProviderPayment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payments := []paymentModel.ProviderPayment{}
+	for _, stored := range p.orders {
+		if stored.paidAt == 0 || stored.paidAt < from || stored.paidAt > to {
+			continue
+		}
+		payments = append(payments, paymentModel.ProviderPayment{
+			PaymentID:      stored.paymentId,
+			OrderID:        stored.order.ID,
+			Amount:         stored.order.Amount,
+			AmountRefunded: stored.refunded,
+			Currency:       stored.order.Currency,
+			Status:         capturedPaymentStatus(stored.order.Amount, stored.refunded),
+			CreatedAt:      stored.paidAt,
+		})
+	}
+	return payments, nil
+}
+
+// CompleteFakePayment simulates the customer paying (or failing to pay) a
+// fake order. It returns what the checkout would hand to the browser and the
+// signed webhook the provider would send.
+func CompleteFakePayment(orderId string, fail bool) (paymentModel.PaymentVerification, []byte, string, error) {
+	p := fakeProviderInstance
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored, ok := p.orders[orderId]
+	if !ok {
+		return paymentModel.PaymentVerification{}, nil, "", fmt.Errorf("fake order %s not found", orderId)
+	}
+	if stored.paymentId == "" {
+		stored.paymentId = "pay_fake_" + uuid.New().String()
+	}
+
+	webhook := FakeWebhook{
+		ID:        "evt_fake_" + uuid.New().String(),
+		Type:      WebhookPaymentCaptured,
+		OrderID:   orderId,
+		PaymentID: stored.paymentId,
+		Amount:    stored.order.Amount,
+		Currency:  stored.order.Currency,
+	}
+	if fail {
+		webhook.Type = WebhookPaymentFailed
+		stored.order.Status = ProviderOrderFailed
+	} else {
+		stored.order.Status = ProviderOrderPaid
+		stored.paidAt = time.Now().Unix()
+	}
+
+	body, err := json.Marshal(webhook)
+	if err != nil {
+		return paymentModel.PaymentVerification{}, nil, "", err
+	}
+	verification := paymentModel.PaymentVerification{
+		OrderID:   orderId,
+		PaymentID: stored.paymentId,
+		Signature: fakeSign([]byte(orderId + "|" + stored.paymentId)),
+	}
+	return verification, body, fakeSign(body), nil
+}
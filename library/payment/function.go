@@ -0,0 +1,454 @@
+package paymentutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	currencyutils "em_backend/library/currency"
+	eventutils "em_backend/library/events"
+	invoiceutils "em_backend/library/invoice"
+	ledgerutils "em_backend/library/ledger"
+	notifyutils "em_backend/library/notification"
+	promoutils "em_backend/library/promo"
+	webhookutils "em_backend/library/webhook"
+	dbModel "em_backend/models/db"
+	paymentModel "em_backend/models/payment"
+	promoModel "em_backend/models/promo"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OrderStatusCreated   = "created"
+	OrderStatusAttempted = "attempted"
+	OrderStatusPaid      = "paid"
+	OrderStatusFailed    = "failed"
+	OrderStatusExpired   = "expired"
+	OrderStatusRefunded  = "refunded"
+
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
+var (
+	ErrOrderNotFound        = errors.New("order not found")
+	ErrAlreadyPaid          = errors.New("registration is already paid")
+	ErrRegistrationExpired  = errors.New("registration expired before it was paid, please register again")
+	ErrRegistrationNotFound = errors.New("registration not found")
+	ErrGroupOrderNotFound   = errors.New("group order not found")
+	ErrNothingToPay         = errors.New("nothing to pay for this registration")
+	ErrAmountMismatch       = errors.New("order amount does not match the ticket price")
+	ErrCurrencyMismatch     = errors.New("order currency does not match the ticket currency")
+)
+
+// OrderQuote is the server computed price of an order together with the
+// registration or group order it pays for. Amounts are in minor units.
+type OrderQuote struct {
+	EventId      string
+	TicketTypeId string
+	RegID        string
+	GroupOrderId string
+	TicketCount  int
+	Subtotal     int64
+	Discount     int64
+	Amount       int64
+	Currency     string
+	Promo        promoModel.PromoCode
+	// HoldExpiresAt is when the seats being paid for are released, 0 when
+	// the registrations have no hold
+	HoldExpiresAt int64
+}
+
+// QuoteOrder computes what the session user has to pay for a registration or
+// group order from the event's current ticket pricing and the promo code. Any
+// amount or currency sent by the client must match the computed values.
+func QuoteOrder(orderReq paymentModel.OrderRequest, userEmail string) (OrderQuote, error) {
+	quote := OrderQuote{EventId: orderReq.EventId}
+	if orderReq.EventId == "" {
+		return quote, fmt.Errorf("event ID is required")
+	}
+	if (orderReq.RegID == "") == (orderReq.GroupOrderId == "") {
+		return quote, fmt.Errorf("exactly one of registration ID or group order ID is required")
+	}
+
+	event, err := eventutils.FetchEvent(orderReq.EventId)
+	if err != nil {
+		return quote, fmt.Errorf("event not found")
+	}
+	if event.Status == eventutils.EventStatusCancelled {
+		return quote, eventutils.ErrEventCancelled
+	}
+
+	// Resolve what is being paid for
+	var ticketTypeId, bundleId string
+	var bundleCount, quantity int
+	if orderReq.RegID != "" {
+		registration, err := FetchRegistration(orderReq.RegID)
+		if err != nil || registration.PrimaryEmailId != userEmail || registration.UniqueId != event.UniqueId || registration.GroupOrderId != "" {
+			return quote, ErrRegistrationNotFound
+		}
+		if registration.Status == eventutils.RegistrationStatusExpired {
+			return quote, ErrRegistrationExpired
+		}
+		if registration.Status != eventutils.RegistrationStatusPendingPayment {
+			return quote, ErrAlreadyPaid
+		}
+		quote.RegID = registration.RegistrationId
+		quote.HoldExpiresAt = registration.HoldExpiresAt
+		ticketTypeId = registration.TicketTypeId
+		quantity = 1
+	} else {
+		groupOrder, err := FetchGroupOrder(orderReq.GroupOrderId)
+		if err != nil || groupOrder.BuyerEmail != userEmail || groupOrder.EventId != event.UniqueId {
+			return quote, ErrGroupOrderNotFound
+		}
+		pending, err := countRegistrations(bson.M{"groupOrderId": groupOrder.GroupOrderId, "status": eventutils.RegistrationStatusPendingPayment})
+		if err != nil {
+			return quote, err
+		}
+		if pending == 0 {
+			expired, err := countRegistrations(bson.M{"groupOrderId": groupOrder.GroupOrderId, "status": eventutils.RegistrationStatusExpired})
+			if err == nil && expired > 0 {
+				return quote, ErrRegistrationExpired
+			}
+			return quote, ErrAlreadyPaid
+		}
+		quote.GroupOrderId = groupOrder.GroupOrderId
+		quote.HoldExpiresAt, err = groupHoldExpiresAt(groupOrder.GroupOrderId)
+		if err != nil {
+			return quote, err
+		}
+		ticketTypeId = groupOrder.TicketTypeId
+		bundleId = groupOrder.BundleId
+		bundleCount = groupOrder.BundleCount
+		quantity = groupOrder.TicketCount
+	}
+	if ticketTypeId == "" {
+		return quote, ErrNothingToPay
+	}
+	// New orders do not extend the hold, so seats cannot be kept by creating
+	// one order after another
+	if quote.HoldExpiresAt > 0 && quote.HoldExpiresAt <= time.Now().Unix() {
+		return quote, ErrRegistrationExpired
+	}
+
+	ticketType, err := eventutils.SelectTicketType(event, ticketTypeId)
+	if err != nil {
+		return quote, err
+	}
+	ticketQuote, err := eventutils.QuoteTickets(*ticketType, bundleId, bundleCount, quantity)
+	if err != nil {
+		return quote, err
+	}
+	quote.TicketTypeId = ticketType.TicketTypeId
+	quote.TicketCount = ticketQuote.TicketCount
+	quote.Currency = ticketQuote.Currency
+	quote.Subtotal = ticketQuote.Amount
+
+	// Apply the promo code, if any
+	if orderReq.PromoCode != "" {
+		quote.Promo, err = promoutils.ValidatePromoCode(orderReq.PromoCode, event.UniqueId, ticketType.TicketTypeId, userEmail)
+		if err != nil {
+			return quote, err
+		}
+		quote.Discount, err = promoutils.ComputeDiscount(quote.Promo, quote.Subtotal, quote.Currency)
+		if err != nil {
+			return quote, err
+		}
+	}
+	if quote.Subtotal <= 0 {
+		return quote, ErrNothingToPay
+	}
+	// A promo covering the whole price is confirmed with ConfirmFreeOrder
+	quote.Amount = quote.Subtotal - quote.Discount
+	if quote.Amount < 0 {
+		quote.Amount = 0
+	}
+
+	// Reject requests whose client side amount or currency was tampered with
+	if orderReq.Amount != 0 && orderReq.Amount != quote.Amount {
+		return quote, ErrAmountMismatch
+	}
+	if orderReq.Currency != "" {
+		currency, err := currencyutils.Normalise(orderReq.Currency)
+		if err != nil {
+			return quote, err
+		}
+		if currency != quote.Currency {
+			return quote, ErrCurrencyMismatch
+		}
+	}
+	return quote, nil
+}
+
+// ConfirmFreeOrder confirms the registrations of a quote whose promo code
+// covers the whole price, as there is no payment to wait for. The promo
+// redemption is recorded under a "free_" reference in place of an order id.
+func ConfirmFreeOrder(quote OrderQuote, userEmail string) ([]string, error) {
+	if quote.Amount != 0 {
+		return nil, fmt.Errorf("order of %d still has to be paid", quote.Amount)
+	}
+	reference := "free_" + uuid.New().String()
+	if quote.Promo.Code != "" {
+		err := promoutils.RedeemPromoCode(quote.Promo, promoModel.PromoRedemption{
+			EventId:        quote.EventId,
+			TicketTypeId:   quote.TicketTypeId,
+			UserEmail:      userEmail,
+			OrderId:        reference,
+			Subtotal:       quote.Subtotal,
+			DiscountAmount: quote.Discount,
+			Currency:       quote.Currency,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filter := bson.M{"registrationid": quote.RegID}
+	if quote.GroupOrderId != "" {
+		filter = bson.M{"groupOrderId": quote.GroupOrderId}
+	}
+	confirmed, err := eventutils.ConfirmRegistrations(filter)
+	if err == nil && len(confirmed) == 0 {
+		err = ErrRegistrationExpired
+	}
+	if err != nil && len(confirmed) == 0 {
+		if releaseErr := promoutils.ReleasePromoRedemption(reference); releaseErr != nil {
+			log.Printf("Failed to release promo redemption %s: %v", reference, releaseErr)
+		}
+		return nil, err
+	}
+
+	notifyutils.QueueRegistrationConfirmations(confirmed)
+	return confirmed, err
+}
+
+// FetchRegistration loads a registration by its registration id.
+func FetchRegistration(registrationId string) (dbModel.RegistrationData, error) {
+	var registration dbModel.RegistrationData
+	result, err := mongoSetup.FindOneDoc("registrations", bson.M{"registrationid": registrationId}, bson.M{})
+	if err != nil {
+		return registration, err
+	}
+	err = result.Decode(&registration)
+	return registration, err
+}
+
+// FetchGroupOrder loads a group order by its id.
+func FetchGroupOrder(groupOrderId string) (dbModel.GroupOrder, error) {
+	var groupOrder dbModel.GroupOrder
+	result, err := mongoSetup.FindOneDoc("groupOrders", bson.M{"groupOrderId": groupOrderId}, bson.M{})
+	if err != nil {
+		return groupOrder, err
+	}
+	err = result.Decode(&groupOrder)
+	return groupOrder, err
+}
+
+// FetchOrder loads a payment order by its provider order id.
+func FetchOrder(orderId string) (paymentModel.OrderDetails, error) {
+	var order paymentModel.OrderDetails
+	result, err := mongoSetup.FindOneDoc("orderDetails", bson.M{"orderId": orderId}, bson.M{})
+	if err != nil {
+		return order, err
+	}
+	err = result.Decode(&order)
+	return order, err
+}
+
+// LinkOrder ties a payment order to the registrations it pays for. Their
+// seats stay held until the hold they were registered with runs out.
+func LinkOrder(quote OrderQuote, orderId string) error {
+	db, registrationsCol, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	filter := bson.M{"registrationid": quote.RegID}
+	if quote.GroupOrderId != "" {
+		_, err := db.Collection("groupOrders").UpdateOne(ctx,
+			bson.M{"groupOrderId": quote.GroupOrderId},
+			bson.M{"$set": bson.M{"orderId": orderId, "updatedAt": now}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to link group order: %w", err)
+		}
+		filter = bson.M{"groupOrderId": quote.GroupOrderId}
+	}
+	filter["status"] = eventutils.RegistrationStatusPendingPayment
+	_, err = registrationsCol.UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		"orderId":   orderId,
+		"updatedAt": now,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to link registration: %w", err)
+	}
+	return nil
+}
+
+// ConfirmOrderPayment records a captured payment of an order, marks the order
+// as paid and confirms the registrations it pays for, issuing their QR codes.
+// A payment that arrives when there is nothing left to confirm, e.g. after
+// the order expired and its seats were released, is refunded. It is safe to
+// call more than once for the same payment.
+func ConfirmOrderPayment(orderId string, paymentId string) (paymentModel.OrderDetails, []string, error) {
+	order, err := FetchOrder(orderId)
+	if err != nil {
+		return order, nil, ErrOrderNotFound
+	}
+
+	// Refunded orders are final
+	if order.Status == OrderStatusRefunded {
+		return order, []string{}, nil
+	}
+
+	db, registrationsCol, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return order, nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Store the payment, once per payment id
+	justPaid := false
+	if order.Status != OrderStatusPaid {
+		now := time.Now().Unix()
+		_, err = db.Collection("paymentDetails").UpdateOne(ctx,
+			bson.M{"orderId": orderId, "paymentId": paymentId},
+			bson.M{
+				"$set": bson.M{
+					"status":    PaymentStatusCaptured,
+					"amount":    order.Amount,
+					"currency":  order.Currency,
+					"updatedAt": now,
+				},
+				"$setOnInsert": bson.M{"createdAt": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return order, nil, fmt.Errorf("failed to save payment details: %w", err)
+		}
+
+		_, err = TransitionOrder(orderId, OrderStatusPaid, "", bson.M{
+			"paymentId": paymentId,
+			"paidAt":    now,
+		})
+		if err != nil && err != ErrInvalidOrderTransition {
+			return order, nil, err
+		}
+		// Another request may have confirmed the order concurrently
+		justPaid = err == nil
+		if order, err = FetchOrder(orderId); err != nil {
+			return order, nil, ErrOrderNotFound
+		}
+		if order.Status != OrderStatusPaid {
+			return order, []string{}, nil
+		}
+	}
+
+	// Confirm what the order was created for, even if a newer order was created since
+	filter := OrderRegistrationsFilter(order)
+	_, err = registrationsCol.UpdateMany(ctx,
+		bson.M{"$and": bson.A{filter, bson.M{"status": eventutils.RegistrationStatusPendingPayment}}},
+		bson.M{"$set": bson.M{"orderId": orderId}},
+	)
+	if err != nil {
+		return order, nil, fmt.Errorf("failed to link registrations: %w", err)
+	}
+	confirmed, err := eventutils.ConfirmRegistrations(filter)
+	if err != nil {
+		return order, confirmed, err
+	}
+
+	// Book the payment, including one that is refunded below
+	if justPaid {
+		if err := ledgerutils.RecordSale(order); err != nil {
+			log.Printf("Failed to record sale of order %s in the ledger: %v", orderId, err)
+		}
+		webhookutils.PublishPaymentCaptured(order)
+	}
+
+	// Invoice the payment; a failure here must not undo the confirmation
+	if justPaid && len(confirmed) > 0 {
+		if _, err := invoiceutils.GenerateInvoice(order); err != nil {
+			log.Printf("Failed to invoice order %s: %v", orderId, err)
+		}
+	}
+
+	// Email the tickets and the receipt without holding up the payment
+	notifyutils.QueueRegistrationConfirmations(confirmed)
+	if justPaid && len(confirmed) > 0 {
+		notifyutils.QueuePaymentReceipt(orderId)
+	}
+
+	// Refund payments that no registration holds a seat for
+	if justPaid && len(confirmed) == 0 {
+		held, err := registrationsCol.CountDocuments(ctx, bson.M{"orderId": orderId, "status": eventutils.RegistrationStatusConfirmed})
+		if err != nil {
+			return order, confirmed, fmt.Errorf("failed to count registrations: %w", err)
+		}
+		if held == 0 {
+			log.Printf("Order %s was paid with nothing left to confirm, refunding", orderId)
+			if _, err := IssueRefund(order, order.Amount, nil, "Payment received after the order was closed", "system"); err != nil {
+				log.Printf("Failed to refund order %s: %v", orderId, err)
+			}
+		}
+	}
+	return order, confirmed, nil
+}
+
+// OrderRegistrationsFilter matches the registrations an order pays for.
+func OrderRegistrationsFilter(order paymentModel.OrderDetails) bson.M {
+	if order.GroupOrderId != "" {
+		return bson.M{"groupOrderId": order.GroupOrderId}
+	}
+	if order.RegID != "" {
+		return bson.M{"registrationid": order.RegID}
+	}
+	return bson.M{"orderId": order.OrderID}
+}
+
+// groupHoldExpiresAt returns when the seats of a group order's unpaid
+// registrations are released; they are all held together.
+func groupHoldExpiresAt(groupOrderId string) (int64, error) {
+	result, err := mongoSetup.FindOneDoc("registrations", bson.M{
+		"groupOrderId": groupOrderId,
+		"status":       eventutils.RegistrationStatusPendingPayment,
+	}, bson.M{"holdExpiresAt": 1})
+	if err != nil {
+		return 0, err
+	}
+	var registration dbModel.RegistrationData
+	if err := result.Decode(&registration); err != nil {
+		return 0, fmt.Errorf("failed to fetch registration: %w", err)
+	}
+	return registration.HoldExpiresAt, nil
+}
+
+func countRegistrations(filter bson.M) (int64, error) {
+	db, col, err := mongoSetup.ConnectMongo("registrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return col.CountDocuments(ctx, filter)
+}
@@ -0,0 +1,204 @@
+package paymentutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	promoutils "em_backend/library/promo"
+	paymentModel "em_backend/models/payment"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Expired orders are swept this often by default
+	defaultSweepIntervalSeconds = 60
+
+	// Orders whose status the provider cannot report are expired this long
+	// after their window closes. A payment captured after that is refunded
+	// when its webhook arrives.
+	statusCheckGracePeriod = time.Hour
+)
+
+// orderTransitions lists the states an order may move to from each state.
+// A failed payment can be retried on the same order, and a payment captured
+// after the order expired is still recorded so that it can be refunded.
+var orderTransitions = map[string][]string{
+	OrderStatusCreated:   {OrderStatusAttempted, OrderStatusPaid, OrderStatusFailed, OrderStatusExpired},
+	OrderStatusAttempted: {OrderStatusPaid, OrderStatusFailed, OrderStatusExpired},
+	OrderStatusFailed:    {OrderStatusAttempted, OrderStatusPaid, OrderStatusExpired},
+	OrderStatusExpired:   {OrderStatusPaid},
+	OrderStatusPaid:      {OrderStatusRefunded},
+}
+
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+// allowedFrom returns the states from which status can be reached.
+func allowedFrom(transitions map[string][]string, status string) bson.A {
+	from := bson.A{}
+	for state, next := range transitions {
+		for _, allowed := range next {
+			if allowed == status {
+				from = append(from, state)
+			}
+		}
+	}
+	return from
+}
+
+// TransitionOrder moves an order to status when that is allowed from its
+// current status, setting the extra fields in set and recording the change in
+// its history. It returns the order as it was before the transition.
+func TransitionOrder(orderId string, status string, note string, set bson.M) (paymentModel.OrderDetails, error) {
+	var previous paymentModel.OrderDetails
+
+	db, col, err := mongoSetup.ConnectMongo("orderDetails")
+	if err != nil {
+		return previous, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	update := bson.M{"status": status, "updatedAt": now}
+	for key, value := range set {
+		update[key] = value
+	}
+	err = col.FindOneAndUpdate(ctx,
+		bson.M{"orderId": orderId, "status": bson.M{"$in": allowedFrom(orderTransitions, status)}},
+		bson.M{
+			"$set":  update,
+			"$push": bson.M{"statusHistory": paymentModel.StatusChange{Status: status, Note: note, At: now}},
+		},
+	).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		count, countErr := col.CountDocuments(ctx, bson.M{"orderId": orderId})
+		if countErr == nil && count == 0 {
+			return previous, ErrOrderNotFound
+		}
+		return previous, ErrInvalidOrderTransition
+	}
+	if err != nil {
+		return previous, fmt.Errorf("failed to update order: %w", err)
+	}
+	return previous, nil
+}
+
+// MarkOrderAttempted records that the customer started paying an order.
+func MarkOrderAttempted(orderId string) error {
+	_, err := TransitionOrder(orderId, OrderStatusAttempted, "", nil)
+	if err == ErrInvalidOrderTransition {
+		return nil
+	}
+	return err
+}
+
+// ExpireOrder expires an unpaid order, releases its promo redemption and
+// releases the seats of the registrations still waiting on it.
+func ExpireOrder(order paymentModel.OrderDetails) error {
+	if _, err := TransitionOrder(order.OrderID, OrderStatusExpired, "payment window elapsed", nil); err != nil {
+		return err
+	}
+	if order.PromoCode != "" {
+		if err := promoutils.ReleasePromoRedemption(order.OrderID); err != nil {
+			log.Printf("Failed to release promo redemption of order %s: %v", order.OrderID, err)
+		}
+	}
+	_, err := eventutils.CloseRegistrations(bson.M{
+		"orderId": order.OrderID,
+		"status":  eventutils.RegistrationStatusPendingPayment,
+	}, eventutils.RegistrationStatusExpired)
+	return err
+}
+
+// SweepExpiredOrders expires unpaid orders whose payment window has elapsed
+// and releases the seats of unpaid registrations whose hold has run out.
+// Orders the provider reports as paid are confirmed instead.
+func SweepExpiredOrders() error {
+	db, col, err := mongoSetup.ConnectMongo("orderDetails")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	cursor, err := col.Find(ctx, bson.M{
+		"status":    bson.M{"$in": bson.A{OrderStatusCreated, OrderStatusAttempted, OrderStatusFailed}},
+		"expiresAt": bson.M{"$gt": 0, "$lt": now},
+	}, options.Find().SetSort(bson.M{"expiresAt": 1}).SetLimit(500))
+	if err != nil {
+		return fmt.Errorf("failed to fetch expired orders: %w", err)
+	}
+	var orders []paymentModel.OrderDetails
+	if err := cursor.All(ctx, &orders); err != nil {
+		return fmt.Errorf("failed to decode expired orders: %w", err)
+	}
+
+	for _, order := range orders {
+		// A payment may have been captured without its webhook reaching us
+		status, err := fetchOrderStatus(order)
+		if err != nil {
+			if order.ExpiresAt > now-int64(statusCheckGracePeriod/time.Second) {
+				log.Printf("Failed to fetch status of order %s, will retry: %v", order.OrderID, err)
+				continue
+			}
+			log.Printf("Failed to fetch status of order %s, expiring it: %v", order.OrderID, err)
+		} else if status.Status == ProviderOrderPaid && status.PaymentID != "" {
+			if _, _, err := ConfirmOrderPayment(order.OrderID, status.PaymentID); err != nil {
+				log.Printf("Failed to confirm paid order %s: %v", order.OrderID, err)
+			}
+			continue
+		}
+
+		if err := ExpireOrder(order); err != nil && err != ErrInvalidOrderTransition {
+			log.Printf("Failed to expire order %s: %v", order.OrderID, err)
+		}
+	}
+
+	// Registrations whose hold ran out before an order was created for them
+	_, err = eventutils.CloseRegistrations(bson.M{
+		"status":        eventutils.RegistrationStatusPendingPayment,
+		"orderId":       bson.M{"$in": bson.A{nil, ""}},
+		"holdExpiresAt": bson.M{"$gt": 0, "$lt": now},
+	}, eventutils.RegistrationStatusExpired)
+	return err
+}
+
+// fetchOrderStatus asks the order's provider whether it has been paid.
+func fetchOrderStatus(order paymentModel.OrderDetails) (paymentModel.ProviderOrderStatus, error) {
+	provider, err := ProviderByName(order.Provider)
+	if err != nil {
+		return paymentModel.ProviderOrderStatus{}, err
+	}
+	return provider.FetchOrderStatus(order.OrderID)
+}
+
+// StartOrderSweeper runs SweepExpiredOrders every ORDER_SWEEP_INTERVAL_SECONDS.
+// It blocks, so start it in its own goroutine.
+func StartOrderSweeper() {
+	seconds, err := strconv.Atoi(commonutils.LoadEnv("ORDER_SWEEP_INTERVAL_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = defaultSweepIntervalSeconds
+	}
+
+	ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := SweepExpiredOrders(); err != nil {
+			log.Printf("Order sweep failed: %v", err)
+		}
+	}
+}
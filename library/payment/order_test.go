@@ -0,0 +1,42 @@
+package paymentutils
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestAllowedFrom(t *testing.T) {
+	tests := []struct {
+		name        string
+		transitions map[string][]string
+		status      string
+		want        []string
+	}{
+		{"paid from any unpaid state", orderTransitions, OrderStatusPaid, []string{OrderStatusAttempted, OrderStatusCreated, OrderStatusExpired, OrderStatusFailed}},
+		{"attempted again after a failure", orderTransitions, OrderStatusAttempted, []string{OrderStatusCreated, OrderStatusFailed}},
+		{"expired until paid", orderTransitions, OrderStatusExpired, []string{OrderStatusAttempted, OrderStatusCreated, OrderStatusFailed}},
+		{"refunded only when paid", orderTransitions, OrderStatusRefunded, []string{OrderStatusPaid}},
+		{"nothing goes back to created", orderTransitions, OrderStatusCreated, []string{}},
+		{"refund processed", refundTransitions, RefundStatusProcessed, []string{RefundStatusPending, RefundStatusRequested}},
+		{"refund pending", refundTransitions, RefundStatusPending, []string{RefundStatusRequested}},
+	}
+	for _, test := range tests {
+		from := allowedFrom(test.transitions, test.status)
+		got := make([]string, len(from))
+		for i, state := range from {
+			got[i] = state.(string)
+		}
+		sort.Strings(got)
+		sort.Strings(test.want)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: allowedFrom(%q) = %v, want %v", test.name, test.status, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: allowedFrom(%q) = %v, want %v", test.name, test.status, got, test.want)
+				break
+			}
+		}
+	}
+}
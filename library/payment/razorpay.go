@@ -0,0 +1,249 @@
+package paymentutils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	commonutils "em_backend/library/common"
+	paymentModel "em_backend/models/payment"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type razorpayProvider struct {
+	apiKey        string
+	apiSecret     string
+	baseURL       string
+	webhookSecret string
+}
+
+func newRazorpayProvider() *razorpayProvider {
+	return &razorpayProvider{
+		apiKey:        commonutils.LoadEnv("RAZORPAY_API_KEY"),
+		apiSecret:     commonutils.LoadEnv("RAZORPAY_API_SECRET"),
+		baseURL:       commonutils.LoadEnv("RAZORPAY_BASE_URL"),
+		webhookSecret: commonutils.LoadEnv("RAZORPAY_WEBHOOK_SECRET"),
+	}
+}
+
+func (p *razorpayProvider) Name() string {
+	return ProviderRazorpay
+}
+
+func (p *razorpayProvider) client() *resty.Request {
+	return resty.New().R().
+		SetHeader("Content-Type", "application/json").
+		SetBasicAuth(p.apiKey, p.apiSecret)
+}
+
+// CreateOrder creates a new Razorpay order
+func (p *razorpayProvider) CreateOrder(req paymentModel.ProviderOrderRequest) (paymentModel.OrderResponse, error) {
+	var orderResp paymentModel.OrderResponse
+
+	// Only send the fields Razorpay knows about; internal references go in notes
+	body := paymentModel.RazorpayOrderReq{
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Receipt:  req.Receipt,
+		Notes:    req.Notes,
+	}
+
+	resp, err := p.client().SetBody(body).Post(p.baseURL + "/orders")
+	if err != nil {
+		log.Printf("Error making API request: %v", err)
+		return orderResp, err
+	}
+
+	// Check for non-200 HTTP response
+	if resp.StatusCode() != 200 && resp.StatusCode() != 201 {
+		return orderResp, fmt.Errorf("API error: %s", resp.String())
+	}
+
+	// Parse the response body
+	if err := json.Unmarshal(resp.Body(), &orderResp); err != nil {
+		log.Printf("Error parsing response body: %v", err)
+		return orderResp, err
+	}
+	orderResp.Provider = ProviderRazorpay
+	return orderResp, nil
+}
+
+// VerifyPayment verifies the Razorpay payment signature
+func (p *razorpayProvider) VerifyPayment(verification paymentModel.PaymentVerification) (bool, error) {
+	data := verification.OrderID + "|" + verification.PaymentID
+	h := hmac.New(sha256.New, []byte(p.apiSecret))
+	h.Write([]byte(data))
+	expectedSignature := hex.EncodeToString(h.Sum(nil))
+	return hmac.Equal([]byte(expectedSignature), []byte(verification.Signature)), nil
+}
+
+func (p *razorpayProvider) FetchOrderStatus(orderId string) (paymentModel.ProviderOrderStatus, error) {
+	status := paymentModel.ProviderOrderStatus{OrderID: orderId}
+
+	var order struct {
+		ID         string `json:"id"`
+		Amount     int64  `json:"amount"`
+		AmountPaid int64  `json:"amount_paid"`
+		Currency   string `json:"currency"`
+		Status     string `json:"status"`
+	}
+	resp, err := p.client().SetResult(&order).Get(p.baseURL + "/orders/" + orderId)
+	if err != nil {
+		return status, err
+	}
+	if resp.StatusCode() != 200 {
+		return status, fmt.Errorf("API error: %s", resp.String())
+	}
+	status.Amount = order.Amount
+	status.AmountPaid = order.AmountPaid
+	status.Currency = order.Currency
+	status.Status = ProviderOrderCreated
+	if order.Status == "paid" {
+		status.Status = ProviderOrderPaid
+	}
+
+	// Find the captured payment of the order
+	var payments struct {
+		Items []paymentModel.RazorpayPayment `json:"items"`
+	}
+	resp, err = p.client().SetResult(&payments).Get(p.baseURL + "/orders/" + orderId + "/payments")
+	if err != nil {
+		return status, err
+	}
+	if resp.StatusCode() != 200 {
+		return status, fmt.Errorf("API error: %s", resp.String())
+	}
+	for _, payment := range payments.Items {
+		if payment.Status == "captured" || payment.Status == "refunded" {
+			status.PaymentID = payment.ID
+			status.Status = ProviderOrderPaid
+			break
+		}
+	}
+	return status, nil
+}
+
+func (p *razorpayProvider) Refund(paymentId string, amount int64, notes map[string]string) (paymentModel.ProviderRefund, error) {
+	var refund paymentModel.RazorpayRefund
+	resp, err := p.client().
+		SetBody(map[string]interface{}{"amount": amount, "notes": notes}).
+		SetResult(&refund).
+		Post(p.baseURL + "/payments/" + paymentId + "/refund")
+	if err != nil {
+		return paymentModel.ProviderRefund{}, err
+	}
+	if resp.StatusCode() != 200 && resp.StatusCode() != 201 {
+		return paymentModel.ProviderRefund{}, fmt.Errorf("API error: %s", resp.String())
+	}
+	return paymentModel.ProviderRefund{
+		RefundID:  refund.ID,
+		PaymentID: refund.PaymentID,
+		Amount:    refund.Amount,
+		Currency:  refund.Currency,
+		Status:    refund.Status,
+	}, nil
+}
+
+func (p *razorpayProvider) ParseWebhook(body []byte, headers map[string]string) (paymentModel.ProviderWebhookEvent, error) {
+	event := paymentModel.ProviderWebhookEvent{}
+	if !VerifyWebhookSignature(body, headers["X-Razorpay-Signature"], p.webhookSecret) {
+		return event, ErrInvalidWebhookSignature
+	}
+
+	var webhook paymentModel.RazorpayWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return event, fmt.Errorf("invalid webhook body: %w", err)
+	}
+	event.EventID = WebhookEventId(headers["X-Razorpay-Event-Id"], body)
+
+	payment := webhook.Payload.Payment.Entity
+	refund := webhook.Payload.Refund.Entity
+	switch webhook.Event {
+	case "payment.captured", "order.paid":
+		event.Type = WebhookPaymentCaptured
+		event.OrderID = payment.OrderID
+		if event.OrderID == "" {
+			event.OrderID = webhook.Payload.Order.Entity.ID
+		}
+		event.PaymentID = payment.ID
+		event.Amount = payment.Amount
+		event.Currency = payment.Currency
+	case "payment.authorized":
+		event.Type = WebhookPaymentAttempted
+		event.OrderID = payment.OrderID
+		event.PaymentID = payment.ID
+		event.Amount = payment.Amount
+		event.Currency = payment.Currency
+	case "payment.failed":
+		event.Type = WebhookPaymentFailed
+		event.OrderID = payment.OrderID
+		event.PaymentID = payment.ID
+		event.Amount = payment.Amount
+		event.Currency = payment.Currency
+		event.ErrorCode = payment.ErrorCode
+		event.ErrorDescription = payment.ErrorDescription
+	case "refund.processed", "refund.failed":
+		event.Type = WebhookRefundProcessed
+		if webhook.Event == "refund.failed" {
+			event.Type = WebhookRefundFailed
+		}
+		event.PaymentID = refund.PaymentID
+		event.RefundID = refund.ID
+		event.Amount = refund.Amount
+		event.Currency = refund.Currency
+	default:
+		event.Type = WebhookEventUnsupported
+	}
+	return event, nil
+}
+
+// razorpayPageSize is the largest page Razorpay returns when listing payments
+const razorpayPageSize = 100
+
+func (p *razorpayProvider) ListPayments(from int64, to int64) ([]paymentModel.ProviderPayment, error) {
+	payments := []paymentModel.ProviderPayment{}
+	for skip := 0; ; skip += razorpayPageSize {
+		var page struct {
+			Items []paymentModel.RazorpayPayment `json:"items"`
+		}
+		resp, err := p.client().
+			SetQueryParams(map[string]string{
+				"from":  strconv.FormatInt(from, 10),
+				"to":    strconv.FormatInt(to, 10),
+				"count": strconv.Itoa(razorpayPageSize),
+				"skip":  strconv.Itoa(skip),
+			}).
+			SetResult(&page).
+			Get(p.baseURL + "/payments")
+		if err != nil {
+			return payments, err
+		}
+		if resp.StatusCode() != 200 {
+			return payments, fmt.Errorf("API error: %s", resp.String())
+		}
+
+		for _, payment := range page.Items {
+			status := payment.Status
+			switch payment.Status {
+			case "captured", "refunded":
+				status = capturedPaymentStatus(payment.Amount, payment.AmountRefunded)
+			}
+			payments = append(payments, paymentModel.ProviderPayment{
+				PaymentID:      payment.ID,
+				OrderID:        payment.OrderID,
+				Amount:         payment.Amount,
+				AmountRefunded: payment.AmountRefunded,
+				Currency:       payment.Currency,
+				Status:         status,
+				CreatedAt:      payment.CreatedAt,
+			})
+		}
+		if len(page.Items) < razorpayPageSize {
+			return payments, nil
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package paymentutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	paymentModel "em_backend/models/payment"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Discrepancies reported by Reconcile
+const (
+	// The provider captured a payment for an order we still consider unpaid
+	ReconcileMissedCapture = "missed_capture"
+	// The provider captured a payment for an order we have no record of
+	ReconcileUnknownOrder = "unknown_order"
+	// The order is paid but the payment itself was never stored
+	ReconcileMissingPaymentRecord = "missing_payment_record"
+	// The order was already paid by a different payment
+	ReconcileDuplicateCapture = "duplicate_capture"
+	ReconcileAmountMismatch   = "amount_mismatch"
+	ReconcileRefundMismatch   = "refund_mismatch"
+	// We consider a payment captured, the provider has no captured payment
+	ReconcileStatusMismatch = "status_mismatch"
+	// We marked an order paid but the provider did not list its payment
+	ReconcilePaidLocallyNotCaptured = "paid_locally_not_captured"
+)
+
+// Payments are created at the provider before their order is marked paid, so
+// payments created this long before the range are also listed to match the
+// orders paid in it
+const reconcileLookback = 24 * time.Hour
+
+// Reconcile compares the payments a provider created between from and to
+// (unix seconds) with our orders and payments. Captures we missed are
+// confirmed unless dryRun is set; everything else is only reported. The
+// report is stored in reconciliationReports.
+func Reconcile(providerName string, from int64, to int64, dryRun bool, runBy string) (paymentModel.ReconciliationReport, error) {
+	report := paymentModel.ReconciliationReport{
+		ReportId:  uuid.New().String(),
+		From:      from,
+		To:        to,
+		DryRun:    dryRun,
+		Items:     []paymentModel.ReconciliationItem{},
+		StartedAt: time.Now().Unix(),
+		RunBy:     runBy,
+	}
+
+	provider := ActiveProvider()
+	if providerName != "" {
+		var err error
+		if provider, err = ProviderByName(providerName); err != nil {
+			return report, err
+		}
+	}
+	report.Provider = provider.Name()
+
+	listedPayments, err := provider.ListPayments(from-int64(reconcileLookback/time.Second), to)
+	if err != nil {
+		return report, fmt.Errorf("failed to list provider payments: %w", err)
+	}
+	listed := map[string]bool{}
+	providerPayments := []paymentModel.ProviderPayment{}
+	for _, payment := range listedPayments {
+		listed[payment.PaymentID] = true
+		if payment.CreatedAt >= from {
+			providerPayments = append(providerPayments, payment)
+		}
+	}
+	report.ProviderPayments = len(providerPayments)
+
+	db, ordersCol, err := mongoSetup.ConnectMongo("orderDetails")
+	if err != nil {
+		return report, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Load our side of every payment the provider listed
+	orderIds := bson.A{}
+	paymentIds := bson.A{}
+	for _, payment := range providerPayments {
+		orderIds = append(orderIds, payment.OrderID)
+		paymentIds = append(paymentIds, payment.PaymentID)
+	}
+
+	orders := map[string]paymentModel.OrderDetails{}
+	cursor, err := ordersCol.Find(ctx, bson.M{"orderId": bson.M{"$in": orderIds}})
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch orders: %w", err)
+	}
+	var orderList []paymentModel.OrderDetails
+	if err := cursor.All(ctx, &orderList); err != nil {
+		return report, fmt.Errorf("failed to decode orders: %w", err)
+	}
+	for _, order := range orderList {
+		orders[order.OrderID] = order
+	}
+
+	payments := map[string]paymentModel.PaymentDetails{}
+	cursor, err = db.Collection("paymentDetails").Find(ctx, bson.M{"paymentId": bson.M{"$in": paymentIds}})
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch payments: %w", err)
+	}
+	var paymentList []paymentModel.PaymentDetails
+	if err := cursor.All(ctx, &paymentList); err != nil {
+		return report, fmt.Errorf("failed to decode payments: %w", err)
+	}
+	for _, payment := range paymentList {
+		payments[payment.PaymentID] = payment
+	}
+
+	for _, providerPayment := range providerPayments {
+		item := paymentModel.ReconciliationItem{
+			OrderId:        providerPayment.OrderID,
+			PaymentId:      providerPayment.PaymentID,
+			ProviderStatus: providerPayment.Status,
+			ProviderAmount: providerPayment.Amount,
+			Currency:       providerPayment.Currency,
+		}
+		local, hasLocal := payments[providerPayment.PaymentID]
+		if hasLocal {
+			item.LocalStatus = local.Status
+			item.LocalAmount = local.Amount
+		}
+
+		// Payments that never captured only matter if we think they did
+		if !isCapturedStatus(providerPayment.Status) {
+			if hasLocal && isCapturedStatus(local.Status) {
+				item.Type = ReconcileStatusMismatch
+				item.Detail = "payment is captured locally but not at the provider"
+				report.Items = append(report.Items, item)
+			}
+			continue
+		}
+
+		order, hasOrder := orders[providerPayment.OrderID]
+		if !hasOrder {
+			item.Type = ReconcileUnknownOrder
+			item.Detail = "no order with this id"
+			report.Items = append(report.Items, item)
+			continue
+		}
+		if !hasLocal {
+			item.LocalStatus = order.Status
+			item.LocalAmount = order.Amount
+			switch {
+			case order.Status == OrderStatusPaid && order.PaymentId == providerPayment.PaymentID:
+				item.Type = ReconcileMissingPaymentRecord
+				item.Detail = "order is paid but the payment was not stored"
+			case order.Status == OrderStatusPaid || order.Status == OrderStatusRefunded:
+				item.Type = ReconcileDuplicateCapture
+				item.Detail = fmt.Sprintf("order was already paid by payment %s", order.PaymentId)
+			default:
+				item.Type = ReconcileMissedCapture
+				item.Detail = "provider captured a payment for an unpaid order"
+				if !dryRun {
+					if _, _, err := ConfirmOrderPayment(order.OrderID, providerPayment.PaymentID); err != nil {
+						log.Printf("Failed to confirm missed capture of order %s: %v", order.OrderID, err)
+						item.Detail = fmt.Sprintf("%s, confirming it failed: %v", item.Detail, err)
+					} else {
+						item.Fixed = true
+					}
+				}
+			}
+			report.Items = append(report.Items, item)
+			continue
+		}
+
+		matched := true
+		if providerPayment.Amount != local.Amount {
+			matched = false
+			mismatch := item
+			mismatch.Type = ReconcileAmountMismatch
+			mismatch.Detail = "captured amount differs"
+			report.Items = append(report.Items, mismatch)
+		}
+		if providerPayment.AmountRefunded != local.RefundedAmount {
+			matched = false
+			mismatch := item
+			mismatch.Type = ReconcileRefundMismatch
+			mismatch.ProviderAmount = providerPayment.AmountRefunded
+			mismatch.LocalAmount = local.RefundedAmount
+			mismatch.Detail = "refunded amount differs"
+			report.Items = append(report.Items, mismatch)
+		}
+		if matched {
+			report.Matched++
+		}
+	}
+
+	// Orders we marked paid in the range whose payment the provider did not list
+	providerFilter := bson.A{report.Provider}
+	if report.Provider == ProviderRazorpay {
+		// Orders created before providers were recorded were all Razorpay
+		providerFilter = append(providerFilter, "", nil)
+	}
+	cursor, err = ordersCol.Find(ctx, bson.M{
+		"provider": bson.M{"$in": providerFilter},
+		"status":   bson.M{"$in": bson.A{OrderStatusPaid, OrderStatusRefunded}},
+		"paidAt":   bson.M{"$gte": from, "$lte": to},
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch paid orders: %w", err)
+	}
+	var paidOrders []paymentModel.OrderDetails
+	if err := cursor.All(ctx, &paidOrders); err != nil {
+		return report, fmt.Errorf("failed to decode paid orders: %w", err)
+	}
+	for _, order := range paidOrders {
+		if listed[order.PaymentId] {
+			continue
+		}
+		report.Items = append(report.Items, paymentModel.ReconciliationItem{
+			Type:        ReconcilePaidLocallyNotCaptured,
+			OrderId:     order.OrderID,
+			PaymentId:   order.PaymentId,
+			LocalStatus: order.Status,
+			LocalAmount: order.Amount,
+			Currency:    order.Currency,
+			Detail:      "provider did not list this payment in the range",
+		})
+	}
+
+	report.FinishedAt = time.Now().Unix()
+	if _, err := db.Collection("reconciliationReports").InsertOne(ctx, report); err != nil {
+		return report, fmt.Errorf("failed to save reconciliation report: %w", err)
+	}
+	return report, nil
+}
+
+func isCapturedStatus(status string) bool {
+	switch status {
+	case PaymentStatusCaptured, PaymentStatusPartiallyRefunded, PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package paymentutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	eventutils "em_backend/library/events"
+	paymentModel "em_backend/models/payment"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	RefundStatusRequested = "requested"
+	RefundStatusPending   = "pending"
+	RefundStatusProcessed = "processed"
+	RefundStatusFailed    = "failed"
+)
+
+// refundTransitions lists the states a refund may move to from each state.
+// Processed and failed refunds are final.
+var refundTransitions = map[string][]string{
+	RefundStatusRequested: {RefundStatusPending, RefundStatusProcessed, RefundStatusFailed},
+	RefundStatusPending:   {RefundStatusProcessed, RefundStatusFailed},
+}
+
+var (
+	ErrOrderNotRefundable      = errors.New("order has no captured payment to refund")
+	ErrInvalidRefundAmount     = errors.New("refund amount must be positive")
+	ErrRefundExceedsPayment    = errors.New("refund exceeds the refundable amount of the order")
+	ErrInvalidRefundTransition = errors.New("invalid refund status transition")
+)
+
+// RefundableAmount returns how much of a paid order can still be refunded,
+// counting refunds that are requested or in flight.
+func RefundableAmount(order paymentModel.OrderDetails) (int64, error) {
+	db, col, err := mongoSetup.ConnectMongo("refunds")
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, bson.M{"orderId": order.OrderID, "status": bson.M{"$ne": RefundStatusFailed}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch refunds: %w", err)
+	}
+	var refunds []paymentModel.Refund
+	if err := cursor.All(ctx, &refunds); err != nil {
+		return 0, fmt.Errorf("failed to decode refunds: %w", err)
+	}
+
+	refundable := order.Amount
+	for _, refund := range refunds {
+		refundable -= refund.Amount
+	}
+	if refundable < 0 {
+		refundable = 0
+	}
+	return refundable, nil
+}
+
+// IssueRefund refunds amount of a paid order through the provider the order
+// was paid with and records the refund. The given registrations are closed as
+// refunded once the provider accepts the refund.
+func IssueRefund(order paymentModel.OrderDetails, amount int64, registrationIds []string, reason string, initiatedBy string) (paymentModel.Refund, error) {
+	var refund paymentModel.Refund
+	if order.Status != OrderStatusPaid || order.PaymentId == "" {
+		return refund, ErrOrderNotRefundable
+	}
+	if amount <= 0 {
+		return refund, ErrInvalidRefundAmount
+	}
+	provider, err := ProviderByName(order.Provider)
+	if err != nil {
+		return refund, err
+	}
+	if err := reserveRefund(order, amount); err != nil {
+		return refund, err
+	}
+
+	// Record the request before calling the provider
+	now := time.Now().Unix()
+	refund = paymentModel.Refund{
+		RefundId:        uuid.New().String(),
+		Provider:        provider.Name(),
+		OrderId:         order.OrderID,
+		PaymentId:       order.PaymentId,
+		EventId:         order.EventId,
+		RegistrationIds: registrationIds,
+		Amount:          amount,
+		Currency:        order.Currency,
+		Reason:          reason,
+		InitiatedBy:     initiatedBy,
+		Status:          RefundStatusRequested,
+		StatusHistory:   []paymentModel.StatusChange{{Status: RefundStatusRequested, At: now}},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := insertRefund(refund); err != nil {
+		if releaseErr := releaseRefund(order.OrderID, amount); releaseErr != nil {
+			fmt.Println("Error releasing refund:", releaseErr)
+		}
+		return refund, err
+	}
+
+	providerRefund, err := provider.Refund(order.PaymentId, amount, map[string]string{
+		"refund_id": refund.RefundId,
+		"order_id":  order.OrderID,
+	})
+	if err != nil {
+		if transitionErr := transitionRefund(bson.M{"refundId": refund.RefundId}, RefundStatusFailed, err.Error(), nil); transitionErr != nil {
+			fmt.Println("Error marking refund as failed:", transitionErr)
+		} else if releaseErr := releaseRefund(order.OrderID, amount); releaseErr != nil {
+			fmt.Println("Error releasing refund:", releaseErr)
+		}
+		refund.Status = RefundStatusFailed
+		return refund, fmt.Errorf("provider refused the refund: %w", err)
+	}
+
+	status := RefundStatusPending
+	switch providerRefund.Status {
+	case RefundStatusProcessed:
+		status = RefundStatusProcessed
+	case RefundStatusFailed:
+		status = RefundStatusFailed
+	}
+	err = transitionRefund(bson.M{"refundId": refund.RefundId}, status, "", bson.M{"providerRefundId": providerRefund.RefundID})
+	if err != nil {
+		return refund, err
+	}
+	refund.Status = status
+	refund.ProviderRefundId = providerRefund.RefundID
+	if status == RefundStatusFailed {
+		if releaseErr := releaseRefund(order.OrderID, amount); releaseErr != nil {
+			fmt.Println("Error releasing refund:", releaseErr)
+		}
+		return refund, fmt.Errorf("provider refused the refund")
+	}
+
+	// The seats are given up as soon as the refund is accepted
+	if len(registrationIds) > 0 {
+		_, err := eventutils.CloseRegistrations(bson.M{"registrationid": bson.M{"$in": registrationIds}}, eventutils.RegistrationStatusRefunded)
+		if err != nil {
+			return refund, err
+		}
+	}
+
+	// Apply refunds the provider settled immediately; the webhook for them is
+	// then a no-op
+	if status == RefundStatusProcessed {
+		err := RecordRefund(paymentModel.ProviderWebhookEvent{
+			PaymentID: order.PaymentId,
+			RefundID:  providerRefund.RefundID,
+			Amount:    amount,
+			Currency:  order.Currency,
+		})
+		if err != nil {
+			return refund, err
+		}
+	}
+	return refund, nil
+}
+
+// UpdateRefundStatus moves the refund with the given provider refund id to a
+// new status. Refunds created outside this service are not tracked and are
+// ignored.
+func UpdateRefundStatus(providerRefundId string, status string, note string) error {
+	err := transitionRefund(bson.M{"providerRefundId": providerRefundId}, status, note, nil)
+	if err == ErrInvalidRefundTransition {
+		return nil
+	}
+	if err != nil || status != RefundStatusFailed {
+		return err
+	}
+
+	// A failed refund gives its amount back to the order
+	db, col, err := mongoSetup.ConnectMongo("refunds")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var refund paymentModel.Refund
+	if err := col.FindOne(ctx, bson.M{"providerRefundId": providerRefundId}).Decode(&refund); err != nil {
+		return fmt.Errorf("failed to fetch refund: %w", err)
+	}
+	return releaseRefund(refund.OrderId, refund.Amount)
+}
+
+// reserveRefund takes amount out of what is left to refund on the order, so
+// concurrent refunds cannot together exceed the payment. Orders refunded
+// before the reservation was tracked start from their existing refunds.
+func reserveRefund(order paymentModel.OrderDetails, amount int64) error {
+	db, col, err := mongoSetup.ConnectMongo("orderDetails")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if order.RefundReserved == 0 {
+		refundable, err := RefundableAmount(order)
+		if err != nil {
+			return err
+		}
+		_, err = col.UpdateOne(ctx,
+			bson.M{"orderId": order.OrderID, "refundReserved": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"refundReserved": order.Amount - refundable}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+	}
+
+	result, err := col.UpdateOne(ctx,
+		bson.M{
+			"orderId": order.OrderID,
+			"status":  OrderStatusPaid,
+			"$expr":   bson.M{"$lte": bson.A{bson.M{"$add": bson.A{"$refundReserved", amount}}, "$amount"}},
+		},
+		bson.M{"$inc": bson.M{"refundReserved": amount}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reserve refund: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrRefundExceedsPayment
+	}
+	return nil
+}
+
+// releaseRefund gives the amount of a refund that did not go through back to
+// the order.
+func releaseRefund(orderId string, amount int64) error {
+	db, col, err := mongoSetup.ConnectMongo("orderDetails")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = col.UpdateOne(ctx, bson.M{"orderId": orderId}, bson.M{"$inc": bson.M{"refundReserved": -amount}})
+	if err != nil {
+		return fmt.Errorf("failed to release refund: %w", err)
+	}
+	return nil
+}
+
+func insertRefund(refund paymentModel.Refund) error {
+	db, col, err := mongoSetup.ConnectMongo("refunds")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := col.InsertOne(ctx, refund); err != nil {
+		return fmt.Errorf("failed to save refund: %w", err)
+	}
+	return nil
+}
+
+// transitionRefund moves a refund to status when that is allowed from its
+// current status and appends the change to its history.
+func transitionRefund(filter bson.M, status string, note string, set bson.M) error {
+	from := allowedFrom(refundTransitions, status)
+
+	db, col, err := mongoSetup.ConnectMongo("refunds")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().Unix()
+	update := bson.M{"status": status, "updatedAt": now}
+	for key, value := range set {
+		update[key] = value
+	}
+	result, err := col.UpdateOne(ctx,
+		bson.M{"$and": bson.A{filter, bson.M{"status": bson.M{"$in": from}}}},
+		bson.M{
+			"$set":  update,
+			"$push": bson.M{"statusHistory": paymentModel.StatusChange{Status: status, Note: note, At: now}},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidRefundTransition
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package paymentutils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	commonutils "em_backend/library/common"
+	paymentModel "em_backend/models/payment"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	stripeBaseURL = "https://api.stripe.com/v1"
+
+	// Stripe rejects webhook signatures older than this
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// stripeProvider takes payments through Stripe payment intents. The payment
+// intent id is used as the order id and its charge id as the payment id.
+type stripeProvider struct {
+	secretKey     string
+	webhookSecret string
+}
+
+type stripePaymentIntent struct {
+	ID               string            `json:"id"`
+	Amount           int64             `json:"amount"`
+	AmountReceived   int64             `json:"amount_received"`
+	Currency         string            `json:"currency"`
+	Status           string            `json:"status"`
+	ClientSecret     string            `json:"client_secret"`
+	LatestCharge     string            `json:"latest_charge"`
+	Metadata         map[string]string `json:"metadata"`
+	LastPaymentError *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+type stripeRefund struct {
+	ID            string `json:"id"`
+	Amount        int64  `json:"amount"`
+	Charge        string `json:"charge"`
+	Currency      string `json:"currency"`
+	PaymentIntent string `json:"payment_intent"`
+	Status        string `json:"status"`
+}
+
+func newStripeProvider() *stripeProvider {
+	return &stripeProvider{
+		secretKey:     commonutils.LoadEnv("STRIPE_SECRET_KEY"),
+		webhookSecret: commonutils.LoadEnv("STRIPE_WEBHOOK_SECRET"),
+	}
+}
+
+func (p *stripeProvider) Name() string {
+	return ProviderStripe
+}
+
+func (p *stripeProvider) client() *resty.Request {
+	return resty.New().R().SetAuthToken(p.secretKey)
+}
+
+func (p *stripeProvider) CreateOrder(req paymentModel.ProviderOrderRequest) (paymentModel.OrderResponse, error) {
+	var orderResp paymentModel.OrderResponse
+
+	form := map[string]string{
+		"amount":                             strconv.FormatInt(req.Amount, 10),
+		"currency":                           strings.ToLower(req.Currency),
+		"automatic_payment_methods[enabled]": "true",
+		"metadata[receipt]":                  req.Receipt,
+	}
+	for key, value := range req.Notes {
+		form["metadata["+key+"]"] = value
+	}
+
+	var intent stripePaymentIntent
+	resp, err := p.client().SetFormData(form).SetResult(&intent).Post(stripeBaseURL + "/payment_intents")
+	if err != nil {
+		return orderResp, err
+	}
+	if resp.StatusCode() != 200 {
+		return orderResp, fmt.Errorf("API error: %s", resp.String())
+	}
+
+	orderResp.ID = intent.ID
+	orderResp.Amount = intent.Amount
+	orderResp.Currency = strings.ToUpper(intent.Currency)
+	orderResp.Receipt = req.Receipt
+	orderResp.Status = ProviderOrderCreated
+	orderResp.Provider = ProviderStripe
+	orderResp.ClientSecret = intent.ClientSecret
+	return orderResp, nil
+}
+
+// VerifyPayment asks Stripe whether the payment intent succeeded, since
+// Stripe does not sign client side confirmations.
+func (p *stripeProvider) VerifyPayment(verification paymentModel.PaymentVerification) (bool, error) {
+	intent, err := p.fetchIntent(verification.OrderID)
+	if err != nil {
+		return false, err
+	}
+	return intent.Status == "succeeded" && intent.LatestCharge == verification.PaymentID, nil
+}
+
+func (p *stripeProvider) FetchOrderStatus(orderId string) (paymentModel.ProviderOrderStatus, error) {
+	status := paymentModel.ProviderOrderStatus{OrderID: orderId}
+	intent, err := p.fetchIntent(orderId)
+	if err != nil {
+		return status, err
+	}
+	status.Amount = intent.Amount
+	status.AmountPaid = intent.AmountReceived
+	status.Currency = strings.ToUpper(intent.Currency)
+	switch intent.Status {
+	case "succeeded":
+		status.Status = ProviderOrderPaid
+		status.PaymentID = intent.LatestCharge
+	case "canceled":
+		status.Status = ProviderOrderFailed
+	default:
+		status.Status = ProviderOrderCreated
+	}
+	return status, nil
+}
+
+func (p *stripeProvider) fetchIntent(intentId string) (stripePaymentIntent, error) {
+	var intent stripePaymentIntent
+	resp, err := p.client().SetResult(&intent).Get(stripeBaseURL + "/payment_intents/" + intentId)
+	if err != nil {
+		return intent, err
+	}
+	if resp.StatusCode() != 200 {
+		return intent, fmt.Errorf("API error: %s", resp.String())
+	}
+	return intent, nil
+}
+
+func (p *stripeProvider) Refund(paymentId string, amount int64, notes map[string]string) (paymentModel.ProviderRefund, error) {
+	form := map[string]string{
+		"charge": paymentId,
+		"amount": strconv.FormatInt(amount, 10),
+	}
+	for key, value := range notes {
+		form["metadata["+key+"]"] = value
+	}
+
+	var refund stripeRefund
+	resp, err := p.client().SetFormData(form).SetResult(&refund).Post(stripeBaseURL + "/refunds")
+	if err != nil {
+		return paymentModel.ProviderRefund{}, err
+	}
+	if resp.StatusCode() != 200 {
+		return paymentModel.ProviderRefund{}, fmt.Errorf("API error: %s", resp.String())
+	}
+	return paymentModel.ProviderRefund{
+		RefundID:  refund.ID,
+		PaymentID: refund.Charge,
+		Amount:    refund.Amount,
+		Currency:  strings.ToUpper(refund.Currency),
+		Status:    stripeRefundStatus(refund.Status),
+	}, nil
+}
+
+func (p *stripeProvider) ParseWebhook(body []byte, headers map[string]string) (paymentModel.ProviderWebhookEvent, error) {
+	event := paymentModel.ProviderWebhookEvent{}
+	if !p.verifySignature(body, headers["Stripe-Signature"]) {
+		return event, ErrInvalidWebhookSignature
+	}
+
+	var webhook struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return event, fmt.Errorf("invalid webhook body: %w", err)
+	}
+	event.EventID = webhook.ID
+
+	switch webhook.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed":
+		var intent stripePaymentIntent
+		if err := json.Unmarshal(webhook.Data.Object, &intent); err != nil {
+			return event, fmt.Errorf("invalid payment intent: %w", err)
+		}
+		event.OrderID = intent.ID
+		event.PaymentID = intent.LatestCharge
+		event.Amount = intent.Amount
+		event.Currency = strings.ToUpper(intent.Currency)
+		event.Type = WebhookPaymentCaptured
+		if webhook.Type == "payment_intent.payment_failed" {
+			event.Type = WebhookPaymentFailed
+			if event.PaymentID == "" {
+				event.PaymentID = intent.ID
+			}
+			if intent.LastPaymentError != nil {
+				event.ErrorCode = intent.LastPaymentError.Code
+				event.ErrorDescription = intent.LastPaymentError.Message
+			}
+		}
+	case "payment_intent.processing":
+		var intent stripePaymentIntent
+		if err := json.Unmarshal(webhook.Data.Object, &intent); err != nil {
+			return event, fmt.Errorf("invalid payment intent: %w", err)
+		}
+		event.Type = WebhookPaymentAttempted
+		event.OrderID = intent.ID
+		event.Amount = intent.Amount
+		event.Currency = strings.ToUpper(intent.Currency)
+	case "refund.created", "refund.updated":
+		var refund stripeRefund
+		if err := json.Unmarshal(webhook.Data.Object, &refund); err != nil {
+			return event, fmt.Errorf("invalid refund: %w", err)
+		}
+		event.OrderID = refund.PaymentIntent
+		event.PaymentID = refund.Charge
+		event.RefundID = refund.ID
+		event.Amount = refund.Amount
+		event.Currency = strings.ToUpper(refund.Currency)
+		switch stripeRefundStatus(refund.Status) {
+		case "processed":
+			event.Type = WebhookRefundProcessed
+		case "failed":
+			event.Type = WebhookRefundFailed
+		default:
+			event.Type = WebhookEventUnsupported
+		}
+	default:
+		event.Type = WebhookEventUnsupported
+	}
+	return event, nil
+}
+
+// verifySignature checks a Stripe-Signature header of the form
+// "t=<timestamp>,v1=<signature>".
+func (p *stripeProvider) verifySignature(body []byte, header string) bool {
+	if p.webhookSecret == "" || header == "" {
+		return false
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if math.Abs(float64(time.Now().Unix()-signedAt)) > stripeSignatureTolerance.Seconds() {
+		return false
+	}
+
+	h := hmac.New(sha256.New, []byte(p.webhookSecret))
+	h.Write([]byte(timestamp + "."))
+	h.Write(body)
+	expected := hex.EncodeToString(h.Sum(nil))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripeRefundStatus maps Stripe refund states onto Razorpay's names, which
+// the rest of the service uses.
+func stripeRefundStatus(status string) string {
+	switch status {
+	case "succeeded":
+		return "processed"
+	case "failed", "canceled":
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// ListPayments lists charges, whose payment intent is the order id.
+func (p *stripeProvider) ListPayments(from int64, to int64) ([]paymentModel.ProviderPayment, error) {
+	payments := []paymentModel.ProviderPayment{}
+	startingAfter := ""
+	for {
+		params := map[string]string{
+			"created[gte]": strconv.FormatInt(from, 10),
+			"created[lte]": strconv.FormatInt(to, 10),
+			"limit":        "100",
+		}
+		if startingAfter != "" {
+			params["starting_after"] = startingAfter
+		}
+		var page struct {
+			Data []struct {
+				ID             string `json:"id"`
+				PaymentIntent  string `json:"payment_intent"`
+				Amount         int64  `json:"amount"`
+				AmountRefunded int64  `json:"amount_refunded"`
+				Currency       string `json:"currency"`
+				Status         string `json:"status"`
+				Created        int64  `json:"created"`
+			} `json:"data"`
+			HasMore bool `json:"has_more"`
+		}
+		resp, err := p.client().SetQueryParams(params).SetResult(&page).Get(stripeBaseURL + "/charges")
+		if err != nil {
+			return payments, err
+		}
+		if resp.StatusCode() != 200 {
+			return payments, fmt.Errorf("API error: %s", resp.String())
+		}
+
+		for _, charge := range page.Data {
+			status := PaymentStatusFailed
+			switch charge.Status {
+			case "succeeded":
+				status = capturedPaymentStatus(charge.Amount, charge.AmountRefunded)
+			case "pending":
+				status = "pending"
+			}
+			payments = append(payments, paymentModel.ProviderPayment{
+				PaymentID:      charge.ID,
+				OrderID:        charge.PaymentIntent,
+				Amount:         charge.Amount,
+				AmountRefunded: charge.AmountRefunded,
+				Currency:       strings.ToUpper(charge.Currency),
+				Status:         status,
+				CreatedAt:      charge.Created,
+			})
+		}
+		if !page.HasMore || len(page.Data) == 0 {
+			return payments, nil
+		}
+		startingAfter = page.Data[len(page.Data)-1].ID
+	}
+}
@@ -0,0 +1,50 @@
+package paymentutils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func stripeTestSignature(secret string, timestamp int64, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(fmt.Sprintf("%d.", timestamp)))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestStripeVerifySignature(t *testing.T) {
+	provider := &stripeProvider{webhookSecret: "whsec_test"}
+	body := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	now := time.Now().Unix()
+	valid := stripeTestSignature("whsec_test", now, body)
+	stale := now - int64(stripeSignatureTolerance/time.Second) - 60
+
+	tests := []struct {
+		name     string
+		provider *stripeProvider
+		header   string
+		body     []byte
+		want     bool
+	}{
+		{"valid", provider, fmt.Sprintf("t=%d,v1=%s", now, valid), body, true},
+		{"valid with spaces", provider, fmt.Sprintf("t=%d, v1=%s", now, valid), body, true},
+		{"one of several signatures", provider, fmt.Sprintf("t=%d,v1=deadbeef,v1=%s,v0=abc", now, valid), body, true},
+		{"wrong secret", provider, fmt.Sprintf("t=%d,v1=%s", now, stripeTestSignature("whsec_other", now, body)), body, false},
+		{"tampered body", provider, fmt.Sprintf("t=%d,v1=%s", now, valid), []byte(`{"id":"evt_2"}`), false},
+		{"timestamp changed", provider, fmt.Sprintf("t=%d,v1=%s", now+1, valid), body, false},
+		{"too old", provider, fmt.Sprintf("t=%d,v1=%s", stale, stripeTestSignature("whsec_test", stale, body)), body, false},
+		{"no timestamp", provider, "v1=" + valid, body, false},
+		{"no signature", provider, fmt.Sprintf("t=%d", now), body, false},
+		{"empty header", provider, "", body, false},
+		{"no webhook secret", &stripeProvider{}, fmt.Sprintf("t=%d,v1=%s", now, stripeTestSignature("", now, body)), body, false},
+	}
+	for _, test := range tests {
+		if got := test.provider.verifySignature(test.body, test.header); got != test.want {
+			t.Errorf("%s: verifySignature() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package paymentutils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	mongoSetup "em_backend/configs/mongo"
+	eventutils "em_backend/library/events"
+	ledgerutils "em_backend/library/ledger"
+	notifyutils "em_backend/library/notification"
+	paymentModel "em_backend/models/payment"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// VerifyWebhookSignature checks the hex HMAC-SHA256 signature of a raw
+// webhook body.
+func VerifyWebhookSignature(body []byte, signature string, secret string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	expected := hex.EncodeToString(h.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// WebhookEventId returns the provider's event id, falling back to a hash of
+// the body when the provider did not send one.
+func WebhookEventId(eventId string, body []byte) string {
+	if eventId != "" {
+		return eventId
+	}
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// CheckWebhookProvider makes sure a webhook event is about an order created
+// with the provider that signed it, so that one gateway's credentials can
+// never settle or refund another gateway's orders. Events for orders that
+// are not known pass, their handlers ignore them.
+func CheckWebhookProvider(provider string, event paymentModel.ProviderWebhookEvent) error {
+	db, col, err := mongoSetup.ConnectMongo("orderDetails")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Refund events only name the payment, or only the refund
+	orderId := event.OrderID
+	if orderId == "" && event.PaymentID != "" {
+		var payment paymentModel.PaymentDetails
+		err := db.Collection("paymentDetails").FindOne(ctx, bson.M{"paymentId": event.PaymentID}).Decode(&payment)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return fmt.Errorf("failed to fetch payment: %w", err)
+		}
+		orderId = payment.OrderID
+	}
+	if orderId == "" && event.RefundID != "" {
+		var refund paymentModel.Refund
+		err := db.Collection("refunds").FindOne(ctx, bson.M{"providerRefundId": event.RefundID}).Decode(&refund)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return fmt.Errorf("failed to fetch refund: %w", err)
+		}
+		orderId = refund.OrderId
+	}
+	if orderId == "" {
+		return nil
+	}
+
+	var order paymentModel.OrderDetails
+	err = col.FindOne(ctx, bson.M{"orderId": orderId}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch order: %w", err)
+	}
+	// Orders from before providers were recorded are Razorpay's
+	orderProvider := order.Provider
+	if orderProvider == "" {
+		orderProvider = ProviderRazorpay
+	}
+	if orderProvider != provider {
+		return fmt.Errorf("%w: order %s was created with %s", ErrWebhookProviderMismatch, orderId, orderProvider)
+	}
+	return nil
+}
+
+// ClaimWebhookEvent records a webhook event before it is processed. It
+// returns false when the event was already claimed, so provider retries are
+// handled only once. This relies on the unique webhook event index.
+func ClaimWebhookEvent(provider string, eventId string, event string) (bool, error) {
+	db, col, err := mongoSetup.ConnectMongo("webhookEvents")
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = col.InsertOne(ctx, paymentModel.WebhookEvent{
+		EventId:    eventId,
+		Provider:   provider,
+		Event:      event,
+		ReceivedAt: time.Now().Unix(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record webhook event: %w", err)
+	}
+	return true, nil
+}
+
+// CompleteWebhookEvent marks a claimed webhook event as processed, or removes
+// the claim when processing failed so that the provider's retry is handled.
+func CompleteWebhookEvent(provider string, eventId string, processed bool) {
+	db, col, err := mongoSetup.ConnectMongo("webhookEvents")
+	if err != nil {
+		fmt.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"provider": provider, "eventId": eventId}
+	if processed {
+		_, err = col.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"processedAt": time.Now().Unix()}})
+	} else {
+		_, err = col.DeleteOne(ctx, filter)
+	}
+	if err != nil {
+		fmt.Println("Error completing webhook event:", err)
+	}
+}
+
+// MarkPaymentFailed records a failed payment attempt of an order. The
+// registrations stay pending so the user can retry the payment.
+func MarkPaymentFailed(event paymentModel.ProviderWebhookEvent) error {
+	db, col, err := mongoSetup.ConnectMongo("paymentDetails")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A late failure notification never overrides a captured payment
+	filter := bson.M{"orderId": event.OrderID, "paymentId": event.PaymentID}
+	recorded, err := col.CountDocuments(ctx, bson.M{"orderId": event.OrderID, "paymentId": event.PaymentID, "status": bson.M{"$ne": PaymentStatusFailed}})
+	if err != nil {
+		return fmt.Errorf("failed to fetch payment: %w", err)
+	}
+	if recorded > 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	_, err = col.UpdateOne(ctx,
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"status":           PaymentStatusFailed,
+				"amount":           event.Amount,
+				"currency":         event.Currency,
+				"errorCode":        event.ErrorCode,
+				"errorDescription": event.ErrorDescription,
+				"updatedAt":        now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save failed payment: %w", err)
+	}
+
+	// The order stays payable until it expires
+	order, err := TransitionOrder(event.OrderID, OrderStatusFailed, event.ErrorDescription, nil)
+	if err != nil && err != ErrInvalidOrderTransition && err != ErrOrderNotFound {
+		return err
+	}
+	if err == nil {
+		notifyutils.NotifyPaymentFailed(order, event.PaymentID, event.ErrorDescription)
+	}
+	return nil
+}
+
+// RecordRefund adds a refund to a captured payment, once per refund id. When
+// the payment is fully refunded the order is marked refunded and its
+// registrations are closed.
+func RecordRefund(event paymentModel.ProviderWebhookEvent) error {
+	db, col, err := mongoSetup.ConnectMongo("paymentDetails")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = col.UpdateOne(ctx,
+		bson.M{"paymentId": event.PaymentID, "status": bson.M{"$in": bson.A{PaymentStatusCaptured, PaymentStatusPartiallyRefunded}}, "refundIds": bson.M{"$ne": event.RefundID}},
+		bson.M{
+			"$inc":  bson.M{"refundedAmount": event.Amount},
+			"$push": bson.M{"refundIds": event.RefundID},
+			"$set":  bson.M{"updatedAt": time.Now().Unix()},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	var payment paymentModel.PaymentDetails
+	if err := col.FindOne(ctx, bson.M{"paymentId": event.PaymentID}).Decode(&payment); err != nil {
+		return fmt.Errorf("payment %s not found: %w", event.PaymentID, err)
+	}
+	if err := ledgerutils.RecordRefund(payment.OrderID, event.RefundID, event.Amount); err != nil {
+		log.Printf("Failed to record refund %s in the ledger: %v", event.RefundID, err)
+	}
+	status := PaymentStatusPartiallyRefunded
+	if payment.RefundedAmount >= payment.Amount {
+		status = PaymentStatusRefunded
+	}
+	if _, err := col.UpdateOne(ctx, bson.M{"paymentId": event.PaymentID}, bson.M{"$set": bson.M{"status": status}}); err != nil {
+		return fmt.Errorf("failed to update payment status: %w", err)
+	}
+	if status != PaymentStatusRefunded {
+		return nil
+	}
+
+	// A fully refunded order no longer holds any tickets
+	ordersCol := db.Collection("orderDetails")
+	var order paymentModel.OrderDetails
+	if err := ordersCol.FindOne(ctx, bson.M{"orderId": payment.OrderID}).Decode(&order); err != nil {
+		return fmt.Errorf("order %s not found: %w", payment.OrderID, err)
+	}
+	if _, err := TransitionOrder(order.OrderID, OrderStatusRefunded, "", nil); err != nil && err != ErrInvalidOrderTransition {
+		return err
+	}
+	if _, err := eventutils.CloseRegistrations(bson.M{"orderId": order.OrderID}, eventutils.RegistrationStatusRefunded); err != nil {
+		return err
+	}
+	return nil
+}
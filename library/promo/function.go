@@ -0,0 +1,275 @@
+package promoutils
+
+import (
+	"context"
+	mongoSetup "em_backend/configs/mongo"
+	currencyutils "em_backend/library/currency"
+	promoModel "em_backend/models/promo"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	StatusActive   = "active"
+	StatusInactive = "inactive"
+)
+
+var (
+	ErrPromoNotFound      = errors.New("promo code not found")
+	ErrPromoInactive      = errors.New("promo code is not active")
+	ErrPromoNotStarted    = errors.New("promo code is not valid yet")
+	ErrPromoExpired       = errors.New("promo code has expired")
+	ErrPromoWrongEvent    = errors.New("promo code is not valid for this event")
+	ErrPromoWrongTicket   = errors.New("promo code is not valid for this ticket type")
+	ErrPromoExhausted     = errors.New("promo code usage limit reached")
+	ErrPromoUserLimitHit  = errors.New("promo code already used the maximum number of times")
+	ErrPromoWrongCurrency = errors.New("promo code is not valid for this currency")
+)
+
+// NormaliseCode makes promo code lookups case and whitespace insensitive.
+func NormaliseCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidatePromoDefinition checks a promo code before it is stored.
+func ValidatePromoDefinition(promo *promoModel.PromoCode) error {
+	promo.Code = NormaliseCode(promo.Code)
+	if promo.Code == "" {
+		return fmt.Errorf("promo code is required")
+	}
+	switch promo.DiscountType {
+	case promoModel.DiscountTypePercentage:
+		if promo.DiscountValue <= 0 || promo.DiscountValue > 100 {
+			return fmt.Errorf("percentage discount must be between 0 and 100")
+		}
+		promo.DiscountAmount = 0
+		promo.Currency = ""
+	case promoModel.DiscountTypeFixed:
+		if promo.DiscountAmount <= 0 {
+			return fmt.Errorf("fixed discount must be greater than 0")
+		}
+		currency, err := currencyutils.Normalise(promo.Currency)
+		if err != nil {
+			return fmt.Errorf("fixed discount needs a currency: %w", err)
+		}
+		promo.Currency = currency
+		promo.DiscountValue = 0
+	default:
+		return fmt.Errorf("discount type must be '%s' or '%s'", promoModel.DiscountTypePercentage, promoModel.DiscountTypeFixed)
+	}
+	if promo.MaxUses < 0 || promo.PerUserLimit < 0 {
+		return fmt.Errorf("usage limits cannot be negative")
+	}
+	if promo.ValidFrom > 0 && promo.ValidUntil > 0 && promo.ValidUntil <= promo.ValidFrom {
+		return fmt.Errorf("promo code validity ends before it starts")
+	}
+	if promo.Status == "" {
+		promo.Status = StatusActive
+	}
+	return nil
+}
+
+// FetchPromoCode loads a promo code by its code.
+func FetchPromoCode(code string) (promoModel.PromoCode, error) {
+	var promo promoModel.PromoCode
+	result, err := mongoSetup.FindOneDoc("promoCodes", bson.M{"code": NormaliseCode(code)}, bson.M{})
+	if err != nil {
+		return promo, err
+	}
+	if err := result.Decode(&promo); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return promo, ErrPromoNotFound
+		}
+		return promo, err
+	}
+	return promo, nil
+}
+
+// ValidatePromoCode checks that a promo code can be applied by a user to a
+// ticket type of an event right now.
+func ValidatePromoCode(code string, eventId string, ticketTypeId string, userEmail string) (promoModel.PromoCode, error) {
+	promo, err := FetchPromoCode(code)
+	if err != nil {
+		return promo, err
+	}
+
+	now := time.Now().Unix()
+	if promo.Status != StatusActive {
+		return promo, ErrPromoInactive
+	}
+	if promo.ValidFrom > 0 && now < promo.ValidFrom {
+		return promo, ErrPromoNotStarted
+	}
+	if promo.ValidUntil > 0 && now > promo.ValidUntil {
+		return promo, ErrPromoExpired
+	}
+	if promo.EventId != "" && promo.EventId != eventId {
+		return promo, ErrPromoWrongEvent
+	}
+	if len(promo.TicketTypeIds) > 0 {
+		allowed := false
+		for _, id := range promo.TicketTypeIds {
+			if id == ticketTypeId {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return promo, ErrPromoWrongTicket
+		}
+	}
+	if promo.MaxUses > 0 && promo.UsedCount >= promo.MaxUses {
+		return promo, ErrPromoExhausted
+	}
+	if promo.PerUserLimit > 0 {
+		used, err := countUserRedemptions(promo.Code, userEmail)
+		if err != nil {
+			return promo, err
+		}
+		if used >= int64(promo.PerUserLimit) {
+			return promo, ErrPromoUserLimitHit
+		}
+	}
+	return promo, nil
+}
+
+// ComputeDiscount returns the discount of a promo code on an amount in minor
+// units of currency. Fixed discounts only apply to orders in the currency
+// they were set in. The discount never exceeds the amount.
+func ComputeDiscount(promo promoModel.PromoCode, amount int64, currency string) (int64, error) {
+	var discount int64
+	switch promo.DiscountType {
+	case promoModel.DiscountTypePercentage:
+		discount = int64(math.Round(float64(amount) * promo.DiscountValue / 100))
+	case promoModel.DiscountTypeFixed:
+		if !strings.EqualFold(promo.Currency, currency) {
+			return 0, ErrPromoWrongCurrency
+		}
+		discount = promo.DiscountAmount
+	}
+	if discount > amount {
+		discount = amount
+	}
+	if discount < 0 {
+		discount = 0
+	}
+	return discount, nil
+}
+
+// RedeemPromoCode consumes one use of a promo code and records the
+// redemption. The usage cap and the per-user limit are enforced atomically so
+// concurrent orders cannot exceed them.
+func RedeemPromoCode(promo promoModel.PromoCode, redemption promoModel.PromoRedemption) error {
+	db, col, err := mongoSetup.ConnectMongo("promoCodes")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Count the use against the user first; a user at the limit matches
+	// nothing and the upsert then fails on the unique index
+	userUses := db.Collection("promoUserRedemptions")
+	userFilter := bson.M{"code": promo.Code, "userEmail": redemption.UserEmail}
+	if promo.PerUserLimit > 0 {
+		_, err := userUses.UpdateOne(ctx,
+			bson.M{"code": promo.Code, "userEmail": redemption.UserEmail, "count": bson.M{"$lt": promo.PerUserLimit}},
+			bson.M{"$inc": bson.M{"count": 1}},
+			options.Update().SetUpsert(true),
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrPromoUserLimitHit
+		}
+		if err != nil {
+			return fmt.Errorf("failed to redeem promo code: %w", err)
+		}
+	}
+	releaseUserUse := func() {
+		if promo.PerUserLimit > 0 {
+			userUses.UpdateOne(ctx, userFilter, bson.M{"$inc": bson.M{"count": -1}})
+		}
+	}
+
+	filter := bson.M{"code": promo.Code, "status": StatusActive}
+	if promo.MaxUses > 0 {
+		filter["usedCount"] = bson.M{"$lt": promo.MaxUses}
+	}
+	result, err := col.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"usedCount": 1}})
+	if err != nil {
+		releaseUserUse()
+		return fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+	if result.ModifiedCount == 0 {
+		releaseUserUse()
+		return ErrPromoExhausted
+	}
+
+	redemption.RedemptionId = uuid.New().String()
+	redemption.Code = promo.Code
+	redemption.RedeemedAt = time.Now().Unix()
+	if _, err := db.Collection("promoRedemptions").InsertOne(ctx, redemption); err != nil {
+		col.UpdateOne(ctx, bson.M{"code": promo.Code}, bson.M{"$inc": bson.M{"usedCount": -1}})
+		releaseUserUse()
+		return fmt.Errorf("failed to record promo redemption: %w", err)
+	}
+	return nil
+}
+
+func countUserRedemptions(code string, userEmail string) (int64, error) {
+	db, col, err := mongoSetup.ConnectMongo("promoRedemptions")
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return col.CountDocuments(ctx, bson.M{"code": code, "userEmail": userEmail})
+}
+
+// ReleasePromoRedemption gives back the use of a promo code taken by an order
+// that was never paid.
+func ReleasePromoRedemption(orderId string) error {
+	db, col, err := mongoSetup.ConnectMongo("promoRedemptions")
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var redemption promoModel.PromoRedemption
+	if err := col.FindOneAndDelete(ctx, bson.M{"orderId": orderId}).Decode(&redemption); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return fmt.Errorf("failed to release promo redemption: %w", err)
+	}
+	_, err = db.Collection("promoCodes").UpdateOne(ctx,
+		bson.M{"code": redemption.Code, "usedCount": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"usedCount": -1}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release promo code use: %w", err)
+	}
+	_, err = db.Collection("promoUserRedemptions").UpdateOne(ctx,
+		bson.M{"code": redemption.Code, "userEmail": redemption.UserEmail, "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release promo code use: %w", err)
+	}
+	return nil
+}
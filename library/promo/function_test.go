@@ -0,0 +1,44 @@
+package promoutils
+
+import (
+	promoModel "em_backend/models/promo"
+	"errors"
+	"testing"
+)
+
+func TestComputeDiscount(t *testing.T) {
+	percent := func(value float64) promoModel.PromoCode {
+		return promoModel.PromoCode{DiscountType: promoModel.DiscountTypePercentage, DiscountValue: value}
+	}
+	fixed := func(amount int64, currency string) promoModel.PromoCode {
+		return promoModel.PromoCode{DiscountType: promoModel.DiscountTypeFixed, DiscountAmount: amount, Currency: currency}
+	}
+	tests := []struct {
+		name     string
+		promo    promoModel.PromoCode
+		amount   int64
+		currency string
+		want     int64
+		wantErr  error
+	}{
+		{"percentage", percent(10), 50000, "INR", 5000, nil},
+		{"percentage rounds to the nearest minor unit", percent(15), 999, "INR", 150, nil},
+		{"percentage in any currency", percent(25), 2000, "USD", 500, nil},
+		{"full percentage", percent(100), 1234, "INR", 1234, nil},
+		{"fixed", fixed(10000, "INR"), 50000, "INR", 10000, nil},
+		{"fixed currency is case insensitive", fixed(500, "USD"), 2000, "usd", 500, nil},
+		{"fixed never exceeds the amount", fixed(10000, "INR"), 4000, "INR", 4000, nil},
+		{"fixed in another currency", fixed(10000, "INR"), 50000, "USD", 0, ErrPromoWrongCurrency},
+		{"unknown type", promoModel.PromoCode{DiscountType: "bogus"}, 50000, "INR", 0, nil},
+	}
+	for _, test := range tests {
+		got, err := ComputeDiscount(test.promo, test.amount, test.currency)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: ComputeDiscount error = %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: ComputeDiscount = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package webhookutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	mongoSetup "em_backend/configs/mongo"
+	eventutils "em_backend/library/events"
+	notifyutils "em_backend/library/notification"
+	notificationModel "em_backend/models/notification"
+	webhookModel "em_backend/models/webhook"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JobWebhookDelivery = "webhook_delivery"
+
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusRetrying  = "retrying"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+
+	deliveriesCollection = "webhookDeliveries"
+
+	// Headers of every delivery
+	HeaderEvent     = "X-Stuni-Event"
+	HeaderDelivery  = "X-Stuni-Delivery"
+	HeaderSignature = "X-Stuni-Signature"
+
+	deliveryTimeout     = 10 * time.Second
+	maxRecordedAttempts = 20
+	maxRecordedResponse = 1024
+)
+
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+var deliveryClient = &http.Client{Timeout: deliveryTimeout}
+
+// Deliveries are retried with the backoff of the notification queue
+func init() {
+	notifyutils.RegisterJobHandler(JobWebhookDelivery, deliver)
+}
+
+// Sign returns the signature header of a delivery: the Unix time it was
+// sent and the hex HMAC-SHA256 of "<time>.<body>" with the webhook secret,
+// as "t=<time>,v1=<signature>". Receivers should recompute it and reject old
+// timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(h.Sum(nil)))
+}
+
+// Publish sends a platform event about an event to every active webhook
+// subscribed to it, of the event itself or of its organizer. Deliveries are
+// queued, so a slow or failing endpoint never holds up the caller; failures
+// are only logged.
+func Publish(eventType string, eventId string, data interface{}) {
+	if err := publish(eventType, eventId, data); err != nil {
+		log.Printf("Failed to publish %s of event %s to webhooks: %v", eventType, eventId, err)
+	}
+}
+
+func publish(eventType string, eventId string, data interface{}) error {
+	scope := bson.A{bson.M{"eventId": eventId}}
+	if event, err := eventutils.FetchEvent(eventId); err == nil && event.OrganizerId != "" {
+		scope = append(scope, bson.M{"organizerId": event.OrganizerId})
+	}
+
+	db, col, err := mongoSetup.ConnectMongo(webhooksCollection)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, bson.M{"active": true, "events": eventType, "$or": scope})
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+	var webhooks []webhookModel.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	envelope := webhookModel.Envelope{
+		Id:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now().Unix(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	deliveries := db.Collection(deliveriesCollection)
+	for _, webhook := range webhooks {
+		delivery := webhookModel.WebhookDelivery{
+			DeliveryId: uuid.New().String(),
+			WebhookId:  webhook.WebhookId,
+			MessageId:  envelope.Id,
+			Type:       eventType,
+			EventId:    eventId,
+			URL:        webhook.URL,
+			Payload:    string(payload),
+			Status:     DeliveryStatusPending,
+			CreatedAt:  time.Now().Unix(),
+		}
+		if err := queueDelivery(ctx, deliveries, delivery); err != nil {
+			log.Printf("Failed to queue %s for webhook %s: %v", eventType, webhook.WebhookId, err)
+		}
+	}
+	return nil
+}
+
+func queueDelivery(ctx context.Context, deliveries *mongo.Collection, delivery webhookModel.WebhookDelivery) error {
+	if _, err := deliveries.InsertOne(ctx, delivery); err != nil {
+		return fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+	return notifyutils.Enqueue(JobWebhookDelivery, notificationModel.NotificationPayload{
+		DeliveryId: delivery.DeliveryId,
+		EventId:    delivery.EventId,
+	}, JobWebhookDelivery+":"+delivery.DeliveryId)
+}
+
+// deliver makes one attempt to post a delivery to its webhook and logs the
+// response. Any status other than 2xx is retried, except 410 Gone.
+func deliver(job notificationModel.NotificationJob) error {
+	db, col, err := mongoSetup.ConnectMongo(deliveriesCollection)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var delivery webhookModel.WebhookDelivery
+	err = col.FindOne(ctx, bson.M{"deliveryId": job.Payload.DeliveryId}).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return notifyutils.PermanentError{Err: ErrDeliveryNotFound}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhook delivery: %w", err)
+	}
+
+	webhook, err := fetchWebhook(delivery.WebhookId)
+	if err != nil || !webhook.Active {
+		if err == nil || errors.Is(err, ErrWebhookNotFound) {
+			err = notifyutils.PermanentError{Err: errors.New("webhook was deleted or deactivated")}
+			recordAttempt(ctx, col, delivery, webhookModel.DeliveryAttempt{At: time.Now().Unix(), Error: err.Error()}, true, false)
+		}
+		return err
+	}
+
+	attempt, deliveryErr := post(webhook, delivery)
+	var permanentErr notifyutils.PermanentError
+	final := deliveryErr == nil || errors.As(deliveryErr, &permanentErr) || job.Attempts >= job.MaxAttempts
+	recordAttempt(ctx, col, delivery, attempt, final, deliveryErr == nil)
+	return deliveryErr
+}
+
+func post(webhook webhookModel.Webhook, delivery webhookModel.WebhookDelivery) (webhookModel.DeliveryAttempt, error) {
+	started := time.Now()
+	attempt := webhookModel.DeliveryAttempt{At: started.Unix()}
+
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, notifyutils.PermanentError{Err: err}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "STUNI-Webhooks/1.0")
+	request.Header.Set(HeaderEvent, delivery.Type)
+	request.Header.Set(HeaderDelivery, delivery.DeliveryId)
+	request.Header.Set(HeaderSignature, Sign(webhook.Secret, started.Unix(), body))
+
+	response, err := deliveryClient.Do(request)
+	attempt.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, maxRecordedResponse))
+	attempt.StatusCode = response.StatusCode
+	attempt.Response = string(responseBody)
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return attempt, nil
+	case response.StatusCode == http.StatusGone:
+		attempt.Error = "endpoint is gone"
+		return attempt, notifyutils.PermanentError{Err: errors.New(attempt.Error)}
+	default:
+		attempt.Error = fmt.Sprintf("endpoint returned %d", response.StatusCode)
+		return attempt, errors.New(attempt.Error)
+	}
+}
+
+// recordAttempt adds an attempt to the delivery log and updates its status.
+func recordAttempt(ctx context.Context, col *mongo.Collection, delivery webhookModel.WebhookDelivery, attempt webhookModel.DeliveryAttempt, final bool, succeeded bool) {
+	status := DeliveryStatusRetrying
+	set := bson.M{}
+	switch {
+	case succeeded:
+		status = DeliveryStatusSucceeded
+		set["deliveredAt"] = attempt.At
+	case final:
+		status = DeliveryStatusFailed
+	}
+	set["status"] = status
+
+	_, err := col.UpdateOne(ctx, bson.M{"deliveryId": delivery.DeliveryId}, bson.M{
+		"$set":  set,
+		"$push": bson.M{"attempts": bson.M{"$each": bson.A{attempt}, "$slice": -maxRecordedAttempts}},
+	})
+	if err != nil {
+		log.Printf("Failed to log attempt of webhook delivery %s: %v", delivery.DeliveryId, err)
+	}
+}
+
+// ListDeliveries returns the latest deliveries, of one webhook when set.
+func ListDeliveries(request webhookModel.DeliveryListReq) ([]webhookModel.WebhookDelivery, error) {
+	filter := bson.M{}
+	if request.WebhookId != "" {
+		filter["webhookId"] = request.WebhookId
+	}
+	if request.Status != "" {
+		filter["status"] = request.Status
+	}
+	if request.Type != "" {
+		filter["type"] = request.Type
+	}
+
+	db, col, err := mongoSetup.ConnectMongo(deliveriesCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(100))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+	}
+	deliveries := []webhookModel.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Redeliver sends a delivery again as a new delivery with the same payload,
+// signed with the webhook's current secret.
+func Redeliver(deliveryId string, requestedBy string) (webhookModel.WebhookDelivery, error) {
+	var delivery webhookModel.WebhookDelivery
+
+	db, col, err := mongoSetup.ConnectMongo(deliveriesCollection)
+	if err != nil {
+		return delivery, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var original webhookModel.WebhookDelivery
+	err = col.FindOne(ctx, bson.M{"deliveryId": deliveryId}).Decode(&original)
+	if err == mongo.ErrNoDocuments {
+		return delivery, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return delivery, fmt.Errorf("failed to fetch webhook delivery: %w", err)
+	}
+	webhook, err := fetchWebhook(original.WebhookId)
+	if err != nil {
+		return delivery, err
+	}
+
+	delivery = webhookModel.WebhookDelivery{
+		DeliveryId:   uuid.New().String(),
+		WebhookId:    webhook.WebhookId,
+		MessageId:    original.MessageId,
+		Type:         original.Type,
+		EventId:      original.EventId,
+		URL:          webhook.URL,
+		Payload:      original.Payload,
+		Status:       DeliveryStatusPending,
+		RedeliveryOf: original.DeliveryId,
+		RequestedBy:  requestedBy,
+		CreatedAt:    time.Now().Unix(),
+	}
+	if err := queueDelivery(ctx, col, delivery); err != nil {
+		return delivery, err
+	}
+	return delivery, nil
+}
@@ -0,0 +1,54 @@
+package webhookutils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// verify checks a signature the way receivers are told to
+func verify(secret string, header string, body []byte) bool {
+	timestamp, signature, found := strings.Cut(header, ",v1=")
+	if !found || !strings.HasPrefix(timestamp, "t=") {
+		return false
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strings.TrimPrefix(timestamp, "t=") + "."))
+	h.Write(body)
+	return hmac.Equal([]byte(hex.EncodeToString(h.Sum(nil))), []byte(signature))
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"registration.confirmed","data":{"registrationId":"r1"}}`)
+	signed := Sign("whsec_test", 1700000000, body)
+
+	if !strings.HasPrefix(signed, "t=1700000000,v1=") {
+		t.Fatalf("Sign() = %q, want it to start with the timestamp", signed)
+	}
+	if signed != Sign("whsec_test", 1700000000, body) {
+		t.Errorf("Sign() is not deterministic")
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		want   bool
+	}{
+		{"valid", "whsec_test", signed, body, true},
+		{"wrong secret", "whsec_other", signed, body, false},
+		{"tampered body", "whsec_test", signed, []byte(`{"type":"registration.cancelled"}`), false},
+		{"other timestamp", "whsec_test", strings.Replace(signed, "t=1700000000", "t=1700000001", 1), body, false},
+		{"signed with another timestamp", "whsec_test", Sign("whsec_test", 1700000001, body), body, true},
+		{"missing signature", "whsec_test", "t=1700000000", body, false},
+		{"empty header", "whsec_test", "", body, false},
+	}
+	for _, test := range tests {
+		if got := verify(test.secret, test.header, test.body); got != test.want {
+			t.Errorf("%s: verify() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package webhookutils
+
+import (
+	dbModel "em_backend/models/db"
+	notificationModel "em_backend/models/notification"
+	paymentModel "em_backend/models/payment"
+	webhookModel "em_backend/models/webhook"
+	"time"
+)
+
+// PublishRegistrationCreated publishes registration.created for each new
+// registration, confirmed or waiting for payment.
+func PublishRegistrationCreated(registrations ...dbModel.RegistrationData) {
+	for _, registration := range registrations {
+		Publish(EventRegistrationCreated, registration.UniqueId, webhookModel.RegistrationData{
+			RegistrationId: registration.RegistrationId,
+			EventId:        registration.UniqueId,
+			TicketTypeId:   registration.TicketTypeId,
+			TicketTypeName: registration.TicketTypeName,
+			PrimaryEmailId: registration.PrimaryEmailId,
+			AttendeeName:   registration.AttendeeName,
+			AttendeeEmail:  registration.AttendeeEmail,
+			GroupOrderId:   registration.GroupOrderId,
+			Status:         registration.Status,
+			RegisteredAt:   registration.RegisteredAt,
+		})
+	}
+}
+
+// PublishPaymentCaptured publishes payment.captured for a paid order.
+func PublishPaymentCaptured(order paymentModel.OrderDetails) {
+	Publish(EventPaymentCaptured, order.EventId, webhookModel.PaymentData{
+		OrderId:     order.OrderID,
+		PaymentId:   order.PaymentId,
+		EventId:     order.EventId,
+		UserEmail:   order.UserEmail,
+		TicketCount: order.TicketCount,
+		Amount:      order.Amount,
+		Currency:    order.Currency,
+		PaidAt:      order.PaidAt,
+	})
+}
+
+// PublishCheckinCompleted publishes checkin.completed for a verified ticket.
+func PublishCheckinCompleted(eventId string, registrationId string, primaryEmailId string) {
+	Publish(EventCheckinCompleted, eventId, webhookModel.CheckinData{
+		RegistrationId: registrationId,
+		EventId:        eventId,
+		PrimaryEmailId: primaryEmailId,
+		CheckedInAt:    time.Now().Unix(),
+	})
+}
+
+// PublishEventUpdated publishes event.updated with the changes attendees
+// were told about, if any.
+func PublishEventUpdated(event dbModel.Event, changes []notificationModel.EventChange) {
+	data := webhookModel.EventData{
+		EventId:       event.UniqueId,
+		EventName:     event.EventName,
+		EventDate:     event.EventDate,
+		EventLocation: event.EventLocation,
+		EventMode:     event.EventMode,
+		Status:        event.Status,
+		Changes:       []webhookModel.EventChange{},
+	}
+	for _, change := range changes {
+		data.Changes = append(data.Changes, webhookModel.EventChange{Field: change.Field, Old: change.Old, New: change.New})
+	}
+	Publish(EventEventUpdated, event.UniqueId, data)
+}
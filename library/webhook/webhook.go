@@ -0,0 +1,267 @@
+package webhookutils
+
+import (
+	"context"
+	"crypto/rand"
+	mongoSetup "em_backend/configs/mongo"
+	commonutils "em_backend/library/common"
+	eventutils "em_backend/library/events"
+	invoiceutils "em_backend/library/invoice"
+	webhookModel "em_backend/models/webhook"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Platform events webhooks can subscribe to
+const (
+	EventRegistrationCreated = "registration.created"
+	EventPaymentCaptured     = "payment.captured"
+	EventCheckinCompleted    = "checkin.completed"
+	EventEventUpdated        = "event.updated"
+)
+
+const webhooksCollection = "webhooks"
+
+var (
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+// EventTypes lists the platform events webhooks can subscribe to.
+var EventTypes = []string{
+	EventRegistrationCreated,
+	EventPaymentCaptured,
+	EventCheckinCompleted,
+	EventEventUpdated,
+}
+
+// validateWebhook checks a webhook request and normalises its event list.
+// Webhooks must use https, unless WEBHOOK_ALLOW_HTTP is set for local
+// development.
+func validateWebhook(request *webhookModel.WebhookReq, creating bool) error {
+	if creating {
+		if (request.OrganizerId == "") == (request.EventId == "") {
+			return fmt.Errorf("%w: set either an organizer ID or an event ID", ErrInvalidWebhook)
+		}
+		if request.EventId != "" {
+			if _, err := eventutils.FetchEvent(request.EventId); err != nil {
+				return fmt.Errorf("%w: event not found", ErrInvalidWebhook)
+			}
+		}
+		if request.OrganizerId != "" {
+			if _, err := invoiceutils.FetchOrganizer(request.OrganizerId); err != nil {
+				return fmt.Errorf("%w: organizer not found", ErrInvalidWebhook)
+			}
+		}
+	}
+
+	if creating || request.URL != "" {
+		request.URL = strings.TrimSpace(request.URL)
+		endpoint, err := url.Parse(request.URL)
+		if err != nil || endpoint.Host == "" {
+			return fmt.Errorf("%w: URL is invalid", ErrInvalidWebhook)
+		}
+		allowHTTP := commonutils.LoadEnv("WEBHOOK_ALLOW_HTTP") == "true"
+		if endpoint.Scheme != "https" && !(allowHTTP && endpoint.Scheme == "http") {
+			return fmt.Errorf("%w: URL must use https", ErrInvalidWebhook)
+		}
+	}
+
+	if creating || request.Events != nil {
+		known := map[string]bool{}
+		for _, eventType := range EventTypes {
+			known[eventType] = true
+		}
+		seen := map[string]bool{}
+		events := []string{}
+		for _, eventType := range request.Events {
+			eventType = strings.TrimSpace(eventType)
+			if !known[eventType] {
+				return fmt.Errorf("%w: unknown event '%s'", ErrInvalidWebhook, eventType)
+			}
+			if !seen[eventType] {
+				seen[eventType] = true
+				events = append(events, eventType)
+			}
+		}
+		if len(events) == 0 {
+			return fmt.Errorf("%w: subscribe to at least one event", ErrInvalidWebhook)
+		}
+		sort.Strings(events)
+		request.Events = events
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// CreateWebhook registers a webhook. The returned webhook carries its
+// signing secret, which is not shown again.
+func CreateWebhook(request webhookModel.WebhookReq, createdBy string) (webhookModel.Webhook, error) {
+	var webhook webhookModel.Webhook
+	if err := validateWebhook(&request, true); err != nil {
+		return webhook, err
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return webhook, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	now := time.Now().Unix()
+	webhook = webhookModel.Webhook{
+		WebhookId:   uuid.New().String(),
+		OrganizerId: request.OrganizerId,
+		EventId:     request.EventId,
+		URL:         request.URL,
+		Events:      request.Events,
+		Description: strings.TrimSpace(request.Description),
+		Secret:      secret,
+		Active:      true,
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	db, col, err := mongoSetup.ConnectMongo(webhooksCollection)
+	if err != nil {
+		return webhook, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := col.InsertOne(ctx, webhook); err != nil {
+		return webhook, fmt.Errorf("failed to save webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// UpdateWebhook changes the URL, events, description or active flag of a
+// webhook. Its scope and secret stay the same.
+func UpdateWebhook(request webhookModel.WebhookReq) (webhookModel.Webhook, error) {
+	var webhook webhookModel.Webhook
+	if err := validateWebhook(&request, false); err != nil {
+		return webhook, err
+	}
+
+	set := bson.M{"updatedAt": time.Now().Unix()}
+	if request.URL != "" {
+		set["url"] = request.URL
+	}
+	if request.Events != nil {
+		set["events"] = request.Events
+	}
+	if request.Description != "" {
+		set["description"] = strings.TrimSpace(request.Description)
+	}
+	if request.Active != nil {
+		set["active"] = *request.Active
+	}
+
+	db, col, err := mongoSetup.ConnectMongo(webhooksCollection)
+	if err != nil {
+		return webhook, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = col.FindOneAndUpdate(ctx, bson.M{"webhookId": request.WebhookId}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return webhook, ErrWebhookNotFound
+	}
+	if err != nil {
+		return webhook, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook. Its delivery log is kept, deliveries
+// still queued for it are dropped.
+func DeleteWebhook(webhookId string) error {
+	db, col, err := mongoSetup.ConnectMongo(webhooksCollection)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := col.DeleteOne(ctx, bson.M{"webhookId": webhookId})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListWebhooks returns the webhooks of an organizer or event, or all of
+// them, without their secrets.
+func ListWebhooks(request webhookModel.WebhookListReq) ([]webhookModel.Webhook, error) {
+	filter := bson.M{}
+	if request.OrganizerId != "" {
+		filter["organizerId"] = request.OrganizerId
+	}
+	if request.EventId != "" {
+		filter["eventId"] = request.EventId
+	}
+
+	db, col, err := mongoSetup.ConnectMongo(webhooksCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer db.Client().Disconnect(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(ctx, filter, options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetProjection(bson.M{"secret": 0}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+	webhooks := []webhookModel.Webhook{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+func fetchWebhook(webhookId string) (webhookModel.Webhook, error) {
+	var webhook webhookModel.Webhook
+	result, err := mongoSetup.FindOneDoc(webhooksCollection, bson.M{"webhookId": webhookId}, bson.M{})
+	if err != nil {
+		return webhook, err
+	}
+	if err := result.Decode(&webhook); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return webhook, ErrWebhookNotFound
+		}
+		return webhook, err
+	}
+	return webhook, nil
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	mongoSetup "em_backend/configs/mongo"
+	eventutils "em_backend/library/events"
+	notifyutils "em_backend/library/notification"
+	paymentutils "em_backend/library/payment"
 	"em_backend/routes"
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -25,6 +31,33 @@ func main() {
 	routes.AdminPanel(app)
 	routes.EventPanel(app)
 	routes.PaymentPanel(app)
+	routes.MailPanel(app)
+
+	// Indexes guard against duplicate registrations, orders and webhooks;
+	// serving without a unique one would silently accept duplicates
+	if err := mongoSetup.EnsureIndexes(); err != nil {
+		if errors.Is(err, mongoSetup.ErrUniqueIndexMissing) {
+			log.Fatal("Error ensuring MongoDB indexes: ", err)
+		}
+		fmt.Println("Error ensuring MongoDB indexes:", err)
+	}
+
+	// Events used to be priced with combo prices
+	if err := eventutils.MigrateComboPrices(); err != nil {
+		fmt.Println("Error migrating combo prices:", err)
+	}
+	// Registrations used to have no status
+	if err := eventutils.MigrateRegistrationStatus(); err != nil {
+		fmt.Println("Error migrating registration status:", err)
+	}
+
+	// Expire unpaid orders and release their seats in the background
+	go paymentutils.StartOrderSweeper()
+
+	// Deliver queued emails and other notifications
+	go notifyutils.StartNotificationWorker()
+	// Queue event reminders as they fall due
+	go notifyutils.StartReminderScheduler()
 
 	// Start the server
 	fmt.Println(app.Listen(":3001"))
@@ -0,0 +1,23 @@
+package currencyModel
+
+// ExchangeRate is how many units of Currency one unit of the base currency
+// buys. Rates are set by admins and only used to show approximate prices;
+// payments are always taken in the ticket currency.
+type ExchangeRate struct {
+	Currency  string  `json:"currency" bson:"currency"`
+	Rate      float64 `json:"rate" bson:"rate"`
+	UpdatedBy string  `json:"updatedBy,omitempty" bson:"updatedBy"`
+	UpdatedAt int64   `json:"updatedAt" bson:"updatedAt"`
+}
+
+// ExchangeRatesRequest replaces the rates of the given currencies against the
+// base currency.
+type ExchangeRatesRequest struct {
+	Rates map[string]float64 `json:"rates"`
+}
+
+// ExchangeRates is the rate table with the base currency it is quoted in.
+type ExchangeRates struct {
+	Base  string         `json:"base"`
+	Rates []ExchangeRate `json:"rates"`
+}
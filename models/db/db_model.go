@@ -1,40 +1,134 @@
 package db_model
 
+import notificationModel "em_backend/models/notification"
+
 type UserData struct {
 	UserName  string `json:"userName" bson:"userName"`
 	Email     string `json:"email"`
 	Password  string `json:"password"`
 	UserHash  string `json:"userHash" bson:"userHash"`
+	Locale    string `json:"locale,omitempty" bson:"locale,omitempty"`
 	CreatedAt int64  `json:"createdAt" bson:"createdAt"`
+
+	// Phone is in E.164 format and only set once verified
+	Phone           string `json:"phone,omitempty" bson:"phone,omitempty"`
+	PhoneVerified   bool   `json:"phoneVerified,omitempty" bson:"phoneVerified,omitempty"`
+	PhoneVerifiedAt int64  `json:"phoneVerifiedAt,omitempty" bson:"phoneVerifiedAt,omitempty"`
+
+	NotificationPreferences notificationModel.NotificationPreferences `json:"notificationPreferences" bson:"notificationPreferences"`
+
+	// CalendarToken is the secret in the URL of the user's calendar feed
+	CalendarToken string `json:"-" bson:"calendarToken,omitempty"`
 }
 
 type Event struct {
-	UniqueId                  string                   `json:"uniqueId,omitempty" bson:"uniqueId"`
-	EventName                 string                   `json:"eventName" bson:"eventName"`
-	Category                  string                   `json:"category" bson:"category"`
-	EventDescription          string                   `json:"eventDescription" bson:"eventDescription"`
-	EventType                 string                   `json:"eventType" bson:"eventType"`
-	EventMode                 string                   `json:"eventMode" bson:"eventMode"`
-	EventLocation             string                   `json:"eventLocation,omitempty" bson:"eventLocation"`
-	EventDate                 int64                    `json:"eventDate" bson:"eventDate"`
-	FlierImage                string                   `json:"flierImage" bson:"flierImage"`
-	PaymentType               string                   `json:"paymentType" bson:"paymentType"`
-	ComboPrices               RegistrationPricingCombo `json:"comboPrices,omitempty" bson:"comboPrices"`
-	ParticipationGuidelines   string                   `json:"participationGuidelines,omitempty" bson:"participationGuidelines"`
-	RegistrationDetailsFormId string                   `json:"registrationDetailsFormId,omitempty" bson:"registrationDetailsFormId"`
-	RegistrationCount         int                      `json:"registrationCount,omitempty" bson:"registrationCount"`
-	TicketCombos              []int                    `json:"ticketCombos,omitempty" bson:"ticketCombos"`
-	CreatedAt                 int64                    `json:"createdAt,omitempty" bson:"createdAt"`
-	UpdatedAt                 int64                    `json:"updatedAt,omitempty" bson:"updatedAt"`
-	Status                    string                   `json:"status,omitempty" bson:"status"`
+	UniqueId                  string       `json:"uniqueId,omitempty" bson:"uniqueId"`
+	EventName                 string       `json:"eventName" bson:"eventName"`
+	Category                  string       `json:"category" bson:"category"`
+	EventDescription          string       `json:"eventDescription" bson:"eventDescription"`
+	EventType                 string       `json:"eventType" bson:"eventType"`
+	EventMode                 string       `json:"eventMode" bson:"eventMode"`
+	EventLocation             string       `json:"eventLocation,omitempty" bson:"eventLocation"`
+	EventDate                 int64        `json:"eventDate" bson:"eventDate"`
+	FlierImage                string       `json:"flierImage" bson:"flierImage"`
+	PaymentType               string       `json:"paymentType" bson:"paymentType"`
+	ParticipationGuidelines   string       `json:"participationGuidelines,omitempty" bson:"participationGuidelines"`
+	RegistrationDetailsFormId string       `json:"registrationDetailsFormId,omitempty" bson:"registrationDetailsFormId"`
+	RegistrationCount         int          `json:"registrationCount,omitempty" bson:"registrationCount"`
+	TicketTypes               []TicketType `json:"ticketTypes,omitempty" bson:"ticketTypes"`
+	CancellationPolicy        []RefundTier `json:"cancellationPolicy,omitempty" bson:"cancellationPolicy"`
+	OrganizerId               string       `json:"organizerId,omitempty" bson:"organizerId"`
+	// TimeZone is the IANA zone the event takes place in, such as
+	// "Asia/Kolkata", empty meaning the platform default
+	TimeZone string `json:"timeZone,omitempty" bson:"timeZone,omitempty"`
+	// MeetingLink is where online attendees join, only shown to registrants
+	MeetingLink string `json:"meetingLink,omitempty" bson:"meetingLink,omitempty"`
+	// ReminderOffsets are the minutes before EventDate at which registrants
+	// are reminded, nil meaning the platform default
+	ReminderOffsets   []int `json:"reminderOffsets,omitempty" bson:"reminderOffsets"`
+	RemindersDisabled bool  `json:"remindersDisabled,omitempty" bson:"remindersDisabled"`
+	// CalendarSequence counts the changes attendees were told about, so
+	// calendars replace the invite they have with the newer one
+	CalendarSequence int `json:"calendarSequence,omitempty" bson:"calendarSequence"`
+	// Version is bumped by every write to the event so that edits can be
+	// applied only to the version they were made against
+	Version int64 `json:"version,omitempty" bson:"version"`
+	// Announcements are only shown to admins, see GetAnnouncements
+	Announcements []notificationModel.Announcement `json:"-" bson:"announcements,omitempty"`
+	CreatedAt     int64                            `json:"createdAt,omitempty" bson:"createdAt"`
+	UpdatedAt     int64                            `json:"updatedAt,omitempty" bson:"updatedAt"`
+	Status        string                           `json:"status,omitempty" bson:"status"`
 }
 
+// RegistrationPricingCombo is the legacy fixed pricing accepted when creating
+// an event; it is converted into a "General" ticket type with 5 and 10 ticket
+// bundles. Its prices are in major units of the default currency.
 type RegistrationPricingCombo struct {
 	RegistrationAmount float64 `json:"registrationAmount" bson:"registrationAmount"`
 	Combo5Price        string  `json:"combo5Price" bson:"combo5Price"`
 	Combo10Price       string  `json:"combo10Price" bson:"combo10Price"`
 }
 
+// TicketType is a purchasable ticket tier of an event (e.g. General, VIP, Student).
+// A Quantity of 0 means the tier has no seat limit. Prices are in minor units
+// of Currency, an ISO 4217 code.
+type TicketType struct {
+	TicketTypeId string         `json:"ticketTypeId" bson:"ticketTypeId"`
+	Name         string         `json:"name" bson:"name"`
+	Description  string         `json:"description,omitempty" bson:"description"`
+	Price        int64          `json:"price" bson:"price"`
+	Currency     string         `json:"currency" bson:"currency"`
+	Quantity     int            `json:"quantity" bson:"quantity"`
+	SoldCount    int            `json:"soldCount" bson:"soldCount"`
+	SaleStartsAt int64          `json:"saleStartsAt,omitempty" bson:"saleStartsAt"`
+	SaleEndsAt   int64          `json:"saleEndsAt,omitempty" bson:"saleEndsAt"`
+	MinPerOrder  int            `json:"minPerOrder,omitempty" bson:"minPerOrder"`
+	MaxPerOrder  int            `json:"maxPerOrder,omitempty" bson:"maxPerOrder"`
+	Visibility   string         `json:"visibility" bson:"visibility"`
+	Bundles      []TicketBundle `json:"bundles,omitempty" bson:"bundles"`
+
+	// Approximate price in the viewer's currency, never stored
+	DisplayPrice    int64  `json:"displayPrice,omitempty" bson:"-"`
+	DisplayCurrency string `json:"displayCurrency,omitempty" bson:"-"`
+}
+
+// RefundTier refunds Percent of the ticket price when a registration is
+// cancelled at least DaysBeforeEvent days before the event date.
+type RefundTier struct {
+	DaysBeforeEvent int `json:"daysBeforeEvent" bson:"daysBeforeEvent"`
+	Percent         int `json:"percent" bson:"percent"`
+}
+
+// TicketBundle sells Size tickets of a ticket type together at Price.
+type TicketBundle struct {
+	BundleId string `json:"bundleId" bson:"bundleId"`
+	Name     string `json:"name" bson:"name"`
+	Size     int    `json:"size" bson:"size"`
+	Price    int64  `json:"price" bson:"price"`
+
+	DisplayPrice int64 `json:"displayPrice,omitempty" bson:"-"`
+}
+
+// GroupOrder is a purchase of several tickets by one buyer. Every ticket is
+// issued as its own registration and attendees can be assigned later.
+type GroupOrder struct {
+	GroupOrderId    string   `json:"groupOrderId" bson:"groupOrderId"`
+	EventId         string   `json:"eventId" bson:"eventId"`
+	TicketTypeId    string   `json:"ticketTypeId" bson:"ticketTypeId"`
+	TicketTypeName  string   `json:"ticketTypeName" bson:"ticketTypeName"`
+	BundleId        string   `json:"bundleId,omitempty" bson:"bundleId"`
+	BundleName      string   `json:"bundleName,omitempty" bson:"bundleName"`
+	BundleCount     int      `json:"bundleCount,omitempty" bson:"bundleCount"`
+	TicketCount     int      `json:"ticketCount" bson:"ticketCount"`
+	Amount          int64    `json:"amount" bson:"amount"`
+	Currency        string   `json:"currency" bson:"currency"`
+	BuyerEmail      string   `json:"buyerEmail" bson:"buyerEmail"`
+	RegistrationIds []string `json:"registrationIds" bson:"registrationIds"`
+	OrderId         string   `json:"orderId,omitempty" bson:"orderId"`
+	CreatedAt       int64    `json:"createdAt" bson:"createdAt"`
+	UpdatedAt       int64    `json:"updatedAt" bson:"updatedAt"`
+}
+
 type RegisterFormFields struct {
 	Label string   `json:"label" bson:"label"`
 	Type  string   `json:"type" bson:"type"`
@@ -57,11 +151,17 @@ type EventPayload struct {
 	EventMode               string                   `json:"eventMode"`
 	EventLocation           string                   `json:"eventLocation"`
 	EventDate               int64                    `json:"eventDate"`
+	TimeZone                string                   `json:"timeZone"`
+	MeetingLink             string                   `json:"meetingLink"`
 	FlierImage              string                   `json:"flierImage"`
 	PaymentType             string                   `json:"paymentType"`
 	ComboPrices             RegistrationPricingCombo `json:"comboPrices"`
 	ParticipationGuidelines string                   `json:"participationGuidelines"`
-	TicketCombos            []int                    `json:"ticketCombos"`
+	TicketTypes             []TicketType             `json:"ticketTypes"`
+	CancellationPolicy      []RefundTier             `json:"cancellationPolicy"`
+	OrganizerId             string                   `json:"organizerId"`
+	ReminderOffsets         []int                    `json:"reminderOffsets"`
+	RemindersDisabled       bool                     `json:"remindersDisabled"`
 	PrimaryMemberForm       []RegisterFormFields     `json:"primaryMemberForm"`
 	TeamDetailsForm         []RegisterFormFields     `json:"teamDetailsForm"`
 	RegistrationForm        RegistrationForm         `json:"registrationForm"`
@@ -77,12 +177,73 @@ type RegistrationData struct {
 	IsTicketVerified             bool                 `json:"isTicketVerified"`
 	TicketVerificationStatusTeam []string             `json:"ticketVerificationStatusTeam"`
 	QrCode                       string               `json:"qrCode"`
+	TicketTypeId                 string               `json:"ticketTypeId" bson:"ticketTypeId"`
+	TicketTypeName               string               `json:"ticketTypeName" bson:"ticketTypeName"`
+	TicketPrice                  int64                `json:"ticketPrice" bson:"ticketPrice"`
+	Currency                     string               `json:"currency" bson:"currency"`
+	GroupOrderId                 string               `json:"groupOrderId" bson:"groupOrderId"`
+	AttendeeName                 string               `json:"attendeeName,omitempty" bson:"attendeeName"`
+	AttendeeEmail                string               `json:"attendeeEmail,omitempty" bson:"attendeeEmail"`
+	OrderId                      string               `json:"orderId,omitempty" bson:"orderId"`
+	Status                       string               `json:"status" bson:"status"`
+	ConfirmedAt                  int64                `json:"confirmedAt,omitempty" bson:"confirmedAt"`
+	HoldExpiresAt                int64                `json:"holdExpiresAt,omitempty" bson:"holdExpiresAt"`
+	IsActive                     bool                 `json:"isActive" bson:"isActive"`
+}
+
+// EventRemindersReq replaces the reminder settings of an event. Empty
+// ReminderOffsets go back to the platform default.
+type EventRemindersReq struct {
+	UniqueId          string `json:"uniqueId"`
+	ReminderOffsets   []int  `json:"reminderOffsets"`
+	RemindersDisabled bool   `json:"remindersDisabled"`
+}
+
+type PhoneNumberReq struct {
+	Phone string `json:"phone"`
+	// Channel the code is sent through, sms unless set to whatsapp
+	Channel string `json:"channel"`
+}
+
+type VerifyPhoneNumberReq struct {
+	Code string `json:"code"`
 }
 
 type RegisterReq struct {
 	PrimaryMemberForm []RegisterFormFields `json:"primaryMemberForm,omitempty" bson:"primaryMemberForm"`
 	TeamDetailsForm   []RegisterFormFields `json:"teamDetailsForm,omitempty" bson:"teamDetailsForm"`
 	UniqueId          string               `json:"uniqueId" bson:"uniqueId"`
+	TicketTypeId      string               `json:"ticketTypeId" bson:"ticketTypeId"`
+}
+
+type GroupRegisterReq struct {
+	UniqueId          string               `json:"uniqueId"`
+	TicketTypeId      string               `json:"ticketTypeId"`
+	BundleId          string               `json:"bundleId"`
+	BundleCount       int                  `json:"bundleCount"`
+	Quantity          int                  `json:"quantity"`
+	PrimaryMemberForm []RegisterFormFields `json:"primaryMemberForm,omitempty"`
+}
+
+type AssignAttendeeReq struct {
+	RegistrationId string `json:"registrationId"`
+	AttendeeName   string `json:"attendeeName"`
+	AttendeeEmail  string `json:"attendeeEmail"`
+}
+
+// DisplayCurrencyReq asks for ticket prices to also be shown, approximately,
+// in the viewer's currency.
+type DisplayCurrencyReq struct {
+	DisplayCurrency string `json:"displayCurrency"`
+}
+
+type CancelRegistrationReq struct {
+	RegistrationId string `json:"registrationId"`
+}
+
+type CancelEventReq struct {
+	UniqueId string `json:"uniqueId"`
+	Reason   string `json:"reason"`
 }
 
 type RegistrationRequestData struct {
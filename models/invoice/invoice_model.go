@@ -0,0 +1,95 @@
+package invoiceModel
+
+const (
+	// Issued by GST registered organizers
+	DocumentTypeTaxInvoice = "tax_invoice"
+	// Issued by organizers without a GSTIN, no tax is charged
+	DocumentTypeReceipt = "receipt"
+)
+
+// Organizer is the seller named on invoices of its events. GSTRate is the
+// GST percentage included in ticket prices; it is split into CGST and SGST
+// within the organizer's state and charged as IGST otherwise. The platform
+// keeps PlatformFeePercent of every sale, 0 meaning the platform default.
+// LogoURL, BrandColor and SupportEmail brand the emails sent for its events.
+type Organizer struct {
+	OrganizerId   string  `json:"organizerId" bson:"organizerId"`
+	Name          string  `json:"name" bson:"name"`
+	GSTIN         string  `json:"gstin,omitempty" bson:"gstin"`
+	PAN           string  `json:"pan,omitempty" bson:"pan"`
+	Address       string  `json:"address" bson:"address"`
+	State         string  `json:"state" bson:"state"`
+	StateCode     string  `json:"stateCode" bson:"stateCode"`
+	Email         string  `json:"email,omitempty" bson:"email"`
+	Phone         string  `json:"phone,omitempty" bson:"phone"`
+	InvoicePrefix string  `json:"invoicePrefix" bson:"invoicePrefix"`
+	GSTRate       float64 `json:"gstRate" bson:"gstRate"`
+	SACCode       string  `json:"sacCode" bson:"sacCode"`
+
+	PlatformFeePercent float64 `json:"platformFeePercent,omitempty" bson:"platformFeePercent"`
+	LogoURL            string  `json:"logoUrl,omitempty" bson:"logoUrl"`
+	BrandColor         string  `json:"brandColor,omitempty" bson:"brandColor"`
+	SupportEmail       string  `json:"supportEmail,omitempty" bson:"supportEmail"`
+	CreatedAt          int64   `json:"createdAt,omitempty" bson:"createdAt"`
+	UpdatedAt          int64   `json:"updatedAt,omitempty" bson:"updatedAt"`
+}
+
+// BillingDetails are the buyer details printed on an invoice. Institutions
+// claiming input tax credit give their GSTIN and state.
+type BillingDetails struct {
+	Name        string `json:"name,omitempty" bson:"name"`
+	Email       string `json:"email,omitempty" bson:"email"`
+	Institution string `json:"institution,omitempty" bson:"institution"`
+	GSTIN       string `json:"gstin,omitempty" bson:"gstin"`
+	Address     string `json:"address,omitempty" bson:"address"`
+	State       string `json:"state,omitempty" bson:"state"`
+	StateCode   string `json:"stateCode,omitempty" bson:"stateCode"`
+}
+
+// Invoice is issued once per paid order. Amounts are in minor units and Total
+// is what the buyer paid, tax included.
+type Invoice struct {
+	InvoiceId     string         `json:"invoiceId" bson:"invoiceId"`
+	InvoiceNumber string         `json:"invoiceNumber" bson:"invoiceNumber"`
+	DocumentType  string         `json:"documentType" bson:"documentType"`
+	FinancialYear string         `json:"financialYear" bson:"financialYear"`
+	OrganizerId   string         `json:"organizerId" bson:"organizerId"`
+	Seller        Organizer      `json:"seller" bson:"seller"`
+	Buyer         BillingDetails `json:"buyer" bson:"buyer"`
+	OrderId       string         `json:"orderId" bson:"orderId"`
+	PaymentId     string         `json:"paymentId" bson:"paymentId"`
+	EventId       string         `json:"eventId" bson:"eventId"`
+	EventName     string         `json:"eventName" bson:"eventName"`
+	PlaceOfSupply string         `json:"placeOfSupply" bson:"placeOfSupply"`
+	Items         []InvoiceItem  `json:"items" bson:"items"`
+	Currency      string         `json:"currency" bson:"currency"`
+	Subtotal      int64          `json:"subtotal" bson:"subtotal"`
+	Discount      int64          `json:"discount" bson:"discount"`
+	TaxableAmount int64          `json:"taxableAmount" bson:"taxableAmount"`
+	CGSTRate      float64        `json:"cgstRate" bson:"cgstRate"`
+	CGST          int64          `json:"cgst" bson:"cgst"`
+	SGSTRate      float64        `json:"sgstRate" bson:"sgstRate"`
+	SGST          int64          `json:"sgst" bson:"sgst"`
+	IGSTRate      float64        `json:"igstRate" bson:"igstRate"`
+	IGST          int64          `json:"igst" bson:"igst"`
+	Total         int64          `json:"total" bson:"total"`
+	IssuedAt      int64          `json:"issuedAt" bson:"issuedAt"`
+}
+
+type InvoiceItem struct {
+	Description string `json:"description" bson:"description"`
+	SACCode     string `json:"sacCode,omitempty" bson:"sacCode"`
+	Quantity    int    `json:"quantity" bson:"quantity"`
+	UnitPrice   int64  `json:"unitPrice" bson:"unitPrice"`
+	Amount      int64  `json:"amount" bson:"amount"`
+}
+
+type InvoiceRequest struct {
+	OrderId string `json:"orderId"`
+}
+
+type InvoiceListRequest struct {
+	OrderId     string `json:"orderId"`
+	EventId     string `json:"eventId"`
+	OrganizerId string `json:"organizerId"`
+}
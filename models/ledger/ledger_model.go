@@ -0,0 +1,105 @@
+package ledgerModel
+
+const (
+	TransactionTypeSale   = "sale"
+	TransactionTypeRefund = "refund"
+	TransactionTypePayout = "payout"
+)
+
+// LedgerTransaction is a balanced double-entry journal entry: the debits of
+// its entries equal the credits. Reference identifies what it records (an
+// order, refund or payout) and is unique per type, so recording the same
+// thing twice is a no-op. Amounts are in minor units.
+type LedgerTransaction struct {
+	TransactionId string        `json:"transactionId" bson:"transactionId"`
+	Type          string        `json:"type" bson:"type"`
+	Reference     string        `json:"reference" bson:"reference"`
+	OrderId       string        `json:"orderId,omitempty" bson:"orderId"`
+	EventId       string        `json:"eventId,omitempty" bson:"eventId"`
+	OrganizerId   string        `json:"organizerId" bson:"organizerId"`
+	Currency      string        `json:"currency" bson:"currency"`
+	Entries       []LedgerEntry `json:"entries" bson:"entries"`
+	Note          string        `json:"note,omitempty" bson:"note"`
+	CreatedAt     int64         `json:"createdAt" bson:"createdAt"`
+}
+
+type LedgerEntry struct {
+	Account string `json:"account" bson:"account"`
+	Debit   int64  `json:"debit" bson:"debit"`
+	Credit  int64  `json:"credit" bson:"credit"`
+}
+
+// Payout is money transferred from the provider account to an organizer.
+type Payout struct {
+	PayoutId    string `json:"payoutId" bson:"payoutId"`
+	OrganizerId string `json:"organizerId" bson:"organizerId"`
+	Amount      int64  `json:"amount" bson:"amount"`
+	Currency    string `json:"currency" bson:"currency"`
+	Reference   string `json:"reference" bson:"reference"` // bank transfer reference, e.g. UTR
+	Note        string `json:"note,omitempty" bson:"note"`
+	Status      string `json:"status" bson:"status"`
+	CreatedBy   string `json:"createdBy" bson:"createdBy"`
+	CreatedAt   int64  `json:"createdAt" bson:"createdAt"`
+}
+
+// AccountBalance is the balance of an account in one currency. Balance is
+// credits minus debits, so money owed to an organizer is positive.
+type AccountBalance struct {
+	Account  string `json:"account" bson:"account"`
+	Currency string `json:"currency" bson:"currency"`
+	Debit    int64  `json:"debit" bson:"debit"`
+	Credit   int64  `json:"credit" bson:"credit"`
+	Balance  int64  `json:"balance" bson:"balance"`
+}
+
+// StatementLine is one transaction on an organizer's settlement statement.
+type StatementLine struct {
+	Date        int64  `json:"date"`
+	Type        string `json:"type"`
+	Reference   string `json:"reference"`
+	OrderId     string `json:"orderId,omitempty"`
+	EventId     string `json:"eventId,omitempty"`
+	Gross       int64  `json:"gross"`
+	PlatformFee int64  `json:"platformFee"`
+	Net         int64  `json:"net"`
+	Balance     int64  `json:"balance"`
+}
+
+// Statement is what was owed to an organizer in one currency over a period
+// and how it changed.
+type Statement struct {
+	OrganizerId    string          `json:"organizerId"`
+	Currency       string          `json:"currency"`
+	From           int64           `json:"from"`
+	To             int64           `json:"to"`
+	OpeningBalance int64           `json:"openingBalance"`
+	Sales          int64           `json:"sales"`
+	Refunds        int64           `json:"refunds"`
+	PlatformFees   int64           `json:"platformFees"`
+	Payouts        int64           `json:"payouts"`
+	ClosingBalance int64           `json:"closingBalance"`
+	Lines          []StatementLine `json:"lines"`
+}
+
+type PayoutRequest struct {
+	OrganizerId string `json:"organizerId"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Reference   string `json:"reference"`
+	Note        string `json:"note"`
+}
+
+type BalanceRequest struct {
+	OrganizerId string `json:"organizerId"`
+	EventId     string `json:"eventId"`
+}
+
+// StatementRequest asks for an organizer statement between From and To (unix
+// seconds). Format "csv" downloads it as a spreadsheet.
+type StatementRequest struct {
+	OrganizerId string `json:"organizerId"`
+	Currency    string `json:"currency"`
+	From        int64  `json:"from"`
+	To          int64  `json:"to"`
+	Format      string `json:"format"`
+}
@@ -9,10 +9,13 @@ type RegisterReq struct {
 	UserName string `json:"userName"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Locale picks the language of the emails sent to the user, e.g. en or hi
+	Locale string `json:"locale"`
 }
 type RegisterNewUserOrResetPasswordReq struct {
 	Email      string `json:"email"`
 	Rechaptcha string `json:"rechaptcha"`
+	Locale     string `json:"locale"`
 }
 
 type ForgotPasswordOTPRequest struct {
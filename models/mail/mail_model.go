@@ -0,0 +1,46 @@
+package mailModel
+
+// EmailTemplate overrides one of the built-in email templates, for every
+// organizer or only for OrganizerId. Subject, HTML and Text are Go templates;
+// HTML is rendered inside the branded layout and Text may be left empty to
+// keep the built-in plain text body.
+type EmailTemplate struct {
+	Name        string `json:"name" bson:"name"`
+	Locale      string `json:"locale" bson:"locale"`
+	OrganizerId string `json:"organizerId,omitempty" bson:"organizerId"`
+	Subject     string `json:"subject" bson:"subject"`
+	HTML        string `json:"html" bson:"html"`
+	Text        string `json:"text,omitempty" bson:"text"`
+	UpdatedBy   string `json:"updatedBy,omitempty" bson:"updatedBy"`
+	UpdatedAt   int64  `json:"updatedAt,omitempty" bson:"updatedAt"`
+}
+
+type EmailTemplateKey struct {
+	Name        string `json:"name"`
+	Locale      string `json:"locale"`
+	OrganizerId string `json:"organizerId"`
+}
+
+type EmailTemplateListRequest struct {
+	Name        string `json:"name"`
+	OrganizerId string `json:"organizerId"`
+}
+
+// TemplatePreviewRequest renders a template with Data merged over the
+// template's sample data.
+type TemplatePreviewRequest struct {
+	Name        string                 `json:"name"`
+	Locale      string                 `json:"locale"`
+	OrganizerId string                 `json:"organizerId"`
+	Data        map[string]interface{} `json:"data"`
+}
+
+// RenderedEmail is a template rendered for one recipient.
+type RenderedEmail struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+	Locale  string `json:"locale"`
+	// Source says which template was used: built-in or override
+	Source string `json:"source"`
+}
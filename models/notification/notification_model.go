@@ -0,0 +1,168 @@
+package notificationModel
+
+// NotificationJob is a notification waiting in the outbox. Workers deliver it
+// and retry with backoff until MaxAttempts, after which it is dead-lettered
+// until an admin replays it. Jobs with the same DedupeKey are only queued
+// once.
+type NotificationJob struct {
+	JobId         string              `json:"jobId" bson:"jobId"`
+	Type          string              `json:"type" bson:"type"`
+	Payload       NotificationPayload `json:"payload" bson:"payload"`
+	DedupeKey     string              `json:"dedupeKey,omitempty" bson:"dedupeKey,omitempty"`
+	Status        string              `json:"status" bson:"status"`
+	Attempts      int                 `json:"attempts" bson:"attempts"`
+	MaxAttempts   int                 `json:"maxAttempts" bson:"maxAttempts"`
+	NextAttemptAt int64               `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	LockedUntil   int64               `json:"lockedUntil,omitempty" bson:"lockedUntil"`
+	LastError     string              `json:"lastError,omitempty" bson:"lastError"`
+	Failures      []JobFailure        `json:"failures,omitempty" bson:"failures,omitempty"`
+	CreatedAt     int64               `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     int64               `json:"updatedAt" bson:"updatedAt"`
+	SentAt        int64               `json:"sentAt,omitempty" bson:"sentAt"`
+	DeadAt        int64               `json:"deadAt,omitempty" bson:"deadAt"`
+	ReplayedBy    string              `json:"replayedBy,omitempty" bson:"replayedBy"`
+	ReplayedAt    int64               `json:"replayedAt,omitempty" bson:"replayedAt"`
+}
+
+// NotificationPayload identifies what a job is about; each job type uses
+// the fields it needs and loads everything else when it runs.
+type NotificationPayload struct {
+	RegistrationId string `json:"registrationId,omitempty" bson:"registrationId,omitempty"`
+	OrderId        string `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	EventId        string `json:"eventId,omitempty" bson:"eventId,omitempty"`
+	// EventDate and ReminderOffset identify the reminder a job sends, so
+	// reminders for an event that has since moved are dropped
+	EventDate      int64 `json:"eventDate,omitempty" bson:"eventDate,omitempty"`
+	ReminderOffset int   `json:"reminderOffset,omitempty" bson:"reminderOffset,omitempty"`
+	// Changes summarises an edit of the event, as it was when it was made
+	Changes        []EventChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	AnnouncementId string        `json:"announcementId,omitempty" bson:"announcementId,omitempty"`
+	// Email, Reason and RefundAmount describe the cancellation of an event
+	// to one of the people holding a registration
+	Email        string `json:"email,omitempty" bson:"email,omitempty"`
+	Reason       string `json:"reason,omitempty" bson:"reason,omitempty"`
+	RefundAmount int64  `json:"refundAmount,omitempty" bson:"refundAmount,omitempty"`
+	Currency     string `json:"currency,omitempty" bson:"currency,omitempty"`
+	// Channel, Phone and Text describe a text message
+	Channel string `json:"channel,omitempty" bson:"channel,omitempty"`
+	Phone   string `json:"phone,omitempty" bson:"phone,omitempty"`
+	Text    string `json:"text,omitempty" bson:"text,omitempty"`
+	// DeliveryId is the webhook delivery a job sends
+	DeliveryId string `json:"deliveryId,omitempty" bson:"deliveryId,omitempty"`
+}
+
+// EventChange is a change to an event attendees are told about, with the
+// old and new values as they are shown to them.
+type EventChange struct {
+	Field string `json:"field" bson:"field"`
+	Old   string `json:"old" bson:"old"`
+	New   string `json:"new" bson:"new"`
+}
+
+type JobFailure struct {
+	Attempt int    `json:"attempt" bson:"attempt"`
+	Error   string `json:"error" bson:"error"`
+	At      int64  `json:"at" bson:"at"`
+}
+
+type NotificationJobListRequest struct {
+	Status string `json:"status"`
+	Type   string `json:"type"`
+	JobId  string `json:"jobId"`
+}
+
+// ReplayJobsRequest puts dead jobs back in the queue, either the given ones
+// or every dead job (of Type, if set) when JobIds is empty.
+type ReplayJobsRequest struct {
+	JobIds []string `json:"jobIds"`
+	Type   string   `json:"type"`
+}
+
+// NotificationPreferences are a user's choices about optional notifications.
+// The zero value receives everything; emails about their own registrations
+// and payments cannot be muted.
+type NotificationPreferences struct {
+	// Muted lists the categories the user does not want, e.g. reminders
+	Muted []string `json:"muted" bson:"muted"`
+	// Channels lists, per notification type, the text channels (sms,
+	// whatsapp) it is also sent through besides email
+	Channels map[string][]string `json:"channels,omitempty" bson:"channels,omitempty"`
+}
+
+// ReminderDispatch records that a reminder of an event was queued for its
+// registrants, so restarts and other instances do not send it again.
+type ReminderDispatch struct {
+	EventId      string `json:"eventId" bson:"eventId"`
+	EventDate    int64  `json:"eventDate" bson:"eventDate"`
+	Offset       int    `json:"offset" bson:"offset"`
+	Registrants  int    `json:"registrants" bson:"registrants"`
+	DispatchedAt int64  `json:"dispatchedAt" bson:"dispatchedAt"`
+}
+
+// Announcement is a message an organizer sent to the registrants of an event,
+// kept in the event's history.
+type Announcement struct {
+	AnnouncementId string              `json:"announcementId" bson:"announcementId"`
+	Subject        string              `json:"subject" bson:"subject"`
+	Message        string              `json:"message" bson:"message"`
+	Segment        AnnouncementSegment `json:"segment" bson:"segment"`
+	Recipients     int                 `json:"recipients" bson:"recipients"`
+	CreatedBy      string              `json:"createdBy" bson:"createdBy"`
+	CreatedAt      int64               `json:"createdAt" bson:"createdAt"`
+}
+
+// AnnouncementSegment narrows down who receives an announcement. Every
+// confirmed registrant matching all the filters set receives it; the zero
+// value is everyone.
+type AnnouncementSegment struct {
+	// CheckIn is "checked_in" or "not_checked_in"
+	CheckIn       string   `json:"checkIn,omitempty" bson:"checkIn,omitempty"`
+	TicketTypeIds []string `json:"ticketTypeIds,omitempty" bson:"ticketTypeIds,omitempty"`
+	// TeamCaptains sends it only to whoever registered a team
+	TeamCaptains bool `json:"teamCaptains,omitempty" bson:"teamCaptains,omitempty"`
+}
+
+type AnnouncementReq struct {
+	EventId string              `json:"eventId"`
+	Subject string              `json:"subject"`
+	Message string              `json:"message"`
+	Segment AnnouncementSegment `json:"segment"`
+}
+
+type AnnouncementListReq struct {
+	EventId string `json:"eventId"`
+}
+
+// AnnouncementReport is an announcement with how far its delivery got.
+type AnnouncementReport struct {
+	Announcement
+	Pending int `json:"pending"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+}
+
+// FeedItem is a notification in a user's in-app feed. SourceId identifies
+// what created it, so it is only added once.
+type FeedItem struct {
+	NotificationId string `json:"notificationId" bson:"notificationId"`
+	UserEmail      string `json:"-" bson:"userEmail"`
+	Type           string `json:"type" bson:"type"`
+	Title          string `json:"title" bson:"title"`
+	Body           string `json:"body" bson:"body"`
+	EventId        string `json:"eventId,omitempty" bson:"eventId,omitempty"`
+	SourceId       string `json:"-" bson:"sourceId,omitempty"`
+	ReadAt         int64  `json:"readAt,omitempty" bson:"readAt"`
+	CreatedAt      int64  `json:"createdAt" bson:"createdAt"`
+}
+
+type FeedListRequest struct {
+	Limit      int   `json:"limit"`
+	Before     int64 `json:"before"`
+	UnreadOnly bool  `json:"unreadOnly"`
+}
+
+// FeedReadRequest marks the given notifications read, or all of them when
+// NotificationIds is empty.
+type FeedReadRequest struct {
+	NotificationIds []string `json:"notificationIds"`
+}
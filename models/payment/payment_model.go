@@ -1,18 +1,89 @@
 package paymentModel
 
+import invoiceModel "em_backend/models/invoice"
+
 type OrderRequest struct {
-	Amount   int64  `json:"amount"`
-	Currency string `json:"currency"`
-	Receipt  string `json:"receipt"`
-	RegID    string `json:"reg_id,omitempty"` // Custom field for internal use
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Receipt      string `json:"receipt"`
+	RegID        string `json:"reg_id,omitempty"` // Custom field for internal use
+	GroupOrderId string `json:"groupOrderId,omitempty"`
+	EventId      string `json:"eventId,omitempty"`
+	PromoCode    string `json:"promoCode,omitempty"`
+	// Printed on the invoice of the order
+	BillingDetails invoiceModel.BillingDetails `json:"billingDetails"`
+}
+
+// RazorpayOrderReq is the body sent to the Razorpay orders API.
+type RazorpayOrderReq struct {
+	Amount   int64             `json:"amount"`
+	Currency string            `json:"currency"`
+	Receipt  string            `json:"receipt"`
+	Notes    map[string]string `json:"notes,omitempty"`
 }
 
 type OrderResponse struct {
-	ID       string `json:"id"`
-	Amount   int64  `json:"amount"`
-	Currency string `json:"currency"`
-	Receipt  string `json:"receipt"`
-	Status   string `json:"status"`
+	ID           string `json:"id"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Receipt      string `json:"receipt"`
+	Status       string `json:"status"`
+	Provider     string `json:"provider,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"` // Stripe payment intent secret
+	ExpiresAt    int64  `json:"expiresAt,omitempty"`
+}
+
+// ProviderOrderRequest is what a payment provider needs to open an order.
+type ProviderOrderRequest struct {
+	Amount   int64
+	Currency string
+	Receipt  string
+	Notes    map[string]string
+}
+
+// ProviderOrderStatus is the provider's view of an order.
+type ProviderOrderStatus struct {
+	OrderID    string `json:"orderId"`
+	Status     string `json:"status"`
+	Amount     int64  `json:"amount"`
+	AmountPaid int64  `json:"amountPaid"`
+	Currency   string `json:"currency"`
+	PaymentID  string `json:"paymentId,omitempty"`
+}
+
+// ProviderRefund is the provider's view of a refund.
+type ProviderRefund struct {
+	RefundID  string `json:"refundId"`
+	PaymentID string `json:"paymentId"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+}
+
+// ProviderPayment is the provider's record of a payment, used to reconcile
+// our payments against it. Status uses the paymentDetails status names.
+type ProviderPayment struct {
+	PaymentID      string `json:"paymentId"`
+	OrderID        string `json:"orderId"`
+	Amount         int64  `json:"amount"`
+	AmountRefunded int64  `json:"amountRefunded"`
+	Currency       string `json:"currency"`
+	Status         string `json:"status"`
+	CreatedAt      int64  `json:"createdAt"`
+}
+
+// ProviderWebhookEvent is a provider webhook translated into the events this
+// service handles.
+type ProviderWebhookEvent struct {
+	EventID          string
+	Type             string
+	OrderID          string
+	PaymentID        string
+	Amount           int64
+	Currency         string
+	RefundID         string
+	ErrorCode        string
+	ErrorDescription string
 }
 
 type PaymentVerification struct {
@@ -22,18 +93,185 @@ type PaymentVerification struct {
 }
 
 type OrderDetails struct {
-	OrderID  string            `gorm:"primaryKey"`
-	Amount   int64             `gorm:"not null"`
-	Currency string            `gorm:"not null"`
-	Receipt  string            `gorm:"not null"`
-	Status   string            `gorm:"not null"`
-	Notes    map[string]string `gorm:"type:jsonb"`
-	RegID    string            `gorm:"not null"`
+	OrderID        string            `gorm:"primaryKey" bson:"orderId" json:"orderId"`
+	Amount         int64             `gorm:"not null" bson:"amount" json:"amount"`
+	Currency       string            `gorm:"not null" bson:"currency" json:"currency"`
+	Receipt        string            `gorm:"not null" bson:"receipt" json:"receipt"`
+	Status         string            `gorm:"not null" bson:"status" json:"status"`
+	Notes          map[string]string `gorm:"type:jsonb" bson:"notes" json:"notes,omitempty"`
+	RegID          string            `gorm:"not null" bson:"regId" json:"regId"`
+	GroupOrderId   string            `bson:"groupOrderId" json:"groupOrderId,omitempty"`
+	EventId        string            `bson:"eventId" json:"eventId,omitempty"`
+	TicketTypeId   string            `bson:"ticketTypeId" json:"ticketTypeId,omitempty"`
+	TicketCount    int               `bson:"ticketCount" json:"ticketCount"`
+	UserEmail      string            `bson:"userEmail" json:"userEmail,omitempty"`
+	Subtotal       int64             `bson:"subtotal" json:"subtotal"`
+	DiscountAmount int64             `bson:"discountAmount" json:"discountAmount"`
+	PromoCode      string            `bson:"promoCode" json:"promoCode,omitempty"`
+	Provider       string            `bson:"provider" json:"provider,omitempty"`
+	PaymentId      string            `bson:"paymentId" json:"paymentId,omitempty"`
+	RefundReserved int64             `bson:"refundReserved,omitempty" json:"refundReserved,omitempty"`
+	CreatedAt      int64             `bson:"createdAt" json:"createdAt"`
+	PaidAt         int64             `bson:"paidAt" json:"paidAt,omitempty"`
+	ExpiresAt      int64             `bson:"expiresAt" json:"expiresAt,omitempty"`
+	UpdatedAt      int64             `bson:"updatedAt" json:"updatedAt,omitempty"`
+	StatusHistory  []StatusChange    `bson:"statusHistory" json:"statusHistory,omitempty"`
+
+	BillingDetails invoiceModel.BillingDetails `bson:"billingDetails" json:"billingDetails"`
 }
 
 type PaymentDetails struct {
-	ID        uint   `gorm:"primaryKey"`
-	OrderID   string `gorm:"not null"`
-	PaymentID string `gorm:"not null"`
-	Status    string `gorm:"not null"`
+	ID        uint   `gorm:"primaryKey" bson:"-" json:"-"`
+	OrderID   string `gorm:"not null" bson:"orderId" json:"orderId"`
+	PaymentID string `gorm:"not null" bson:"paymentId" json:"paymentId"`
+	Status    string `gorm:"not null" bson:"status" json:"status"`
+	Amount    int64  `bson:"amount" json:"amount"`
+	Currency  string `bson:"currency" json:"currency"`
+	CreatedAt int64  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt int64  `bson:"updatedAt" json:"updatedAt"`
+
+	ErrorCode        string   `bson:"errorCode,omitempty" json:"errorCode,omitempty"`
+	ErrorDescription string   `bson:"errorDescription,omitempty" json:"errorDescription,omitempty"`
+	RefundedAmount   int64    `bson:"refundedAmount" json:"refundedAmount"`
+	RefundIds        []string `bson:"refundIds,omitempty" json:"refundIds,omitempty"`
+}
+
+// Refund is a refund of a captured payment, tracked from the request until
+// the provider settles it. Amounts are in minor units.
+type Refund struct {
+	RefundId         string         `bson:"refundId" json:"refundId"`
+	ProviderRefundId string         `bson:"providerRefundId" json:"providerRefundId,omitempty"`
+	Provider         string         `bson:"provider" json:"provider"`
+	OrderId          string         `bson:"orderId" json:"orderId"`
+	PaymentId        string         `bson:"paymentId" json:"paymentId"`
+	EventId          string         `bson:"eventId" json:"eventId,omitempty"`
+	RegistrationIds  []string       `bson:"registrationIds" json:"registrationIds,omitempty"`
+	Amount           int64          `bson:"amount" json:"amount"`
+	Currency         string         `bson:"currency" json:"currency"`
+	Reason           string         `bson:"reason" json:"reason,omitempty"`
+	InitiatedBy      string         `bson:"initiatedBy" json:"initiatedBy"`
+	Status           string         `bson:"status" json:"status"`
+	StatusHistory    []StatusChange `bson:"statusHistory" json:"statusHistory"`
+	CreatedAt        int64          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt        int64          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// StatusChange is one entry in the status history of an order or refund.
+type StatusChange struct {
+	Status string `bson:"status" json:"status"`
+	Note   string `bson:"note,omitempty" json:"note,omitempty"`
+	At     int64  `bson:"at" json:"at"`
+}
+
+// RefundRequest is an admin refund of an order. An Amount of 0 refunds
+// everything that has not been refunded yet; RegistrationIds are cancelled
+// along with the refund.
+type RefundRequest struct {
+	OrderId         string   `json:"orderId"`
+	Amount          int64    `json:"amount"`
+	RegistrationIds []string `json:"registrationIds"`
+	Reason          string   `json:"reason"`
+}
+
+type RefundListRequest struct {
+	OrderId string `json:"orderId"`
+	EventId string `json:"eventId"`
+	Status  string `json:"status"`
+}
+
+// ReconciliationReport compares the payments a provider captured in a date
+// range with our orders and payments.
+type ReconciliationReport struct {
+	ReportId         string               `bson:"reportId" json:"reportId"`
+	Provider         string               `bson:"provider" json:"provider"`
+	From             int64                `bson:"from" json:"from"`
+	To               int64                `bson:"to" json:"to"`
+	DryRun           bool                 `bson:"dryRun" json:"dryRun"`
+	ProviderPayments int                  `bson:"providerPayments" json:"providerPayments"`
+	Matched          int                  `bson:"matched" json:"matched"`
+	Items            []ReconciliationItem `bson:"items" json:"items"`
+	StartedAt        int64                `bson:"startedAt" json:"startedAt"`
+	FinishedAt       int64                `bson:"finishedAt" json:"finishedAt"`
+	RunBy            string               `bson:"runBy" json:"runBy"`
+}
+
+// ReconciliationItem is one discrepancy. Fixed is set when it was corrected
+// automatically.
+type ReconciliationItem struct {
+	Type           string `bson:"type" json:"type"`
+	OrderId        string `bson:"orderId" json:"orderId,omitempty"`
+	PaymentId      string `bson:"paymentId" json:"paymentId,omitempty"`
+	ProviderStatus string `bson:"providerStatus" json:"providerStatus,omitempty"`
+	LocalStatus    string `bson:"localStatus" json:"localStatus,omitempty"`
+	ProviderAmount int64  `bson:"providerAmount" json:"providerAmount"`
+	LocalAmount    int64  `bson:"localAmount" json:"localAmount"`
+	Currency       string `bson:"currency" json:"currency,omitempty"`
+	Detail         string `bson:"detail" json:"detail,omitempty"`
+	Fixed          bool   `bson:"fixed" json:"fixed"`
+}
+
+// ReconcileRequest reconciles the payments created between From and To (unix
+// seconds). The last day is reconciled when they are not given.
+type ReconcileRequest struct {
+	Provider string `json:"provider"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+	DryRun   bool   `json:"dryRun"`
+}
+
+type ReconciliationReportListRequest struct {
+	ReportId string `json:"reportId"`
+	Provider string `json:"provider"`
+}
+
+// RazorpayWebhook is the body Razorpay posts to the webhook endpoint.
+type RazorpayWebhook struct {
+	Entity    string                 `json:"entity"`
+	AccountID string                 `json:"account_id"`
+	Event     string                 `json:"event"`
+	Contains  []string               `json:"contains"`
+	Payload   RazorpayWebhookPayload `json:"payload"`
+	CreatedAt int64                  `json:"created_at"`
+}
+
+type RazorpayWebhookPayload struct {
+	Payment struct {
+		Entity RazorpayPayment `json:"entity"`
+	} `json:"payment"`
+	Order struct {
+		Entity OrderResponse `json:"entity"`
+	} `json:"order"`
+	Refund struct {
+		Entity RazorpayRefund `json:"entity"`
+	} `json:"refund"`
+}
+
+type RazorpayPayment struct {
+	ID               string `json:"id"`
+	OrderID          string `json:"order_id"`
+	Amount           int64  `json:"amount"`
+	Currency         string `json:"currency"`
+	Status           string `json:"status"`
+	AmountRefunded   int64  `json:"amount_refunded"`
+	ErrorCode        string `json:"error_code"`
+	ErrorDescription string `json:"error_description"`
+	CreatedAt        int64  `json:"created_at"`
+}
+
+type RazorpayRefund struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+}
+
+// WebhookEvent records a processed provider webhook so retries of the same
+// event are ignored.
+type WebhookEvent struct {
+	EventId     string `bson:"eventId" json:"eventId"`
+	Provider    string `bson:"provider" json:"provider"`
+	Event       string `bson:"event" json:"event"`
+	ReceivedAt  int64  `bson:"receivedAt" json:"receivedAt"`
+	ProcessedAt int64  `bson:"processedAt" json:"processedAt"`
 }
@@ -0,0 +1,58 @@
+package promoModel
+
+const (
+	DiscountTypePercentage = "percentage"
+	DiscountTypeFixed      = "fixed"
+)
+
+// PromoCode is an admin managed discount. An empty EventId makes the code
+// valid for every event and empty TicketTypeIds for every ticket type. A
+// MaxUses or PerUserLimit of 0 means no limit. Percentage discounts are set
+// in DiscountValue; fixed discounts in DiscountAmount, in minor units of
+// Currency, and only apply to orders in that currency.
+type PromoCode struct {
+	Code           string   `json:"code" bson:"code"`
+	Description    string   `json:"description,omitempty" bson:"description"`
+	DiscountType   string   `json:"discountType" bson:"discountType"`
+	DiscountValue  float64  `json:"discountValue,omitempty" bson:"discountValue"`
+	DiscountAmount int64    `json:"discountAmount,omitempty" bson:"discountAmount"`
+	Currency       string   `json:"currency,omitempty" bson:"currency"`
+	EventId        string   `json:"eventId,omitempty" bson:"eventId"`
+	TicketTypeIds  []string `json:"ticketTypeIds,omitempty" bson:"ticketTypeIds"`
+	MaxUses        int      `json:"maxUses" bson:"maxUses"`
+	UsedCount      int      `json:"usedCount" bson:"usedCount"`
+	PerUserLimit   int      `json:"perUserLimit" bson:"perUserLimit"`
+	ValidFrom      int64    `json:"validFrom,omitempty" bson:"validFrom"`
+	ValidUntil     int64    `json:"validUntil,omitempty" bson:"validUntil"`
+	Status         string   `json:"status" bson:"status"`
+	CreatedBy      string   `json:"createdBy,omitempty" bson:"createdBy"`
+	CreatedAt      int64    `json:"createdAt,omitempty" bson:"createdAt"`
+	UpdatedAt      int64    `json:"updatedAt,omitempty" bson:"updatedAt"`
+}
+
+// PromoRedemption records one use of a promo code on an order. Amounts are in
+// the currency's minor units, like the order amount.
+type PromoRedemption struct {
+	RedemptionId   string `json:"redemptionId" bson:"redemptionId"`
+	Code           string `json:"code" bson:"code"`
+	EventId        string `json:"eventId" bson:"eventId"`
+	TicketTypeId   string `json:"ticketTypeId,omitempty" bson:"ticketTypeId"`
+	UserEmail      string `json:"userEmail" bson:"userEmail"`
+	OrderId        string `json:"orderId" bson:"orderId"`
+	Subtotal       int64  `json:"subtotal" bson:"subtotal"`
+	DiscountAmount int64  `json:"discountAmount" bson:"discountAmount"`
+	Currency       string `json:"currency" bson:"currency"`
+	RedeemedAt     int64  `json:"redeemedAt" bson:"redeemedAt"`
+}
+
+type PromoReportReq struct {
+	Code    string `json:"code"`
+	EventId string `json:"eventId"`
+}
+
+type PromoCodeSummary struct {
+	Code          string `json:"code" bson:"_id"`
+	Redemptions   int    `json:"redemptions" bson:"redemptions"`
+	TotalDiscount int64  `json:"totalDiscount" bson:"totalDiscount"`
+	TotalSubtotal int64  `json:"totalSubtotal" bson:"totalSubtotal"`
+}
@@ -0,0 +1,136 @@
+package webhookModel
+
+// Webhook is an endpoint of a third party that is sent platform events of
+// one organizer's events, or of a single event.
+type Webhook struct {
+	WebhookId   string   `json:"webhookId" bson:"webhookId"`
+	OrganizerId string   `json:"organizerId,omitempty" bson:"organizerId,omitempty"`
+	EventId     string   `json:"eventId,omitempty" bson:"eventId,omitempty"`
+	URL         string   `json:"url" bson:"url"`
+	Events      []string `json:"events" bson:"events"`
+	Description string   `json:"description,omitempty" bson:"description"`
+	// Secret signs every delivery; it is only shown when the webhook is created
+	Secret    string `json:"secret,omitempty" bson:"secret"`
+	Active    bool   `json:"active" bson:"active"`
+	CreatedBy string `json:"createdBy" bson:"createdBy"`
+	CreatedAt int64  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt" bson:"updatedAt"`
+}
+
+// WebhookReq creates a webhook, or edits one when WebhookId is set. Active
+// is only used when editing.
+type WebhookReq struct {
+	WebhookId   string   `json:"webhookId"`
+	OrganizerId string   `json:"organizerId"`
+	EventId     string   `json:"eventId"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+type WebhookListReq struct {
+	OrganizerId string `json:"organizerId"`
+	EventId     string `json:"eventId"`
+}
+
+type WebhookIdReq struct {
+	WebhookId string `json:"webhookId"`
+}
+
+// WebhookDelivery is one platform event sent to one webhook, with every
+// attempt to deliver it. Payload is the exact body that is signed and sent.
+type WebhookDelivery struct {
+	DeliveryId   string            `json:"deliveryId" bson:"deliveryId"`
+	WebhookId    string            `json:"webhookId" bson:"webhookId"`
+	MessageId    string            `json:"messageId" bson:"messageId"`
+	Type         string            `json:"type" bson:"type"`
+	EventId      string            `json:"eventId,omitempty" bson:"eventId,omitempty"`
+	URL          string            `json:"url" bson:"url"`
+	Payload      string            `json:"payload" bson:"payload"`
+	Status       string            `json:"status" bson:"status"`
+	Attempts     []DeliveryAttempt `json:"attempts,omitempty" bson:"attempts,omitempty"`
+	RedeliveryOf string            `json:"redeliveryOf,omitempty" bson:"redeliveryOf,omitempty"`
+	RequestedBy  string            `json:"requestedBy,omitempty" bson:"requestedBy,omitempty"`
+	CreatedAt    int64             `json:"createdAt" bson:"createdAt"`
+	DeliveredAt  int64             `json:"deliveredAt,omitempty" bson:"deliveredAt"`
+}
+
+type DeliveryAttempt struct {
+	At         int64  `json:"at" bson:"at"`
+	StatusCode int    `json:"statusCode,omitempty" bson:"statusCode"`
+	DurationMs int64  `json:"durationMs" bson:"durationMs"`
+	Error      string `json:"error,omitempty" bson:"error,omitempty"`
+	Response   string `json:"response,omitempty" bson:"response,omitempty"`
+}
+
+type DeliveryListReq struct {
+	WebhookId string `json:"webhookId"`
+	Status    string `json:"status"`
+	Type      string `json:"type"`
+}
+
+type RedeliverReq struct {
+	DeliveryId string `json:"deliveryId"`
+}
+
+// Envelope is the body of every delivery; Id stays the same when a delivery
+// is redelivered, so receivers can drop duplicates.
+type Envelope struct {
+	Id        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt int64       `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Data of registration.created
+type RegistrationData struct {
+	RegistrationId string `json:"registrationId"`
+	EventId        string `json:"eventId"`
+	TicketTypeId   string `json:"ticketTypeId,omitempty"`
+	TicketTypeName string `json:"ticketTypeName,omitempty"`
+	PrimaryEmailId string `json:"primaryEmailId"`
+	AttendeeName   string `json:"attendeeName,omitempty"`
+	AttendeeEmail  string `json:"attendeeEmail,omitempty"`
+	GroupOrderId   string `json:"groupOrderId,omitempty"`
+	Status         string `json:"status"`
+	RegisteredAt   int64  `json:"registeredAt"`
+}
+
+// Data of payment.captured
+type PaymentData struct {
+	OrderId     string `json:"orderId"`
+	PaymentId   string `json:"paymentId"`
+	EventId     string `json:"eventId"`
+	UserEmail   string `json:"userEmail"`
+	TicketCount int    `json:"ticketCount"`
+	// Amount is in minor units of Currency
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	PaidAt   int64  `json:"paidAt"`
+}
+
+// Data of checkin.completed
+type CheckinData struct {
+	RegistrationId string `json:"registrationId"`
+	EventId        string `json:"eventId"`
+	PrimaryEmailId string `json:"primaryEmailId"`
+	CheckedInAt    int64  `json:"checkedInAt"`
+}
+
+// Data of event.updated
+type EventData struct {
+	EventId       string        `json:"eventId"`
+	EventName     string        `json:"eventName"`
+	EventDate     int64         `json:"eventDate"`
+	EventLocation string        `json:"eventLocation,omitempty"`
+	EventMode     string        `json:"eventMode,omitempty"`
+	Status        string        `json:"status,omitempty"`
+	Changes       []EventChange `json:"changes"`
+}
+
+type EventChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
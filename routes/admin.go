@@ -10,7 +10,49 @@ import (
 func AdminPanel(app *fiber.App) {
 	adminApi := app.Group("/admin", middleware.AuthenticationMiddlewareForAdmin)
 
-	adminApi.Post("/addEvent", adminpanel.CreateEvent)
-	adminApi.Post("/editEvent", adminpanel.EditEvent)
-	adminApi.Post("/deleteEvent", adminpanel.DeleteEvent)
+	adminApi.Post("/addEvent", middleware.IdempotencyMiddleware, adminpanel.CreateEvent)
+	adminApi.Post("/editEvent", middleware.IdempotencyMiddleware, adminpanel.EditEvent)
+	adminApi.Post("/deleteEvent", middleware.IdempotencyMiddleware, adminpanel.DeleteEvent)
+	adminApi.Post("/cancelEvent", middleware.IdempotencyMiddleware, adminpanel.CancelEvent)
+
+	adminApi.Post("/addPromoCode", middleware.IdempotencyMiddleware, adminpanel.CreatePromoCode)
+	adminApi.Post("/editPromoCode", middleware.IdempotencyMiddleware, adminpanel.EditPromoCode)
+	adminApi.Post("/deletePromoCode", middleware.IdempotencyMiddleware, adminpanel.DeletePromoCode)
+	adminApi.Post("/getPromoCodes", adminpanel.GetPromoCodes)
+	adminApi.Post("/getPromoRedemptions", adminpanel.GetPromoRedemptions)
+
+	adminApi.Post("/refund", middleware.IdempotencyMiddleware, adminpanel.RefundOrder)
+	adminApi.Post("/getRefunds", adminpanel.GetRefunds)
+
+	adminApi.Post("/addOrganizer", middleware.IdempotencyMiddleware, adminpanel.CreateOrganizer)
+	adminApi.Post("/editOrganizer", middleware.IdempotencyMiddleware, adminpanel.EditOrganizer)
+	adminApi.Post("/getOrganizers", adminpanel.GetOrganizers)
+	adminApi.Post("/getInvoices", adminpanel.GetInvoices)
+
+	adminApi.Post("/getLedgerBalances", adminpanel.GetLedgerBalances)
+	adminApi.Post("/createPayout", middleware.IdempotencyMiddleware, adminpanel.CreatePayout)
+	adminApi.Post("/getSettlementStatement", adminpanel.GetSettlementStatement)
+
+	adminApi.Post("/setExchangeRates", middleware.IdempotencyMiddleware, adminpanel.SetExchangeRates)
+	adminApi.Post("/getExchangeRates", adminpanel.GetExchangeRates)
+
+	adminApi.Post("/getEmailTemplates", adminpanel.GetEmailTemplates)
+	adminApi.Post("/setEmailTemplate", middleware.IdempotencyMiddleware, adminpanel.SetEmailTemplate)
+	adminApi.Post("/deleteEmailTemplate", middleware.IdempotencyMiddleware, adminpanel.DeleteEmailTemplate)
+	adminApi.Post("/previewEmailTemplate", adminpanel.PreviewEmailTemplate)
+
+	adminApi.Post("/getNotificationJobs", adminpanel.GetNotificationJobs)
+	adminApi.Post("/replayNotificationJobs", middleware.IdempotencyMiddleware, adminpanel.ReplayNotificationJobs)
+	adminApi.Post("/setEventReminders", middleware.IdempotencyMiddleware, adminpanel.SetEventReminders)
+	adminApi.Post("/sendAnnouncement", middleware.IdempotencyMiddleware, adminpanel.SendAnnouncement)
+	adminApi.Post("/getAnnouncements", adminpanel.GetAnnouncements)
+	adminApi.Post("/addWebhook", middleware.IdempotencyMiddleware, adminpanel.AddWebhook)
+	adminApi.Post("/editWebhook", middleware.IdempotencyMiddleware, adminpanel.EditWebhook)
+	adminApi.Post("/deleteWebhook", middleware.IdempotencyMiddleware, adminpanel.DeleteWebhook)
+	adminApi.Post("/getWebhooks", adminpanel.GetWebhooks)
+	adminApi.Post("/getWebhookDeliveries", adminpanel.GetWebhookDeliveries)
+	adminApi.Post("/redeliverWebhook", middleware.IdempotencyMiddleware, adminpanel.RedeliverWebhook)
+
+	adminApi.Post("/reconcile", middleware.IdempotencyMiddleware, adminpanel.Reconcile)
+	adminApi.Post("/getReconciliationReports", adminpanel.GetReconciliationReports)
 }
@@ -12,9 +12,27 @@ func EventPanel(app *fiber.App) {
 
 	eventApi.Post("/getAllEvents", eventPanel.GetAllEvents)
 	eventApi.Post("/getEventById", eventPanel.GetEventByID)
-	eventApi.Post("/registerEvent", eventPanel.RegisterEvent)
+	eventApi.Post("/registerEvent", middleware.IdempotencyMiddleware, eventPanel.RegisterEvent)
+	eventApi.Post("/registerGroup", middleware.IdempotencyMiddleware, eventPanel.RegisterGroup)
+	eventApi.Post("/getGroupOrder", eventPanel.GetGroupOrder)
+	eventApi.Post("/assignAttendee", middleware.IdempotencyMiddleware, eventPanel.AssignAttendee)
+	eventApi.Post("/cancelRegistration", middleware.IdempotencyMiddleware, eventPanel.CancelRegistration)
 	eventApi.Post("/registration-form", eventPanel.GetRegistrationForm)
 	eventApi.Post("/getAllRegistrations", eventPanel.GetRegistrationDetails)
 	eventApi.Post("/getQR-ticket", eventPanel.GetTicketQR)
-	eventApi.Post("/verify-ticket", eventPanel.VerifyTicket)
+	eventApi.Post("/verify-ticket", middleware.IdempotencyMiddleware, eventPanel.VerifyTicket)
+	eventApi.Post("/getNotificationPreferences", eventPanel.GetNotificationPreferences)
+	eventApi.Post("/setNotificationPreferences", middleware.IdempotencyMiddleware, eventPanel.SetNotificationPreferences)
+	eventApi.Post("/setPhoneNumber", middleware.IdempotencyMiddleware, eventPanel.SetPhoneNumber)
+	eventApi.Post("/verifyPhoneNumber", middleware.IdempotencyMiddleware, eventPanel.VerifyPhoneNumber)
+	eventApi.Post("/getNotifications", eventPanel.GetNotifications)
+	eventApi.Post("/getUnreadNotificationCount", eventPanel.GetUnreadNotificationCount)
+	eventApi.Post("/markNotificationsRead", middleware.IdempotencyMiddleware, eventPanel.MarkNotificationsRead)
+	eventApi.Post("/markAllNotificationsRead", middleware.IdempotencyMiddleware, eventPanel.MarkAllNotificationsRead)
+	eventApi.Post("/downloadEventCalendar", eventPanel.DownloadEventCalendar)
+	eventApi.Post("/getCalendarFeed", eventPanel.GetCalendarFeed)
+	eventApi.Post("/resetCalendarFeed", middleware.IdempotencyMiddleware, eventPanel.ResetCalendarFeed)
+
+	// Calendar apps authenticate with the secret in the feed URL, not a session
+	app.Get("/calendar/:token.ics", eventPanel.CalendarFeed)
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	mailPanel "em_backend/controllers/mail"
+	mailutils "em_backend/library/mail"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func MailPanel(app *fiber.App) {
+	// Lets developers read the emails the file mailer wrote instead of sending
+	if mailutils.IsFileMailerActive() {
+		app.Post("/dev/mailbox", mailPanel.GetInbox)
+		app.Post("/dev/mailbox/message", mailPanel.GetInboxMessage)
+	}
+}
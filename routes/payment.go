@@ -3,6 +3,7 @@ package routes
 import (
 	paymentPanel "em_backend/controllers/payment"
 	"em_backend/library/middleware"
+	paymentutils "em_backend/library/payment"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -10,6 +11,15 @@ import (
 func PaymentPanel(app *fiber.App) {
 	paymentApi := app.Group("/payment", middleware.AuthenticationMiddleware)
 
-	paymentApi.Post("/create-order", paymentPanel.CreateOrderHandler)
-	paymentApi.Post("/verify-payment", paymentPanel.VerifyPaymentHandler)
+	paymentApi.Post("/create-order", middleware.IdempotencyMiddleware, paymentPanel.CreateOrderHandler)
+	paymentApi.Post("/verify-payment", middleware.IdempotencyMiddleware, paymentPanel.VerifyPaymentHandler)
+	paymentApi.Post("/invoice", paymentPanel.DownloadInvoiceHandler)
+
+	// Lets developers pay fake orders without a real gateway
+	if paymentutils.IsFakeProviderActive() {
+		paymentApi.Post("/fake/complete", middleware.IdempotencyMiddleware, paymentPanel.CompleteFakePaymentHandler)
+	}
+
+	// Provider webhooks authenticate with their signature, not a session
+	app.Post("/webhooks/:provider", paymentPanel.PaymentWebhookHandler)
 }